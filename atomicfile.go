@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// atomicFile writes to a temporary file alongside the destination and only
+// replaces the destination on Commit, so an interrupted or failed run never
+// leaves a truncated report in place of a good one.
+type atomicFile struct {
+	*os.File
+	path string
+	done bool
+}
+
+// createAtomic opens a temporary file in the same directory as path.
+func createAtomic(path string) (*atomicFile, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path}, nil
+}
+
+// Commit flushes the temporary file and renames it over the destination.
+func (a *atomicFile) Commit() error {
+	if a.done {
+		return fmt.Errorf("%s: already committed or aborted", a.path)
+	}
+	a.done = true
+
+	if err := a.File.Sync(); err != nil {
+		a.cleanup()
+		return err
+	}
+	if err := a.File.Close(); err != nil {
+		os.Remove(a.File.Name())
+		return err
+	}
+	// CreateTemp uses 0600; reports are not secrets, so match os.Create.
+	if err := os.Chmod(a.File.Name(), 0o644); err != nil {
+		os.Remove(a.File.Name())
+		return err
+	}
+	if err := os.Rename(a.File.Name(), a.path); err != nil {
+		os.Remove(a.File.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort discards the temporary file, leaving any existing destination untouched.
+// It is a no-op after Commit, so it is safe to defer.
+func (a *atomicFile) Abort() {
+	if a.done {
+		return
+	}
+	a.done = true
+	a.cleanup()
+}
+
+func (a *atomicFile) cleanup() {
+	a.File.Close()
+	os.Remove(a.File.Name())
+}
+
+// writeFileAtomic writes data to path via a temporary file and rename.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Commit()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile_Commit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.csv")
+	if err := os.WriteFile(path, []byte("old report\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := createAtomic(path)
+	if err != nil {
+		t.Fatalf("createAtomic() returned error: %v", err)
+	}
+	fmt.Fprint(f, "new report\n")
+
+	// Destination is untouched until commit
+	data, _ := os.ReadFile(path)
+	if string(data) != "old report\n" {
+		t.Errorf("destination changed before commit: %q", data)
+	}
+
+	if err := f.Commit(); err != nil {
+		t.Fatalf("Commit() returned error: %v", err)
+	}
+	f.Abort() // no-op after commit
+
+	data, _ = os.ReadFile(path)
+	if string(data) != "new report\n" {
+		t.Errorf("expected new report after commit, got %q", data)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the report to remain, found %d entries", len(entries))
+	}
+}
+
+func TestAtomicFile_AbortKeepsExistingReport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	if err := os.WriteFile(path, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := createAtomic(path)
+	if err != nil {
+		t.Fatalf("createAtomic() returned error: %v", err)
+	}
+	fmt.Fprint(f, `{"plugins": [`)
+	f.Abort()
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "{}\n" {
+		t.Errorf("expected existing report to survive abort, got %q", data)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected temporary file to be removed, found %d entries", len(entries))
+	}
+}
+
+func TestAtomicFile_MissingDirectory(t *testing.T) {
+	_, err := createAtomic(filepath.Join(t.TempDir(), "missing", "report.csv"))
+	if err == nil {
+		t.Error("expected error when the output directory does not exist")
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/url"
 	"sort"
 	"strings"
+	"time"
 
-	"golang.org/x/mod/semver"
+	"github.com/mattermost/mattermost/server/public/model"
 )
 
 // Plugin source categories.
@@ -16,6 +19,31 @@ const (
 	SourceThirdParty  = "third-party"
 )
 
+// Update states for a plugin's version comparison.
+const (
+	UpdateStateOutdated     = "outdated"
+	UpdateStateUpToDate     = "up-to-date"
+	UpdateStateAhead        = "ahead" // Installed is newer than the Marketplace: a pre-release or locally patched fork
+	UpdateStateIncomparable = "incomparable"
+	UpdateStateUnknown      = "unknown" // Not in the Marketplace, so there is nothing to compare against
+)
+
+// Update severities, from least to most significant.
+const (
+	SeverityPrerelease = "prerelease"
+	SeverityPatch      = "patch"
+	SeverityMinor      = "minor"
+	SeverityMajor      = "major"
+)
+
+// severityRank orders update severities for --min-severity filtering.
+var severityRank = map[string]int{
+	SeverityPrerelease: 1,
+	SeverityPatch:      2,
+	SeverityMinor:      3,
+	SeverityMajor:      4,
+}
+
 // bundledPlugins lists the exact plugin IDs that are bundled with Mattermost.
 var bundledPlugins = map[string]bool{
 	"mattermost-ai":                               true, // mattermost-plugin-agents
@@ -40,12 +68,21 @@ type PluginReport struct {
 	Name             string `json:"name"`
 	InstalledVersion string `json:"installed_version"`
 	LatestVersion    string `json:"latest_version"`
-	UpdateAvailable  string `json:"-"`
-	UpdateAvailJSON  *bool  `json:"update_available"`
+	UpdateAvailable  string `json:"-" report:"update_available"`
+	UpdateAvailJSON  *bool  `json:"update_available" report:"-"`
 	Status           string `json:"status"`
 	Source           string `json:"source"`
 	MarketplaceURL   string `json:"marketplace_url"`
 	PluginType       string `json:"type"`
+	UpdateState      string `json:"update_state"`
+	UpdateSeverity   string `json:"update_severity"`
+	ReleasesBehind   *int   `json:"releases_behind"`
+	HomepageURL      string `json:"homepage_url"`
+	ReleaseNotesURL  string `json:"release_notes_url"`
+
+	// Set only with --audit-settings
+	SettingsIssues *int             `json:"settings_issues"`
+	Settings       []SettingFinding `json:"settings,omitempty" report:"-"`
 }
 
 // AuditSummary holds aggregate statistics for the audit.
@@ -57,49 +94,138 @@ type AuditSummary struct {
 	ThirdParty       int `json:"third_party"`
 	Outdated         int `json:"outdated"`
 	UpToDate         int `json:"up_to_date"`
+	Ahead            int `json:"ahead"`
+	Incomparable     int `json:"incomparable"`
 	Unknown          int `json:"unknown"`
 	Enabled          int `json:"enabled"`
 	Disabled         int `json:"disabled"`
+	SettingsIssues   int `json:"settings_issues,omitempty"`
+
+	ServerSettingsWarnings int `json:"server_settings_warnings,omitempty"`
+	Orphans                int `json:"orphans,omitempty"`
 }
 
 // AuditResult holds the full audit output.
 type AuditResult struct {
 	Plugins []PluginReport `json:"plugins"`
 	Summary AuditSummary   `json:"summary"`
+	Server  *ServerInfo    `json:"server,omitempty"`
+
+	SettingsAudited bool                  `json:"-"` // Plugins carry settings findings
+	VersionHistory  bool                  `json:"-"` // The Marketplace source listed past releases, so releases_behind is counted
+	Installed       []PluginReport        `json:"-"` // Every installed plugin, before filtering
+	ServerSettings  *ServerSettingsReport `json:"server_plugin_settings,omitempty"`
+	Orphans         []Orphan              `json:"orphans,omitempty"` // Non-nil when orphans were checked
+}
+
+// ServerInfo identifies the audited server.
+type ServerInfo struct {
+	URL       string    `json:"url"`
+	Version   string    `json:"version"`
+	AuditedAt time.Time `json:"audited_at"`
+}
+
+// Host returns the host of the server's URL, or the URL if it has none.
+func (s *ServerInfo) Host() string {
+	if u, err := url.Parse(s.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return s.URL
 }
 
 // AuditOptions controls the behaviour of RunAudit.
 type AuditOptions struct {
-	OutdatedOnly bool
-	Verbose      bool
+	OutdatedOnly        bool
+	MinSeverity         string        // Only keep Marketplace plugins at least this far behind (implies outdated-only)
+	IncludeAhead        bool          // Also keep plugins ahead of the Marketplace when filtering
+	IncludeIncomparable bool          // Also keep plugins whose version can't be compared with the Marketplace when filtering
+	Filter              *PluginFilter // Only keep plugins matching all of the filter's criteria
+	SummaryAll          bool          // Summarise every installed plugin rather than the filtered set
+	Sort                []SortKey     // Replaces the default source-then-name order
+	AuditSettings       bool          // Check each plugin's configuration; the client must be a ConfigSource
+	AuditServerSettings bool          // Check the server's plugin settings against the hardening profile; the client must be a ConfigSource
+	FindOrphans         bool          // Compare the configuration with the installed plugins; the client must be a ConfigSource
+
+	Verbose bool
+
+	// OnReport, if set, is called with each plugin that passes the filters as
+	// soon as it is classified, before sorting and before the server settings
+	// and orphans are checked. An error aborts the audit.
+	OnReport func(PluginReport) error
 }
 
-// NormalizeVersion prepends "v" if missing, as required by golang.org/x/mod/semver.
-func NormalizeVersion(v string) string {
-	if v == "" {
+// keep reports whether r passes --outdated-only / --min-severity (keeping
+// ahead plugins with --include-ahead, and incomparable ones with
+// --include-incomparable) and the plugin filter.
+func (opts AuditOptions) keep(r PluginReport) bool {
+	if opts.OutdatedOnly || opts.MinSeverity != "" {
+		minRank := severityRank[opts.MinSeverity]
+		if r.Source == SourceMarketplace &&
+			!(r.UpdateAvailable == "true" && severityRank[r.UpdateSeverity] >= minRank) &&
+			!(opts.IncludeAhead && r.UpdateState == UpdateStateAhead) &&
+			!(opts.IncludeIncomparable && r.UpdateState == UpdateStateIncomparable) {
+			return false
+		}
+	}
+	return opts.Filter == nil || opts.Filter.Match(r)
+}
+
+// CompareVersions compares two version strings using ParseVersion.
+// Returns -1 if installed < latest, 0 if equal, 1 if installed > latest.
+// The second result is false if either version can't be parsed (and the
+// strings differ), in which case the versions are incomparable.
+func CompareVersions(installed, latest string) (int, bool) {
+	if installed == latest {
+		return 0, true
+	}
+
+	vi, okI := ParseVersion(installed)
+	vl, okL := ParseVersion(latest)
+	if !okI || !okL || !vi.Comparable(vl) {
+		return 0, false
+	}
+
+	return vi.Compare(vl), true
+}
+
+// UpdateSeverity classifies how far installed lags behind latest: "major",
+// "minor" or "patch" for the most significant differing component, or
+// "prerelease" when only the pre-release tag differs. Returns "" if installed
+// is not behind or the versions are incomparable.
+func UpdateSeverity(installed, latest string) string {
+	vi, okI := ParseVersion(installed)
+	vl, okL := ParseVersion(latest)
+	if !okI || !okL || !vi.Comparable(vl) || vi.Compare(vl) >= 0 {
 		return ""
 	}
-	if !strings.HasPrefix(v, "v") {
-		return "v" + v
+
+	switch vi.firstDifference(vl) {
+	case -1:
+		return SeverityPrerelease
+	case 0:
+		return SeverityMajor
+	case 1:
+		return SeverityMinor
+	default:
+		return SeverityPatch
 	}
-	return v
 }
 
-// CompareVersions compares two version strings using semantic versioning.
-// Returns -1 if installed < latest, 0 if equal, 1 if installed > latest.
-// Falls back to string equality if either version isn't valid semver.
-func CompareVersions(installed, latest string) int {
-	ni := NormalizeVersion(installed)
-	nl := NormalizeVersion(latest)
-
-	if !semver.IsValid(ni) || !semver.IsValid(nl) {
-		if installed == latest {
-			return 0
+// ReleasesBehind counts the published versions newer than installed, up to and
+// including latest. Returns nil when no version history is available.
+func ReleasesBehind(installed, latest string, history []string) *int {
+	if len(history) == 0 {
+		return nil
+	}
+	count := 0
+	for _, v := range history {
+		newer, ok1 := CompareVersions(installed, v)
+		notPast, ok2 := CompareVersions(v, latest)
+		if ok1 && ok2 && newer < 0 && notPast <= 0 {
+			count++
 		}
-		return -1
 	}
-
-	return semver.Compare(ni, nl)
+	return &count
 }
 
 // DeterminePluginType returns the plugin type based on which components are present.
@@ -138,19 +264,21 @@ func ClassifyPluginSource(pluginID string, inMarketplace bool, homepageURL strin
 
 // InstalledPlugin is a simplified representation of a plugin from the Mattermost API.
 type InstalledPlugin struct {
-	ID          string
-	Name        string
-	Version     string
-	HomepageURL string
-	Status      string // "enabled" or "disabled"
-	HasServer   bool
-	HasWebapp   bool
+	ID              string
+	Name            string
+	Version         string
+	HomepageURL     string
+	ReleaseNotesURL string
+	Status          string // "enabled" or "disabled"
+	HasServer       bool
+	HasWebapp       bool
+	Settings        []*model.PluginSetting // From the manifest's settings_schema
 }
 
 // RunAudit fetches installed plugins, queries the Marketplace, and produces an AuditResult.
-func RunAudit(mmClient MattermostClient, opts AuditOptions, logf func(string, ...interface{})) (*AuditResult, error) {
+func RunAudit(ctx context.Context, mmClient MattermostClient, opts AuditOptions, logf func(string, ...interface{})) (*AuditResult, error) {
 	logf("Fetching installed plugins from Mattermost instance...")
-	installed, err := mmClient.GetPlugins()
+	installed, err := mmClient.GetPlugins(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -158,58 +286,72 @@ func RunAudit(mmClient MattermostClient, opts AuditOptions, logf func(string, ..
 	logf("Found %d installed plugin(s)", len(installed))
 
 	logf("Fetching Marketplace catalogue...")
-	mpCatalogue, err := mmClient.GetMarketplacePlugins()
+	mpCatalogue, err := mmClient.GetMarketplacePlugins(ctx)
 	if err != nil {
 		return nil, err
 	}
 	logf("Marketplace catalogue contains %d plugin(s)", len(mpCatalogue))
+	versionHistory := false
+	for _, mp := range mpCatalogue {
+		versionHistory = versionHistory || len(mp.Versions) > 0
+	}
+
+	// The configuration is fetched up front only if plugins are checked
+	// against it, so that OnReport otherwise sees each plugin straight away
+	var cfg *model.Config
+	source, hasConfig := mmClient.(ConfigSource)
+	if (opts.AuditSettings || opts.AuditServerSettings || opts.FindOrphans) && !hasConfig {
+		return nil, errNoConfig()
+	}
+	fetchConfig := func() error {
+		logf("Fetching server configuration...")
+		cfg, err = source.GetConfig(ctx)
+		return err
+	}
+	if opts.AuditSettings {
+		if err := fetchConfig(); err != nil {
+			return nil, err
+		}
+	}
 
 	var reports []PluginReport
 
 	for _, p := range installed {
-		report := PluginReport{
-			PluginID:         p.ID,
-			Name:             p.Name,
-			InstalledVersion: p.Version,
-			Status:           p.Status,
-			PluginType:       DeterminePluginType(p.HasServer, p.HasWebapp),
+		report := buildReport(p, mpCatalogue, logf)
+		if opts.AuditSettings {
+			report.Settings = auditSettings(p, cfg)
+			n := len(report.Settings)
+			report.SettingsIssues = &n
 		}
-
-		mpPlugin, inMarketplace := mpCatalogue[p.ID]
-		report.Source = ClassifyPluginSource(p.ID, inMarketplace, p.HomepageURL)
-
-		if report.Source == SourceMarketplace {
-			report.LatestVersion = mpPlugin.Version
-			report.MarketplaceURL = mpPlugin.HomepageURL
-
-			cmp := CompareVersions(p.Version, mpPlugin.Version)
-			if cmp < 0 {
-				report.UpdateAvailable = "true"
-				b := true
-				report.UpdateAvailJSON = &b
-			} else {
-				report.UpdateAvailable = "false"
-				b := false
-				report.UpdateAvailJSON = &b
+		reports = append(reports, report)
+		if opts.OnReport != nil && opts.keep(report) {
+			if err := opts.OnReport(report); err != nil {
+				return nil, err
 			}
-		} else {
-			report.UpdateAvailable = "unknown"
-			report.UpdateAvailJSON = nil
 		}
+	}
 
-		reports = append(reports, report)
+	if cfg == nil && (opts.AuditServerSettings || opts.FindOrphans) {
+		if err := fetchConfig(); err != nil {
+			return nil, err
+		}
 	}
 
-	// Filter if --outdated-only
-	if opts.OutdatedOnly {
-		var filtered []PluginReport
-		for _, r := range reports {
-			if r.UpdateAvailable == "true" || r.Source != SourceMarketplace {
-				filtered = append(filtered, r)
-			}
+	// Summarise before filtering if the caller wants unfiltered totals
+	var unfiltered *AuditSummary
+	if opts.SummaryAll {
+		summary := computeSummary(reports)
+		unfiltered = &summary
+	}
+
+	installedReports := reports
+	var kept []PluginReport
+	for _, r := range reports {
+		if opts.keep(r) {
+			kept = append(kept, r)
 		}
-		reports = filtered
 	}
+	reports = kept
 
 	// Sort: marketplace first, then mattermost, then bundled, then third-party — alphabetically within each group
 	sourceOrder := map[string]int{
@@ -225,17 +367,116 @@ func RunAudit(mmClient MattermostClient, opts AuditOptions, logf func(string, ..
 		}
 		return strings.ToLower(reports[i].Name) < strings.ToLower(reports[j].Name)
 	})
+	// --sort keys take precedence, with the default order breaking ties
+	if len(opts.Sort) > 0 {
+		sortReports(reports, opts.Sort)
+	}
 
 	// Compute summary
+	summary := computeSummary(reports)
+	if unfiltered != nil {
+		summary = *unfiltered
+	}
+
+	result := &AuditResult{
+		Plugins:         reports,
+		Summary:         summary,
+		SettingsAudited: opts.AuditSettings,
+		VersionHistory:  versionHistory,
+		Installed:       installedReports,
+	}
+	if opts.AuditServerSettings {
+		result.ServerSettings = EvaluateServerSettings(cfg)
+		result.Summary.ServerSettingsWarnings = result.ServerSettings.Warnings
+	}
+	if opts.FindOrphans {
+		result.Orphans = FindOrphans(installed, cfg)
+		result.Summary.Orphans = len(result.Orphans)
+	}
+	return result, nil
+}
+
+// buildReport classifies an installed plugin and compares it with its
+// Marketplace entry, if any.
+func buildReport(p InstalledPlugin, mpCatalogue map[string]*MarketplacePlugin, logf func(string, ...interface{})) PluginReport {
+	report := PluginReport{
+		PluginID:         p.ID,
+		Name:             p.Name,
+		InstalledVersion: p.Version,
+		Status:           p.Status,
+		PluginType:       DeterminePluginType(p.HasServer, p.HasWebapp),
+		HomepageURL:      p.HomepageURL,
+		ReleaseNotesURL:  p.ReleaseNotesURL,
+	}
+
+	mpPlugin, inMarketplace := mpCatalogue[p.ID]
+	report.Source = ClassifyPluginSource(p.ID, inMarketplace, p.HomepageURL)
+
+	if report.Source == SourceMarketplace {
+		report.LatestVersion = mpPlugin.Version
+		report.MarketplaceURL = mpPlugin.HomepageURL
+		if mpPlugin.ReleaseNotesURL != "" {
+			report.ReleaseNotesURL = mpPlugin.ReleaseNotesURL
+		}
+
+		cmp, comparable := CompareVersions(p.Version, mpPlugin.Version)
+		switch {
+		case !comparable:
+			logf("Unable to compare versions %q and %q for %s", p.Version, mpPlugin.Version, p.ID)
+			report.UpdateAvailable = "unknown"
+			report.UpdateAvailJSON = nil
+			report.UpdateState = UpdateStateIncomparable
+		case cmp < 0:
+			report.UpdateAvailable = "true"
+			b := true
+			report.UpdateAvailJSON = &b
+			report.UpdateState = UpdateStateOutdated
+			report.UpdateSeverity = UpdateSeverity(p.Version, mpPlugin.Version)
+			report.ReleasesBehind = ReleasesBehind(p.Version, mpPlugin.Version, mpPlugin.Versions)
+		case cmp > 0:
+			report.UpdateAvailable = "false"
+			b := false
+			report.UpdateAvailJSON = &b
+			report.UpdateState = UpdateStateAhead
+		default:
+			report.UpdateAvailable = "false"
+			b := false
+			report.UpdateAvailJSON = &b
+			report.UpdateState = UpdateStateUpToDate
+		}
+	} else {
+		report.UpdateAvailable = "unknown"
+		report.UpdateAvailJSON = nil
+		report.UpdateState = UpdateStateUnknown
+	}
+	return report
+}
+
+// verboseLogger returns a logging function that prints to stderr when verbose is true.
+func verboseLogger(verbose bool) func(string, ...interface{}) {
+	return func(format string, args ...interface{}) {
+		if verbose {
+			fmt.Fprintf(logOutput, "[verbose] "+format+"\n", args...)
+		}
+	}
+}
+
+// computeSummary counts reports by source, update state and status.
+func computeSummary(reports []PluginReport) AuditSummary {
 	summary := AuditSummary{}
 	for _, r := range reports {
 		summary.Total++
 		switch r.Source {
 		case SourceMarketplace:
 			summary.Marketplace++
-			if r.UpdateAvailable == "true" {
+			switch r.UpdateState {
+			case UpdateStateOutdated:
 				summary.Outdated++
-			} else {
+			case UpdateStateIncomparable:
+				summary.Incomparable++
+			case UpdateStateAhead:
+				summary.Ahead++
+			default:
 				summary.UpToDate++
 			}
 		case SourceBundled:
@@ -253,19 +494,10 @@ func RunAudit(mmClient MattermostClient, opts AuditOptions, logf func(string, ..
 		} else {
 			summary.Disabled++
 		}
-	}
-
-	return &AuditResult{
-		Plugins: reports,
-		Summary: summary,
-	}, nil
-}
-
-// verboseLogger returns a logging function that prints to stderr when verbose is true.
-func verboseLogger(verbose bool) func(string, ...interface{}) {
-	return func(format string, args ...interface{}) {
-		if verbose {
-			fmt.Fprintf(logOutput, "[verbose] "+format+"\n", args...)
+		if r.SettingsIssues != nil {
+			summary.SettingsIssues += *r.SettingsIssues
 		}
 	}
+
+	return summary
 }
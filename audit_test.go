@@ -1,31 +1,12 @@
 package main
 
 import (
+	"context"
+	"strings"
 	"testing"
-)
-
-func TestNormalizeVersion(t *testing.T) {
-	tests := []struct {
-		name   string
-		input  string
-		expect string
-	}{
-		{"empty string", "", ""},
-		{"already has v prefix", "v1.2.3", "v1.2.3"},
-		{"missing v prefix", "1.2.3", "v1.2.3"},
-		{"prerelease", "1.2.3-rc1", "v1.2.3-rc1"},
-		{"already has v with prerelease", "v1.2.3-rc1", "v1.2.3-rc1"},
-	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := NormalizeVersion(tt.input)
-			if result != tt.expect {
-				t.Errorf("NormalizeVersion(%q) = %q, want %q", tt.input, result, tt.expect)
-			}
-		})
-	}
-}
+	"github.com/mattermost/mattermost/server/public/model"
+)
 
 func TestCompareVersions(t *testing.T) {
 	tests := []struct {
@@ -45,23 +26,101 @@ func TestCompareVersions(t *testing.T) {
 		{"semver gotcha reverse: 1.10.0 > 1.9.0", "1.10.0", "1.9.0", 1},
 		{"installed newer than marketplace", "1.11.0", "1.10.0", 1},
 		{"prerelease vs release", "1.0.0-rc1", "1.0.0", -1},
-		{"both invalid semver but equal", "abc", "abc", 0},
-		{"both invalid semver but different", "abc", "def", -1},
-		{"installed invalid, latest valid", "abc", "1.0.0", -1},
-		{"installed valid, latest invalid", "1.0.0", "abc", -1},
+		{"two-part version", "1.2", "1.2.1", -1},
+		{"two-part equals three-part", "1.2", "1.2.0", 0},
+		{"calendar version", "2024.03.1", "2024.10.0", -1},
+		{"build metadata ignored", "1.2.3+build5", "1.2.3", 0},
+		{"release prefix", "release-1.2", "v1.3.0", -1},
+		{"unhyphenated release candidate", "1.2.3rc1", "1.2.3", -1},
+		{"release candidate ordering", "1.2.3-rc2", "1.2.3-rc10", -1},
+		{"four-part version", "1.2.3.4", "1.2.3", 1},
+		{"both invalid but equal", "abc", "abc", 0},
+		{"suffix with an older core", "1.2.3-hotfix1", "1.2.4", -1},
+		{"suffix with a newer core", "1.3.0-ent", "1.2.4", 1},
+		{"same suffix", "1.2.3-ent", "v1.2.3-ent", 0},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := CompareVersions(tt.installed, tt.latest)
+			result, ok := CompareVersions(tt.installed, tt.latest)
+			if !ok || result != tt.expect {
+				t.Errorf("CompareVersions(%q, %q) = %d, %v, want %d, true",
+					tt.installed, tt.latest, result, ok, tt.expect)
+			}
+		})
+	}
+}
+
+func TestCompareVersions_Incomparable(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed string
+		latest    string
+	}{
+		{"both invalid but different", "abc", "def"},
+		{"installed invalid", "abc", "1.0.0"},
+		{"latest invalid", "1.0.0", "abc"},
+		{"empty installed", "", "1.0.0"},
+		{"hotfix of the same release", "1.2.3-hotfix1", "1.2.3"},
+		{"edition of the same release", "1.2.3", "1.2.3-ent"},
+		{"different suffixes", "1.2.3-ent", "1.2.3-hotfix1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := CompareVersions(tt.installed, tt.latest); ok {
+				t.Errorf("CompareVersions(%q, %q) reported comparable, want incomparable", tt.installed, tt.latest)
+			}
+		})
+	}
+}
+
+func TestUpdateSeverity(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed string
+		latest    string
+		expect    string
+	}{
+		{"major behind", "1.4.0", "3.0.0", SeverityMajor},
+		{"minor behind", "1.4.0", "1.6.2", SeverityMinor},
+		{"patch behind", "1.4.0", "1.4.3", SeverityPatch},
+		{"prerelease to release", "1.4.0-rc1", "1.4.0", SeverityPrerelease},
+		{"prerelease to newer prerelease", "1.4.0-rc1", "1.4.0-rc2", SeverityPrerelease},
+		{"prerelease to next patch", "1.4.0-rc1", "1.4.1", SeverityPatch},
+		{"up to date", "1.4.0", "1.4.0", ""},
+		{"installed newer", "2.0.0", "1.4.0", ""},
+		{"two-part minor", "1.2", "1.3", SeverityMinor},
+		{"calendar patch", "2024.03.1", "2024.03.2", SeverityPatch},
+		{"invalid version", "abc", "def", ""},
+		{"suffixed same release", "1.4.0-hotfix1", "1.4.0", ""},
+		{"suffixed patch behind", "1.4.0-ent", "1.4.1", SeverityPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := UpdateSeverity(tt.installed, tt.latest)
 			if result != tt.expect {
-				t.Errorf("CompareVersions(%q, %q) = %d, want %d",
-					tt.installed, tt.latest, result, tt.expect)
+				t.Errorf("UpdateSeverity(%q, %q) = %q, want %q", tt.installed, tt.latest, result, tt.expect)
 			}
 		})
 	}
 }
 
+func TestReleasesBehind(t *testing.T) {
+	history := []string{"1.0.0", "1.1.0", "1.2.0", "1.2.1", "2.0.0-rc1", "2.0.0"}
+
+	if got := ReleasesBehind("1.1.0", "2.0.0", history); got == nil || *got != 4 {
+		t.Errorf("expected 4 releases behind, got %v", got)
+	}
+	if got := ReleasesBehind("1.2.1", "1.2.1", history); got == nil || *got != 0 {
+		t.Errorf("expected 0 releases behind when current, got %v", got)
+	}
+	if got := ReleasesBehind("1.1.0", "2.0.0", nil); got != nil {
+		t.Errorf("expected nil without version history, got %d", *got)
+	}
+}
+
 func TestDeterminePluginType(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -142,17 +201,18 @@ func TestClassifyPluginSource(t *testing.T) {
 
 // mockMMClient implements MattermostClient for testing.
 type mockMMClient struct {
-	plugins   []InstalledPlugin
-	err       error
-	mpPlugins map[string]*MarketplacePlugin
-	mpErr     error
+	plugins       []InstalledPlugin
+	err           error
+	mpPlugins     map[string]*MarketplacePlugin
+	mpErr         error
+	serverVersion string
 }
 
-func (m *mockMMClient) GetPlugins() ([]InstalledPlugin, error) {
+func (m *mockMMClient) GetPlugins(ctx context.Context) ([]InstalledPlugin, error) {
 	return m.plugins, m.err
 }
 
-func (m *mockMMClient) GetMarketplacePlugins() (map[string]*MarketplacePlugin, error) {
+func (m *mockMMClient) GetMarketplacePlugins(ctx context.Context) (map[string]*MarketplacePlugin, error) {
 	if m.mpErr != nil {
 		return nil, m.mpErr
 	}
@@ -162,6 +222,10 @@ func (m *mockMMClient) GetMarketplacePlugins() (map[string]*MarketplacePlugin, e
 	return m.mpPlugins, nil
 }
 
+func (m *mockMMClient) GetServerVersion(ctx context.Context) (string, error) {
+	return m.serverVersion, m.err
+}
+
 func noopLogger(format string, args ...interface{}) {}
 
 func TestRunAudit_AllUpToDate(t *testing.T) {
@@ -176,7 +240,7 @@ func TestRunAudit_AllUpToDate(t *testing.T) {
 		},
 	}
 
-	result, err := RunAudit(mm, AuditOptions{}, noopLogger)
+	result, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
 	if err != nil {
 		t.Fatalf("RunAudit() returned error: %v", err)
 	}
@@ -208,7 +272,7 @@ func TestRunAudit_SomeOutdated(t *testing.T) {
 		},
 	}
 
-	result, err := RunAudit(mm, AuditOptions{}, noopLogger)
+	result, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
 	if err != nil {
 		t.Fatalf("RunAudit() returned error: %v", err)
 	}
@@ -225,6 +289,9 @@ func TestRunAudit_SomeOutdated(t *testing.T) {
 	if result.Summary.Disabled != 1 {
 		t.Errorf("expected 1 disabled, got %d", result.Summary.Disabled)
 	}
+	if result.VersionHistory {
+		t.Error("expected no VersionHistory from a catalogue of latest releases")
+	}
 }
 
 func TestRunAudit_FourWayCategorization(t *testing.T) {
@@ -240,7 +307,7 @@ func TestRunAudit_FourWayCategorization(t *testing.T) {
 		},
 	}
 
-	result, err := RunAudit(mm, AuditOptions{}, noopLogger)
+	result, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
 	if err != nil {
 		t.Fatalf("RunAudit() returned error: %v", err)
 	}
@@ -291,7 +358,7 @@ func TestRunAudit_InstalledNewerThanMarketplace(t *testing.T) {
 		},
 	}
 
-	result, err := RunAudit(mm, AuditOptions{}, noopLogger)
+	result, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
 	if err != nil {
 		t.Fatalf("RunAudit() returned error: %v", err)
 	}
@@ -299,11 +366,199 @@ func TestRunAudit_InstalledNewerThanMarketplace(t *testing.T) {
 	if result.Summary.Outdated != 0 {
 		t.Errorf("expected 0 outdated when installed is newer, got %d", result.Summary.Outdated)
 	}
-	if result.Summary.UpToDate != 1 {
-		t.Errorf("expected 1 up to date when installed is newer, got %d", result.Summary.UpToDate)
+	if result.Summary.UpToDate != 0 || result.Summary.Ahead != 1 {
+		t.Errorf("expected 0 up to date and 1 ahead when installed is newer, got %d and %d", result.Summary.UpToDate, result.Summary.Ahead)
 	}
-	if result.Plugins[0].UpdateAvailable != "false" {
-		t.Errorf("expected update_available false when installed is newer, got %s", result.Plugins[0].UpdateAvailable)
+	if result.Plugins[0].UpdateAvailable != "false" || result.Plugins[0].UpdateState != UpdateStateAhead {
+		t.Errorf("expected ahead when installed is newer, got %s/%s", result.Plugins[0].UpdateAvailable, result.Plugins[0].UpdateState)
+	}
+	if b := result.Plugins[0].UpdateAvailJSON; b == nil || *b {
+		t.Errorf("expected JSON update_available false when installed is newer, got %v", b)
+	}
+}
+
+func TestRunAudit_IncludeAheadAndIncomparable(t *testing.T) {
+	mm := &mockMMClient{
+		plugins: []InstalledPlugin{
+			{ID: "com.mattermost.confluence", Name: "Confluence", Version: "1.5.0-beta1", Status: "enabled", HasServer: true},
+			{ID: "com.mattermost.welcomebot", Name: "WelcomeBot", Version: "1.1.0", Status: "enabled", HasServer: true},
+			{ID: "com.mattermost.jira", Name: "Jira", Version: "4.0.0", Status: "enabled", HasServer: true},
+			{ID: "com.mattermost.zoom", Name: "Zoom", Version: "1.6.0-hotfix1", Status: "enabled", HasServer: true},
+		},
+		mpPlugins: map[string]*MarketplacePlugin{
+			"com.mattermost.confluence": {Version: "1.4.0"},
+			"com.mattermost.welcomebot": {Version: "1.2.0"},
+			"com.mattermost.jira":       {Version: "4.0.0"},
+			"com.mattermost.zoom":       {Version: "1.6.0"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		opts   AuditOptions
+		expect []string
+	}{
+		{"outdated only", AuditOptions{OutdatedOnly: true}, []string{"WelcomeBot"}},
+		{"outdated plus ahead", AuditOptions{OutdatedOnly: true, IncludeAhead: true}, []string{"Confluence", "WelcomeBot"}},
+		{"outdated plus incomparable", AuditOptions{OutdatedOnly: true, IncludeIncomparable: true}, []string{"WelcomeBot", "Zoom"}},
+		{"severity plus incomparable", AuditOptions{MinSeverity: SeverityMinor, IncludeIncomparable: true}, []string{"WelcomeBot", "Zoom"}},
+		{"severity drops incomparable", AuditOptions{MinSeverity: SeverityMinor}, []string{"WelcomeBot"}},
+		{"no filter", AuditOptions{IncludeAhead: true}, []string{"Confluence", "Jira", "WelcomeBot", "Zoom"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RunAudit(context.Background(), mm, tt.opts, noopLogger)
+			if err != nil {
+				t.Fatalf("RunAudit() returned error: %v", err)
+			}
+			var names []string
+			for _, p := range result.Plugins {
+				names = append(names, p.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.expect, ",") {
+				t.Errorf("expected plugins %v, got %v", tt.expect, names)
+			}
+		})
+	}
+}
+
+func TestRunAudit_IncomparableVersion(t *testing.T) {
+	mm := &mockMMClient{
+		plugins: []InstalledPlugin{
+			{ID: "com.mattermost.confluence", Name: "Confluence", Version: "custom-build", Status: "enabled", HasServer: true},
+			{ID: "com.mattermost.welcomebot", Name: "WelcomeBot", Version: "1.2", Status: "enabled", HasServer: true},
+		},
+		mpPlugins: map[string]*MarketplacePlugin{
+			"com.mattermost.confluence": {Version: "1.4.0"},
+			"com.mattermost.welcomebot": {Version: "1.3.0"},
+		},
+	}
+
+	result, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+
+	byID := make(map[string]PluginReport)
+	for _, p := range result.Plugins {
+		byID[p.PluginID] = p
+	}
+
+	confluence := byID["com.mattermost.confluence"]
+	if confluence.UpdateAvailable != "unknown" || confluence.UpdateState != UpdateStateIncomparable {
+		t.Errorf("expected incomparable for unparseable version, got %s/%s", confluence.UpdateAvailable, confluence.UpdateState)
+	}
+	if confluence.UpdateAvailJSON != nil {
+		t.Errorf("expected nil JSON update_available for incomparable version, got %v", *confluence.UpdateAvailJSON)
+	}
+
+	welcomebot := byID["com.mattermost.welcomebot"]
+	if welcomebot.UpdateState != UpdateStateOutdated || welcomebot.UpdateSeverity != SeverityMinor {
+		t.Errorf("expected two-part version to be a minor update, got %s/%s", welcomebot.UpdateState, welcomebot.UpdateSeverity)
+	}
+
+	if result.Summary.Incomparable != 1 || result.Summary.Outdated != 1 || result.Summary.UpToDate != 0 {
+		t.Errorf("unexpected summary counts: %+v", result.Summary)
+	}
+}
+
+func TestRunAudit_FilterAndSummary(t *testing.T) {
+	mm := &mockMMClient{
+		plugins: []InstalledPlugin{
+			{ID: "com.mattermost.confluence", Name: "Confluence", Version: "1.3.0", Status: "disabled", HasServer: true, HasWebapp: true},
+			{ID: "com.mattermost.welcomebot", Name: "WelcomeBot", Version: "1.2.0", Status: "enabled", HasServer: true},
+			{ID: "com.mattermost.calls", Name: "Calls", Version: "1.10.0", Status: "disabled", HasServer: true, HasWebapp: true},
+		},
+		mpPlugins: map[string]*MarketplacePlugin{
+			"com.mattermost.confluence": {Version: "1.4.0"},
+			"com.mattermost.welcomebot": {Version: "1.2.0"},
+		},
+	}
+	filter, err := FilterSpec{Where: `source == "marketplace" && status == "disabled"`}.Build()
+	if err != nil {
+		t.Fatalf("Build() returned error: %v", err)
+	}
+
+	result, err := RunAudit(context.Background(), mm, AuditOptions{Filter: filter}, noopLogger)
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+	if len(result.Plugins) != 1 || result.Plugins[0].Name != "Confluence" {
+		t.Fatalf("expected only Confluence, got %+v", result.Plugins)
+	}
+	if result.Summary.Total != 1 || result.Summary.Outdated != 1 {
+		t.Errorf("expected summary over the filtered set, got %+v", result.Summary)
+	}
+
+	result, err = RunAudit(context.Background(), mm, AuditOptions{Filter: filter, SummaryAll: true}, noopLogger)
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+	if len(result.Plugins) != 1 {
+		t.Fatalf("expected 1 plugin with --summary-all, got %d", len(result.Plugins))
+	}
+	if result.Summary.Total != 3 || result.Summary.Marketplace != 2 || result.Summary.Bundled != 1 {
+		t.Errorf("expected unfiltered summary totals, got %+v", result.Summary)
+	}
+}
+
+func TestRunAudit_OnReport(t *testing.T) {
+	mm := &mockMMClient{
+		plugins: []InstalledPlugin{
+			{ID: "com.mattermost.welcomebot", Name: "WelcomeBot", Version: "1.2.0", Status: "enabled", HasServer: true},
+			{ID: "com.mattermost.confluence", Name: "Confluence", Version: "1.3.0", Status: "enabled", HasServer: true},
+			{ID: "com.pexip.meetings", Name: "Pexip", Version: "1.3.0", Status: "enabled", HasServer: true},
+		},
+		mpPlugins: map[string]*MarketplacePlugin{
+			"com.mattermost.welcomebot": {Version: "1.2.0"},
+			"com.mattermost.confluence": {Version: "1.4.0"},
+		},
+	}
+
+	var streamed []string
+	result, err := RunAudit(context.Background(), mm, AuditOptions{
+		OutdatedOnly: true,
+		OnReport: func(p PluginReport) error {
+			streamed = append(streamed, p.Name)
+			return nil
+		},
+	}, noopLogger)
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+	if strings.Join(streamed, ",") != "Confluence,Pexip" {
+		t.Errorf("expected filtered plugins streamed in audit order, got %v", streamed)
+	}
+	if len(result.Plugins) != 2 {
+		t.Errorf("expected the result to hold the same plugins, got %d", len(result.Plugins))
+	}
+
+	_, err = RunAudit(context.Background(), mm, AuditOptions{
+		OnReport: func(PluginReport) error { return outputError("error: failed to write output.", nil) },
+	}, noopLogger)
+	if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitOutputError {
+		t.Errorf("expected the callback's error to abort the audit, got %v", err)
+	}
+
+	// Plugins arrive before the configuration is fetched for the orphan check
+	var events []string
+	_, err = RunAudit(context.Background(), &mockConfigClient{mockMMClient: *mm, cfg: &model.Config{}}, AuditOptions{
+		FindOrphans: true,
+		OnReport: func(p PluginReport) error {
+			events = append(events, p.Name)
+			return nil
+		},
+	}, func(format string, args ...interface{}) {
+		if strings.HasPrefix(format, "Fetching server configuration") {
+			events = append(events, "config")
+		}
+	})
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+	if got := strings.Join(events, ","); got != "WelcomeBot,Confluence,Pexip,config" {
+		t.Errorf("expected plugins streamed before the configuration was fetched, got %s", got)
 	}
 }
 
@@ -321,7 +576,7 @@ func TestRunAudit_OutdatedOnlyFilter(t *testing.T) {
 		},
 	}
 
-	result, err := RunAudit(mm, AuditOptions{OutdatedOnly: true}, noopLogger)
+	result, err := RunAudit(context.Background(), mm, AuditOptions{OutdatedOnly: true}, noopLogger)
 	if err != nil {
 		t.Fatalf("RunAudit() returned error: %v", err)
 	}
@@ -347,7 +602,7 @@ func TestRunAudit_MarketplaceUnreachable(t *testing.T) {
 		mpErr: apiError("marketplace unreachable", nil),
 	}
 
-	_, err := RunAudit(mm, AuditOptions{}, noopLogger)
+	_, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
 	if err == nil {
 		t.Fatal("expected error when marketplace is unreachable")
 	}
@@ -366,7 +621,7 @@ func TestRunAudit_MMClientError(t *testing.T) {
 		err: apiError("connection failed", nil),
 	}
 
-	_, err := RunAudit(mm, AuditOptions{}, noopLogger)
+	_, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
 	if err == nil {
 		t.Fatal("expected error when MM client fails")
 	}
@@ -377,7 +632,7 @@ func TestRunAudit_NoPlugins(t *testing.T) {
 		plugins: []InstalledPlugin{},
 	}
 
-	result, err := RunAudit(mm, AuditOptions{}, noopLogger)
+	result, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
 	if err != nil {
 		t.Fatalf("RunAudit() returned error: %v", err)
 	}
@@ -402,7 +657,7 @@ func TestRunAudit_SortOrder(t *testing.T) {
 		},
 	}
 
-	result, err := RunAudit(mm, AuditOptions{}, noopLogger)
+	result, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
 	if err != nil {
 		t.Fatalf("RunAudit() returned error: %v", err)
 	}
@@ -446,7 +701,7 @@ func TestRunAudit_BundledPluginOverridesMarketplace(t *testing.T) {
 		},
 	}
 
-	result, err := RunAudit(mm, AuditOptions{}, noopLogger)
+	result, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
 	if err != nil {
 		t.Fatalf("RunAudit() returned error: %v", err)
 	}
@@ -464,3 +719,81 @@ func TestRunAudit_BundledPluginOverridesMarketplace(t *testing.T) {
 		}
 	}
 }
+
+func TestRunAudit_UpdateSeverity(t *testing.T) {
+	mm := &mockMMClient{
+		plugins: []InstalledPlugin{
+			{ID: "com.mattermost.confluence", Name: "Confluence", Version: "1.3.0", Status: "enabled"},
+			{ID: "com.mattermost.welcomebot", Name: "WelcomeBot", Version: "1.2.0", Status: "enabled"},
+			{ID: "com.mattermost.todo", Name: "Todo", Version: "0.6.1", Status: "enabled"},
+		},
+		mpPlugins: map[string]*MarketplacePlugin{
+			"com.mattermost.confluence": {Version: "1.4.0", Versions: []string{"1.3.0", "1.3.1", "1.4.0"}},
+			"com.mattermost.welcomebot": {Version: "1.2.0"},
+			"com.mattermost.todo":       {Version: "0.6.2"},
+		},
+	}
+
+	result, err := RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+
+	if !result.VersionHistory {
+		t.Error("expected VersionHistory when the catalogue lists past releases")
+	}
+	for _, p := range result.Plugins {
+		switch p.PluginID {
+		case "com.mattermost.confluence":
+			if p.UpdateSeverity != SeverityMinor {
+				t.Errorf("Confluence severity = %q, want minor", p.UpdateSeverity)
+			}
+			if p.ReleasesBehind == nil || *p.ReleasesBehind != 2 {
+				t.Errorf("Confluence releases behind = %v, want 2", p.ReleasesBehind)
+			}
+		case "com.mattermost.welcomebot":
+			if p.UpdateSeverity != "" || p.ReleasesBehind != nil {
+				t.Errorf("WelcomeBot is up to date; got severity %q, releases behind %v", p.UpdateSeverity, p.ReleasesBehind)
+			}
+		case "com.mattermost.todo":
+			if p.UpdateSeverity != SeverityPatch {
+				t.Errorf("Todo severity = %q, want patch", p.UpdateSeverity)
+			}
+			if p.ReleasesBehind != nil {
+				t.Errorf("Todo has no version history; expected nil releases behind, got %d", *p.ReleasesBehind)
+			}
+		}
+	}
+}
+
+func TestRunAudit_MinSeverityFilter(t *testing.T) {
+	mm := &mockMMClient{
+		plugins: []InstalledPlugin{
+			{ID: "com.mattermost.confluence", Name: "Confluence", Version: "1.3.0", Status: "enabled"},
+			{ID: "com.mattermost.todo", Name: "Todo", Version: "0.6.1", Status: "enabled"},
+			{ID: "com.mattermost.welcomebot", Name: "WelcomeBot", Version: "1.2.0", Status: "enabled"},
+			{ID: "com.pexip.meetings", Name: "Pexip", Version: "1.3.0", Status: "enabled"},
+		},
+		mpPlugins: map[string]*MarketplacePlugin{
+			"com.mattermost.confluence": {Version: "2.0.0"},
+			"com.mattermost.todo":       {Version: "0.6.2"},
+			"com.mattermost.welcomebot": {Version: "1.2.0"},
+		},
+	}
+
+	result, err := RunAudit(context.Background(), mm, AuditOptions{MinSeverity: SeverityMinor}, noopLogger)
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+
+	// Should include: Confluence (major), Pexip (third-party)
+	// Should exclude: Todo (patch only), WelcomeBot (up to date)
+	if result.Summary.Total != 2 {
+		t.Errorf("expected 2 plugins with --min-severity minor, got %d", result.Summary.Total)
+	}
+	for _, p := range result.Plugins {
+		if p.PluginID == "com.mattermost.todo" || p.PluginID == "com.mattermost.welcomebot" {
+			t.Errorf("%s should be excluded by --min-severity minor", p.Name)
+		}
+	}
+}
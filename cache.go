@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// cacheFileVersion is bumped whenever the on-disk cache layout changes.
+const cacheFileVersion = 3
+
+// MarketplaceCache stores Marketplace catalogues on disk, keyed by Mattermost
+// server version and where the catalogue came from, so repeated runs (or runs
+// against several servers on the same release) avoid re-fetching the full
+// catalogue.
+type MarketplaceCache struct {
+	Dir     string        // Directory holding cache files
+	TTL     time.Duration // Maximum age of a cache entry before it is re-fetched
+	Refresh bool          // Ignore fresh entries and always fetch (still updates the cache)
+	Logf    func(string, ...interface{})
+
+	now func() time.Time
+}
+
+// cacheEntry is the on-disk representation of a cached catalogue.
+type cacheEntry struct {
+	Version       int                           `json:"version"`
+	ServerVersion string                        `json:"server_version"`
+	Source        string                        `json:"source"`
+	Platform      string                        `json:"platform,omitempty"`
+	FetchedAt     time.Time                     `json:"fetched_at"`
+	Plugins       map[string]*MarketplacePlugin `json:"plugins"`
+}
+
+// defaultCacheDir returns the per-user cache directory for the tool.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "mm-plugin-audit")
+	}
+	return filepath.Join(dir, "mm-plugin-audit")
+}
+
+// Wrap returns a MarketplaceSource that serves the catalogue for serverVersion
+// from the cache when fresh, and falls back to a stale entry if src fails.
+// marketplaceURL and platform identify a Marketplace queried directly; both
+// are empty for the server's proxy, whose catalogue depends on the server's
+// own Marketplace URL and so is keyed by server (its URL, or its socket in
+// local mode). Without a server version, or a server for the proxy, there is
+// no safe key, so src is returned uncached.
+func (c *MarketplaceCache) Wrap(src MarketplaceSource, server, serverVersion, marketplaceURL, platform string) MarketplaceSource {
+	if serverVersion == "" {
+		c.Logf("Cache disabled: the server version is unknown")
+		return src
+	}
+	marketplaceURL = strings.TrimRight(marketplaceURL, "/")
+	if marketplaceURL == "" {
+		server = strings.ToLower(strings.TrimRight(server, "/"))
+		if server == "" {
+			c.Logf("Cache disabled: the server's proxy has no URL to key it by")
+			return src
+		}
+		marketplaceURL, platform = "server proxy "+server, ""
+	}
+	return &cachedMarketplace{cache: c, source: src, serverVersion: serverVersion, marketplaceURL: marketplaceURL, platform: platform}
+}
+
+type cachedMarketplace struct {
+	cache          *MarketplaceCache
+	source         MarketplaceSource
+	serverVersion  string
+	marketplaceURL string // "server proxy" and the server for the server's proxy endpoint
+	platform       string
+}
+
+func (m *cachedMarketplace) GetMarketplacePlugins(ctx context.Context) (map[string]*MarketplacePlugin, error) {
+	c := m.cache
+	path := c.path(m.serverVersion, m.marketplaceURL, m.platform)
+
+	entry, err := c.load(path)
+	if entry != nil && (entry.ServerVersion != m.serverVersion || entry.Source != m.marketplaceURL || entry.Platform != m.platform) {
+		entry = nil // A hash collision or a hand-edited file
+	}
+	switch {
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		c.Logf("Cache miss: unable to read %s (%v)", path, err)
+	case entry == nil:
+		c.Logf("Cache miss: no cached catalogue for server version %s", m.serverVersion)
+	case c.Refresh:
+		c.Logf("Cache bypassed: --refresh-cache set, fetching live catalogue")
+	case c.age(entry) > c.TTL:
+		c.Logf("Cache expired: catalogue for server version %s is %s old (TTL %s)",
+			m.serverVersion, c.age(entry).Round(time.Second), c.TTL)
+	default:
+		c.Logf("Cache hit: using catalogue for server version %s fetched %s ago",
+			m.serverVersion, c.age(entry).Round(time.Second))
+		return entry.Plugins, nil
+	}
+
+	plugins, err := m.source.GetMarketplacePlugins(ctx)
+	if err != nil {
+		if entry == nil || ctx.Err() != nil {
+			return nil, err
+		}
+		fmt.Fprintf(logOutput, "warning: Marketplace fetch failed (%v); using cached catalogue from %s\n",
+			err, entry.FetchedAt.Local().Format(time.RFC3339))
+		return entry.Plugins, nil
+	}
+
+	if err := c.store(path, m, plugins); err != nil {
+		c.Logf("Unable to update Marketplace cache %s: %v", path, err)
+	} else {
+		c.Logf("Cached Marketplace catalogue at %s", path)
+	}
+	return plugins, nil
+}
+
+var unsafeCacheKey = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// path returns the cache file for a server version's catalogue from a
+// Marketplace and platform.
+func (c *MarketplaceCache) path(serverVersion, marketplaceURL, platform string) string {
+	key := unsafeCacheKey.ReplaceAllString(serverVersion, "_")
+	sum := sha256.Sum256([]byte(marketplaceURL + "\n" + platform))
+	return filepath.Join(c.Dir, "marketplace-"+key+"-"+hex.EncodeToString(sum[:4])+".json")
+}
+
+func (c *MarketplaceCache) age(entry *cacheEntry) time.Duration {
+	return c.clock().Sub(entry.FetchedAt)
+}
+
+func (c *MarketplaceCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// load reads a cache entry, returning (nil, nil) for entries written by an
+// incompatible version of the tool.
+func (c *MarketplaceCache) load(path string) (*cacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	if entry.Version != cacheFileVersion || entry.Plugins == nil {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// store writes a cache entry atomically.
+func (c *MarketplaceCache) store(path string, m *cachedMarketplace, plugins map[string]*MarketplacePlugin) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cacheEntry{
+		Version:       cacheFileVersion,
+		ServerVersion: m.serverVersion,
+		Source:        m.marketplaceURL,
+		Platform:      m.platform,
+		FetchedAt:     c.clock().UTC(),
+		Plugins:       plugins,
+	})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func displayVersion(v string) string {
+	if v == "" {
+		return "(unknown)"
+	}
+	return v
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingSource is a MarketplaceSource that records how often it is called.
+type countingSource struct {
+	plugins map[string]*MarketplacePlugin
+	err     error
+	calls   int
+}
+
+func (s *countingSource) GetMarketplacePlugins(ctx context.Context) (map[string]*MarketplacePlugin, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.plugins, nil
+}
+
+func newTestCache(t *testing.T, now *time.Time) (*MarketplaceCache, *[]string) {
+	t.Helper()
+	var logs []string
+	return &MarketplaceCache{
+		Dir: t.TempDir(),
+		TTL: time.Hour,
+		Logf: func(format string, args ...interface{}) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
+		now: func() time.Time { return *now },
+	}, &logs
+}
+
+func TestMarketplaceCache_MissThenHit(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache, logs := newTestCache(t, &now)
+	src := &countingSource{plugins: map[string]*MarketplacePlugin{
+		"com.mattermost.confluence": {Version: "1.4.0", HomepageURL: "https://github.com/mattermost/mattermost-plugin-confluence"},
+	}}
+	cached := cache.Wrap(src, "https://chat.example.com", "10.5.0", "", "")
+
+	if _, err := cached.GetMarketplacePlugins(context.Background()); err != nil {
+		t.Fatalf("first fetch returned error: %v", err)
+	}
+	now = now.Add(30 * time.Minute)
+	plugins, err := cached.GetMarketplacePlugins(context.Background())
+	if err != nil {
+		t.Fatalf("second fetch returned error: %v", err)
+	}
+
+	if src.calls != 1 {
+		t.Errorf("expected 1 live fetch, got %d", src.calls)
+	}
+	if plugins["com.mattermost.confluence"] == nil || plugins["com.mattermost.confluence"].Version != "1.4.0" {
+		t.Errorf("unexpected cached catalogue: %v", plugins)
+	}
+	if !strings.Contains((*logs)[0], "Cache miss") || !strings.Contains((*logs)[len(*logs)-1], "Cache hit") {
+		t.Errorf("expected miss then hit to be logged, got %v", *logs)
+	}
+}
+
+func TestMarketplaceCache_Keys(t *testing.T) {
+	tests := []struct {
+		name       string
+		first      [4]string // Server, server version, Marketplace URL, platform
+		second     [4]string
+		wantCalls  int
+		wantCached bool
+	}{
+		{"same key", [4]string{"https://a.example.com", "10.5.0", "", ""}, [4]string{"https://a.example.com", "10.5.0", "", ""}, 1, true},
+		{"server version", [4]string{"https://a.example.com", "10.5.0", "", ""}, [4]string{"https://a.example.com", "9.11.2", "", ""}, 2, true},
+		{"proxy of another server", [4]string{"https://a.example.com", "10.5.0", "", ""}, [4]string{"https://b.example.com", "10.5.0", "", ""}, 2, true},
+		{"proxy server spelling", [4]string{"https://a.example.com", "10.5.0", "", ""}, [4]string{"https://A.example.com/", "10.5.0", "", ""}, 1, true},
+		{"proxy without a server", [4]string{"", "10.5.0", "", ""}, [4]string{"", "10.5.0", "", ""}, 2, false},
+		{"proxy and direct", [4]string{"https://a.example.com", "10.5.0", "", ""}, [4]string{"https://a.example.com", "10.5.0", "https://api.integrations.mattermost.com", "linux-amd64"}, 2, true},
+		{"direct ignores server", [4]string{"https://a.example.com", "10.5.0", "https://marketplace.internal", "linux-amd64"}, [4]string{"https://b.example.com", "10.5.0", "https://marketplace.internal", "linux-amd64"}, 1, true},
+		{"Marketplace URL", [4]string{"", "10.5.0", "https://api.integrations.mattermost.com", "linux-amd64"}, [4]string{"", "10.5.0", "https://marketplace.internal", "linux-amd64"}, 2, true},
+		{"trailing slash", [4]string{"", "10.5.0", "https://marketplace.internal", "linux-amd64"}, [4]string{"", "10.5.0", "https://marketplace.internal/", "linux-amd64"}, 1, true},
+		{"platform", [4]string{"", "10.5.0", "https://marketplace.internal", "linux-amd64"}, [4]string{"", "10.5.0", "https://marketplace.internal", "linux-arm64"}, 2, true},
+		{"unknown version", [4]string{"https://a.example.com", "", "", ""}, [4]string{"https://a.example.com", "", "", ""}, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			cache, _ := newTestCache(t, &now)
+			src := &countingSource{plugins: map[string]*MarketplacePlugin{}}
+
+			cache.Wrap(src, tt.first[0], tt.first[1], tt.first[2], tt.first[3]).GetMarketplacePlugins(context.Background())
+			cache.Wrap(src, tt.second[0], tt.second[1], tt.second[2], tt.second[3]).GetMarketplacePlugins(context.Background())
+
+			if src.calls != tt.wantCalls {
+				t.Errorf("expected %d live fetch(es), got %d", tt.wantCalls, src.calls)
+			}
+			files, _ := os.ReadDir(cache.Dir)
+			if cached := len(files) > 0; cached != tt.wantCached {
+				t.Errorf("cache files written = %v, want %v", cached, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestMarketplaceCache_Expired(t *testing.T) {
+	now := time.Now()
+	cache, logs := newTestCache(t, &now)
+	src := &countingSource{plugins: map[string]*MarketplacePlugin{}}
+	cached := cache.Wrap(src, "https://chat.example.com", "10.5.0", "", "")
+
+	cached.GetMarketplacePlugins(context.Background())
+	now = now.Add(2 * time.Hour)
+	cached.GetMarketplacePlugins(context.Background())
+
+	if src.calls != 2 {
+		t.Errorf("expected expired entry to be re-fetched, got %d fetches", src.calls)
+	}
+	if !strings.Contains(strings.Join(*logs, "\n"), "Cache expired") {
+		t.Errorf("expected expiry to be logged, got %v", *logs)
+	}
+}
+
+func TestMarketplaceCache_Refresh(t *testing.T) {
+	now := time.Now()
+	cache, _ := newTestCache(t, &now)
+	src := &countingSource{plugins: map[string]*MarketplacePlugin{}}
+
+	cache.Wrap(src, "https://chat.example.com", "10.5.0", "", "").GetMarketplacePlugins(context.Background())
+	cache.Refresh = true
+	cache.Wrap(src, "https://chat.example.com", "10.5.0", "", "").GetMarketplacePlugins(context.Background())
+
+	if src.calls != 2 {
+		t.Errorf("expected --refresh-cache to force a fetch, got %d fetches", src.calls)
+	}
+}
+
+func TestMarketplaceCache_StaleFallback(t *testing.T) {
+	var stderr bytes.Buffer
+	origOutput := logOutput
+	logOutput = &stderr
+	defer func() { logOutput = origOutput }()
+
+	now := time.Now()
+	cache, _ := newTestCache(t, &now)
+	src := &countingSource{plugins: map[string]*MarketplacePlugin{
+		"com.mattermost.welcomebot": {Version: "1.2.0"},
+	}}
+	cached := cache.Wrap(src, "https://chat.example.com", "10.5.0", "", "")
+	cached.GetMarketplacePlugins(context.Background())
+
+	now = now.Add(48 * time.Hour)
+	src.err = marketplaceError("error: Marketplace unreachable.", nil)
+	plugins, err := cached.GetMarketplacePlugins(context.Background())
+	if err != nil {
+		t.Fatalf("expected stale cache fallback, got error: %v", err)
+	}
+	if plugins["com.mattermost.welcomebot"] == nil {
+		t.Error("expected stale catalogue to be returned")
+	}
+	if !strings.Contains(stderr.String(), "warning: Marketplace fetch failed") {
+		t.Errorf("expected stale-cache warning, got %q", stderr.String())
+	}
+}
+
+func TestMarketplaceCache_FailureWithoutCache(t *testing.T) {
+	now := time.Now()
+	cache, _ := newTestCache(t, &now)
+	src := &countingSource{err: marketplaceError("error: Marketplace unreachable.", nil)}
+
+	_, err := cache.Wrap(src, "https://chat.example.com", "10.5.0", "", "").GetMarketplacePlugins(context.Background())
+	if err == nil {
+		t.Fatal("expected error when fetch fails and nothing is cached")
+	}
+}
+
+func TestMarketplaceCache_CorruptFile(t *testing.T) {
+	now := time.Now()
+	cache, _ := newTestCache(t, &now)
+	if err := os.WriteFile(cache.path("10.5.0", "server proxy", ""), []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := &countingSource{plugins: map[string]*MarketplacePlugin{}}
+
+	if _, err := cache.Wrap(src, "https://chat.example.com", "10.5.0", "", "").GetMarketplacePlugins(context.Background()); err != nil {
+		t.Fatalf("expected corrupt cache to be ignored, got error: %v", err)
+	}
+	if src.calls != 1 {
+		t.Errorf("expected a live fetch, got %d", src.calls)
+	}
+}
+
+func TestMarketplaceCache_Path(t *testing.T) {
+	cache := &MarketplaceCache{Dir: "/cache"}
+	if got := cache.path("10.5.0", "server proxy", ""); !strings.HasPrefix(got, "/cache/marketplace-10.5.0-") || !strings.HasSuffix(got, ".json") {
+		t.Errorf("path() = %q", got)
+	}
+	if got := cache.path("../../etc/passwd", "server proxy", ""); !strings.HasPrefix(got, "/cache/marketplace-.._.._etc_passwd-") {
+		t.Errorf("path() = %q, want the version sanitised", got)
+	}
+}
@@ -2,42 +2,71 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
+	"syscall"
 
 	"github.com/mattermost/mattermost/server/public/model"
 )
 
 // MattermostClient defines the interface for interacting with the Mattermost API.
 type MattermostClient interface {
-	GetPlugins() ([]InstalledPlugin, error)
-	GetMarketplacePlugins() (map[string]*MarketplacePlugin, error)
+	MarketplaceSource
+	GetPlugins(ctx context.Context) ([]InstalledPlugin, error)
+	GetServerVersion(ctx context.Context) (string, error)
 }
 
 // MMClient wraps model.Client4 and implements MattermostClient.
 type MMClient struct {
-	client *model.Client4
+	client        *model.Client4
+	serverVersion string
 }
 
 // ClientConfig holds the configuration for connecting to a Mattermost instance.
 type ClientConfig struct {
-	URL      string
-	Token    string
-	Username string
-	Password string
+	URL        string
+	Token      string
+	Username   string
+	Password   string
+	SocketPath string // Connect in local mode over this Unix socket, without authentication
+	HTTP       HTTPConfig
+	Logf       func(string, ...interface{})
 }
 
+// DefaultSocketPath is where Mattermost listens in local mode unless
+// ServiceSettings.LocalModeSocketLocation says otherwise.
+const DefaultSocketPath = "/var/tmp/mattermost_local.socket"
+
+// localModeURL is the base URL for requests over the local-mode socket; the
+// host is ignored.
+const localModeURL = "http://_"
+
 // NewMMClient creates a new Mattermost client and authenticates.
-func NewMMClient(cfg ClientConfig) (*MMClient, error) {
+func NewMMClient(ctx context.Context, cfg ClientConfig) (*MMClient, error) {
+	logf := cfg.Logf
+	if logf == nil {
+		logf = verboseLogger(false)
+	}
+	if cfg.SocketPath != "" {
+		return newLocalClient(ctx, cfg, logf)
+	}
+
 	serverURL := strings.TrimRight(cfg.URL, "/")
 	client := model.NewAPIv4Client(serverURL)
+	httpClient, err := newHTTPClient(cfg.HTTP, logf)
+	if err != nil {
+		return nil, err
+	}
+	client.HTTPClient = httpClient
 
 	if cfg.Token != "" {
 		client.SetToken(cfg.Token)
 
 		// Validate the token by making a test call
-		_, resp, err := client.GetPlugins(context.Background())
+		_, resp, err := client.GetPlugins(ctx)
 		if err != nil {
 			return nil, classifyAPIError(serverURL, resp, err)
 		}
@@ -46,7 +75,7 @@ func NewMMClient(cfg ClientConfig) (*MMClient, error) {
 	}
 
 	if cfg.Username != "" {
-		user, resp, err := client.Login(context.Background(), cfg.Username, cfg.Password)
+		user, resp, err := client.Login(ctx, cfg.Username, cfg.Password)
 		if err != nil {
 			return nil, classifyAPIError(serverURL, resp, err)
 		}
@@ -60,9 +89,78 @@ func NewMMClient(cfg ClientConfig) (*MMClient, error) {
 	)
 }
 
+// newLocalClient connects over the local-mode Unix socket, which the server
+// only opens when ServiceSettings.EnableLocalMode is set and which needs no
+// authentication.
+func newLocalClient(ctx context.Context, cfg ClientConfig, logf func(string, ...interface{})) (*MMClient, error) {
+	info, err := os.Stat(cfg.SocketPath)
+	if err != nil {
+		return nil, classifyLocalError(cfg.SocketPath, nil, err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return nil, configError(fmt.Sprintf("error: %s is not a Unix socket. Check --socket-path.", cfg.SocketPath), nil)
+	}
+
+	httpCfg := cfg.HTTP
+	httpCfg.SocketPath = cfg.SocketPath
+	httpClient, err := newHTTPClient(httpCfg, logf)
+	if err != nil {
+		return nil, err
+	}
+	client := model.NewAPIv4Client(localModeURL)
+	client.HTTPClient = httpClient
+
+	// Check the socket answers before auditing
+	_, resp, err := client.GetPlugins(ctx)
+	if err != nil {
+		return nil, classifyLocalError(cfg.SocketPath, resp, err)
+	}
+	return &MMClient{client: client}, nil
+}
+
+// classifyLocalError maps failures to reach the local-mode socket to
+// CLIErrors that explain how to enable or reach it.
+func classifyLocalError(socketPath string, resp *model.Response, err error) *CLIError {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return configError(fmt.Sprintf(
+			"error: local mode socket %s not found. Enable local mode on the server (ServiceSettings.EnableLocalMode), or set --socket-path to its LocalModeSocketLocation.",
+			socketPath), err)
+	case errors.Is(err, os.ErrPermission):
+		return configError(fmt.Sprintf(
+			"error: permission denied on local mode socket %s. Run as the user that runs Mattermost, or as root.",
+			socketPath), err)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return apiError(fmt.Sprintf(
+			"error: nothing is listening on local mode socket %s. The Mattermost server may be stopped, or local mode disabled.",
+			socketPath), err)
+	}
+	return classifyAPIError("local mode socket "+socketPath, resp, err)
+}
+
+// GetConfig retrieves the server configuration, which needs the
+// manage_system permission (or local mode). Secrets come back redacted.
+func (c *MMClient) GetConfig(ctx context.Context) (*model.Config, error) {
+	cfg, resp, err := c.client.GetConfig(ctx)
+	if err != nil {
+		return nil, classifyAPIError("", resp, err)
+	}
+	return cfg, nil
+}
+
+// SiteURL returns the server's configured Site URL, or "" if it is unset or
+// the configuration cannot be read.
+func (c *MMClient) SiteURL(ctx context.Context) string {
+	cfg, err := c.GetConfig(ctx)
+	if err != nil || cfg.ServiceSettings.SiteURL == nil {
+		return ""
+	}
+	return strings.TrimRight(*cfg.ServiceSettings.SiteURL, "/")
+}
+
 // GetPlugins retrieves all installed plugins from the Mattermost instance.
-func (c *MMClient) GetPlugins() ([]InstalledPlugin, error) {
-	pluginsResp, resp, err := c.client.GetPlugins(context.Background())
+func (c *MMClient) GetPlugins(ctx context.Context) ([]InstalledPlugin, error) {
+	pluginsResp, resp, err := c.client.GetPlugins(ctx)
 	if err != nil {
 		return nil, classifyAPIError("", resp, err)
 	}
@@ -71,43 +169,74 @@ func (c *MMClient) GetPlugins() ([]InstalledPlugin, error) {
 
 	for _, p := range pluginsResp.Active {
 		plugins = append(plugins, InstalledPlugin{
-			ID:          p.Id,
-			Name:        p.Name,
-			Version:     p.Version,
-			HomepageURL: p.HomepageURL,
-			Status:      "enabled",
-			HasServer:   p.Server != nil,
-			HasWebapp:   p.Webapp != nil,
+			ID:              p.Id,
+			Name:            p.Name,
+			Version:         p.Version,
+			HomepageURL:     p.HomepageURL,
+			ReleaseNotesURL: p.ReleaseNotesURL,
+			Status:          "enabled",
+			HasServer:       p.Server != nil,
+			HasWebapp:       p.Webapp != nil,
+			Settings:        manifestSettings(&p.Manifest),
 		})
 	}
 
 	for _, p := range pluginsResp.Inactive {
 		plugins = append(plugins, InstalledPlugin{
-			ID:          p.Id,
-			Name:        p.Name,
-			Version:     p.Version,
-			HomepageURL: p.HomepageURL,
-			Status:      "disabled",
-			HasServer:   p.Server != nil,
-			HasWebapp:   p.Webapp != nil,
+			ID:              p.Id,
+			Name:            p.Name,
+			Version:         p.Version,
+			HomepageURL:     p.HomepageURL,
+			ReleaseNotesURL: p.ReleaseNotesURL,
+			Status:          "disabled",
+			HasServer:       p.Server != nil,
+			HasWebapp:       p.Webapp != nil,
+			Settings:        manifestSettings(&p.Manifest),
 		})
 	}
 
 	return plugins, nil
 }
 
+// GetServerVersion returns the Mattermost server version (e.g. "10.5.1"), taken
+// from the X-Version-Id header of a ping.
+func (c *MMClient) GetServerVersion(ctx context.Context) (string, error) {
+	if c.serverVersion != "" {
+		return c.serverVersion, nil
+	}
+	_, resp, err := c.client.GetPing(ctx)
+	if err != nil {
+		return "", classifyAPIError("", resp, err)
+	}
+	c.serverVersion = parseServerVersion(resp.ServerVersion)
+	return c.serverVersion, nil
+}
+
+// parseServerVersion extracts the release version from an X-Version-Id header,
+// which has the form "<version>.<build number>.<hash>.<enterprise>".
+func parseServerVersion(header string) string {
+	parts := strings.SplitN(header, ".", 4)
+	if len(parts) < 3 {
+		return header
+	}
+	return strings.Join(parts[:3], ".")
+}
+
 // GetMarketplacePlugins fetches the Marketplace catalogue via the server's proxy endpoint.
-func (c *MMClient) GetMarketplacePlugins() (map[string]*MarketplacePlugin, error) {
+func (c *MMClient) GetMarketplacePlugins(ctx context.Context) (map[string]*MarketplacePlugin, error) {
 	result := make(map[string]*MarketplacePlugin)
 
 	page := 0
 	perPage := 200
 	for {
+		if err := ctx.Err(); err != nil {
+			return nil, classifyAPIError("", nil, err)
+		}
 		filter := &model.MarketplacePluginFilter{
 			Page:    page,
 			PerPage: perPage,
 		}
-		plugins, resp, err := c.client.GetMarketplacePlugins(context.Background(), filter)
+		plugins, resp, err := c.client.GetMarketplacePlugins(ctx, filter)
 		if err != nil {
 			return nil, classifyAPIError("", resp, err)
 		}
@@ -115,8 +244,9 @@ func (c *MMClient) GetMarketplacePlugins() (map[string]*MarketplacePlugin, error
 		for _, p := range plugins {
 			if p.Manifest != nil {
 				result[p.Manifest.Id] = &MarketplacePlugin{
-					Version:     p.Manifest.Version,
-					HomepageURL: p.HomepageURL,
+					Version:         p.Manifest.Version,
+					HomepageURL:     p.HomepageURL,
+					ReleaseNotesURL: p.ReleaseNotesURL,
 				}
 			}
 		}
@@ -132,6 +262,13 @@ func (c *MMClient) GetMarketplacePlugins() (map[string]*MarketplacePlugin, error
 
 // classifyAPIError maps Mattermost API errors to appropriate CLIError types.
 func classifyAPIError(serverURL string, resp *model.Response, err error) *CLIError {
+	if errors.Is(err, context.Canceled) {
+		return cancelledError(err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return apiError("error: timed out waiting for the Mattermost server. Increase --timeout or --overall-timeout.", err)
+	}
+
 	if resp != nil {
 		switch resp.StatusCode {
 		case http.StatusUnauthorized:
@@ -154,3 +291,29 @@ func classifyAPIError(serverURL string, resp *model.Response, err error) *CLIErr
 	}
 	return apiError("error: unexpected API error.", err)
 }
+
+// marketplaceOverride substitutes the Marketplace catalogue of a MattermostClient.
+type marketplaceOverride struct {
+	MattermostClient
+	source MarketplaceSource
+}
+
+// withMarketplace returns a client that fetches installed plugins from client and
+// the Marketplace catalogue from source.
+func withMarketplace(client MattermostClient, source MarketplaceSource) MattermostClient {
+	return &marketplaceOverride{MattermostClient: client, source: source}
+}
+
+func (m *marketplaceOverride) GetMarketplacePlugins(ctx context.Context) (map[string]*MarketplacePlugin, error) {
+	return m.source.GetMarketplacePlugins(ctx)
+}
+
+// GetConfig forwards to the wrapped client, so overriding the Marketplace
+// doesn't hide the server configuration from --audit-settings.
+func (m *marketplaceOverride) GetConfig(ctx context.Context) (*model.Config, error) {
+	source, ok := m.MattermostClient.(ConfigSource)
+	if !ok {
+		return nil, errNoConfig()
+	}
+	return source.GetConfig(ctx)
+}
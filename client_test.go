@@ -1,6 +1,13 @@
 package main
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/mattermost/mattermost/server/public/model"
@@ -57,3 +64,152 @@ func TestClassifyAPIError_NoServerURL(t *testing.T) {
 		t.Errorf("unexpected message: %s", err.Message)
 	}
 }
+
+func TestClassifyAPIError_Timeout(t *testing.T) {
+	err := classifyAPIError("https://mm.example.com", nil, context.DeadlineExceeded)
+	if err.Code != ExitAPIError {
+		t.Errorf("expected exit code %d for timeout, got %d", ExitAPIError, err.Code)
+	}
+	if !strings.Contains(err.Message, "timed out") {
+		t.Errorf("unexpected message: %s", err.Message)
+	}
+}
+
+func TestClassifyAPIError_Cancelled(t *testing.T) {
+	err := classifyAPIError("https://mm.example.com", nil, context.Canceled)
+	if err.Code != ExitInterrupted {
+		t.Errorf("expected exit code %d for cancellation, got %d", ExitInterrupted, err.Code)
+	}
+}
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		header string
+		expect string
+	}{
+		{"10.5.1.10.5.1.abc123.true", "10.5.1"},
+		{"9.11.0.12345.deadbeef.false", "9.11.0"},
+		{"10.5", "10.5"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseServerVersion(tt.header); got != tt.expect {
+			t.Errorf("parseServerVersion(%q) = %q, want %q", tt.header, got, tt.expect)
+		}
+	}
+}
+
+func TestWithMarketplace(t *testing.T) {
+	mm := &mockMMClient{
+		mpPlugins: map[string]*MarketplacePlugin{"proxy": {Version: "1.0.0"}},
+	}
+	src := &countingSource{plugins: map[string]*MarketplacePlugin{"direct": {Version: "2.0.0"}}}
+
+	plugins, err := withMarketplace(mm, src).GetMarketplacePlugins(context.Background())
+	if err != nil {
+		t.Fatalf("GetMarketplacePlugins() returned error: %v", err)
+	}
+	if _, ok := plugins["direct"]; !ok || len(plugins) != 1 {
+		t.Errorf("expected catalogue from override source, got %v", plugins)
+	}
+}
+
+// listenLocal serves handler on a Unix socket in a temporary directory and
+// returns the socket path. Socket paths are limited to about 100 bytes, so
+// t.TempDir's long names are avoided.
+func listenLocal(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "mmsock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "local.socket")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return path
+}
+
+func TestNewMMClient_Local(t *testing.T) {
+	var authHeaders []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/plugins", func(w http.ResponseWriter, r *http.Request) {
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"active": [{"id": "com.mattermost.calls", "name": "Calls", "version": "1.0.0"}], "inactive": []}`))
+	})
+	mux.HandleFunc("/api/v4/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ServiceSettings": {"SiteURL": "https://chat.example.com/"}}`))
+	})
+	socket := listenLocal(t, mux)
+
+	client, err := NewMMClient(context.Background(), ClientConfig{SocketPath: socket, Token: "ignored"})
+	if err != nil {
+		t.Fatalf("NewMMClient() returned error: %v", err)
+	}
+	plugins, err := client.GetPlugins(context.Background())
+	if err != nil || len(plugins) != 1 || plugins[0].ID != "com.mattermost.calls" {
+		t.Errorf("GetPlugins() = %+v, %v", plugins, err)
+	}
+	if got := client.SiteURL(context.Background()); got != "https://chat.example.com" {
+		t.Errorf("SiteURL() = %q, want https://chat.example.com", got)
+	}
+	for _, h := range authHeaders {
+		if h != "" {
+			t.Errorf("expected no authentication in local mode, got %q", h)
+		}
+	}
+}
+
+func TestNewMMClient_LocalErrors(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mmsock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	regular := filepath.Join(dir, "regular")
+	os.WriteFile(regular, nil, 0o600)
+
+	// A socket file nobody is listening on refuses connections
+	stale := filepath.Join(dir, "stale.socket")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: stale, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.SetUnlinkOnClose(false)
+	ln.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantMsg  string
+	}{
+		{"missing", filepath.Join(dir, "missing.socket"), ExitConfigError, "EnableLocalMode"},
+		{"not a socket", regular, ExitConfigError, "is not a Unix socket"},
+		{"refused", stale, ExitAPIError, "nothing is listening"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMMClient(context.Background(), ClientConfig{SocketPath: tt.path, HTTP: HTTPConfig{Retries: 0}})
+			cliErr, ok := err.(*CLIError)
+			if !ok || cliErr.Code != tt.wantCode || !strings.Contains(cliErr.Message, tt.wantMsg) {
+				t.Errorf("expected exit code %d with %q, got %v", tt.wantCode, tt.wantMsg, err)
+			}
+		})
+	}
+}
+
+func TestClassifyLocalError_PermissionDenied(t *testing.T) {
+	err := classifyLocalError("/var/tmp/mattermost_local.socket", nil,
+		&net.OpError{Op: "dial", Net: "unix", Err: os.NewSyscallError("connect", syscall.EACCES)})
+	if err.Code != ExitConfigError || !strings.Contains(err.Message, "permission denied") {
+		t.Errorf("unexpected error: %d %s", err.Code, err.Message)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CMDB configuration item classes, in the u_ci_class column.
+const (
+	CMDBClassServer = "mattermost_server"
+	CMDBClassPlugin = "mattermost_plugin"
+)
+
+// CMDB operations, in the u_operation column.
+const (
+	CMDBUpsert = "upsert" // Insert or update the CI matching u_ci_id
+	CMDBDelete = "delete" // The CI is gone; retire it
+)
+
+// Changes since the last sync, in the u_change column of incremental records.
+const (
+	CMDBAdded      = "added"
+	CMDBUpgraded   = "upgraded"
+	CMDBDowngraded = "downgraded"
+	CMDBChanged    = "changed" // Status, latest version or other details changed
+	CMDBRemoved    = "removed"
+)
+
+// cmdbRelationship relates each plugin to its server: the plugin "Runs on"
+// the server, in ServiceNow's relationship type naming.
+const cmdbRelationship = "Runs on::Runs"
+
+// cmdbBatchSize is the number of records sent per request.
+const cmdbBatchSize = 100
+
+// cmdbStateVersion is bumped when the state file format changes.
+const cmdbStateVersion = 1
+
+// cmdbTimeLayout is the date-time format ServiceNow imports by default.
+const cmdbTimeLayout = "2006-01-02 15:04:05"
+
+// CMDBRecord is one row of a ServiceNow import set: the server or a plugin
+// as a configuration item. Columns are u_-prefixed, as ServiceNow names the
+// columns of staging tables, and every row has every column.
+type CMDBRecord struct {
+	CIID            string `json:"u_ci_id"`
+	Class           string `json:"u_ci_class"`
+	Name            string `json:"u_name"`
+	PluginID        string `json:"u_plugin_id"`
+	Version         string `json:"u_version"`
+	LatestVersion   string `json:"u_latest_version"`
+	UpdateState     string `json:"u_update_state"`
+	Status          string `json:"u_status"`
+	Source          string `json:"u_source"`
+	PluginType      string `json:"u_plugin_type"`
+	URL             string `json:"u_url"`
+	ParentCIID      string `json:"u_parent_ci_id"` // The server CI, for plugins
+	Relationship    string `json:"u_relationship"` // Of the plugin to its parent
+	Operation       string `json:"u_operation"`    // CMDBUpsert or CMDBDelete
+	Change          string `json:"u_change"`       // Since the last sync; empty in full exports
+	PreviousVersion string `json:"u_previous_version"`
+	LastDiscovered  string `json:"u_last_discovered"` // When the audit ran, UTC
+}
+
+// cmdbImportSet is the body of a ServiceNow import set API insertMultiple
+// request, also written by --format cmdb.
+type cmdbImportSet struct {
+	Records []CMDBRecord `json:"records"`
+}
+
+// errNoCMDBServer reports that CIs can't be identified without a server URL.
+func errNoCMDBServer() error {
+	return configError("error: the CMDB export identifies configuration items by server URL. Use --url, even with --local or --from-support-packet.", nil)
+}
+
+// cmdbServerKey normalises a server URL so that equivalent spellings give
+// the same CI IDs.
+func cmdbServerKey(serverURL string) string {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(strings.TrimRight(serverURL, "/"))
+	}
+	return strings.ToLower(u.Scheme+"://"+u.Host) + strings.TrimRight(u.Path, "/")
+}
+
+// cmdbCIID returns a stable CI ID: prefix and a hash of the parts.
+func cmdbCIID(prefix string, parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return prefix + "-" + hex.EncodeToString(sum[:8])
+}
+
+// CMDBRecords returns the server and every installed plugin as CIs, ignoring
+// filters, which would otherwise register hidden plugins as removed. Plugins
+// are in plugin ID order.
+func CMDBRecords(result *AuditResult) ([]CMDBRecord, error) {
+	if result.Server == nil || result.Server.URL == "" {
+		return nil, errNoCMDBServer()
+	}
+	key := cmdbServerKey(result.Server.URL)
+	discovered := result.Server.AuditedAt.UTC().Format(cmdbTimeLayout)
+	server := CMDBRecord{
+		CIID:           cmdbCIID("mm-server", key),
+		Class:          CMDBClassServer,
+		Name:           result.Server.Host(),
+		Version:        result.Server.Version,
+		URL:            result.Server.URL,
+		Operation:      CMDBUpsert,
+		LastDiscovered: discovered,
+	}
+
+	plugins := result.Installed
+	if plugins == nil {
+		plugins = result.Plugins
+	}
+	var cis []CMDBRecord
+	for _, p := range plugins {
+		cis = append(cis, CMDBRecord{
+			CIID:           cmdbCIID("mm-plugin", key, strings.ToLower(p.PluginID)),
+			Class:          CMDBClassPlugin,
+			Name:           p.Name,
+			PluginID:       p.PluginID,
+			Version:        p.InstalledVersion,
+			LatestVersion:  p.LatestVersion,
+			UpdateState:    p.UpdateState,
+			Status:         p.Status,
+			Source:         p.Source,
+			PluginType:     p.PluginType,
+			URL:            p.HomepageURL,
+			ParentCIID:     server.CIID,
+			Relationship:   cmdbRelationship,
+			Operation:      CMDBUpsert,
+			LastDiscovered: discovered,
+		})
+	}
+	sort.Slice(cis, func(i, j int) bool { return cis[i].PluginID < cis[j].PluginID })
+	return append([]CMDBRecord{server}, cis...), nil
+}
+
+// formatCMDB writes the full inventory as an import set.
+func formatCMDB(w io.Writer, result *AuditResult) error {
+	records, err := CMDBRecords(result)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(cmdbImportSet{Records: records})
+}
+
+// inventory returns r without the per-sync columns, for comparing and
+// storing.
+func (r CMDBRecord) inventory() CMDBRecord {
+	r.Operation, r.Change, r.PreviousVersion, r.LastDiscovered = "", "", "", ""
+	return r
+}
+
+// cmdbChanges returns the records to send: those added or changed since
+// previous (or every record, if full), then a delete for each CI in previous
+// that is gone.
+func cmdbChanges(previous map[string]CMDBRecord, current []CMDBRecord, full bool) []CMDBRecord {
+	var changes []CMDBRecord
+	seen := make(map[string]bool)
+	for _, r := range current {
+		seen[r.CIID] = true
+		prev, ok := previous[r.CIID]
+		switch {
+		case !ok:
+			r.Change = CMDBAdded
+		case prev.Version != r.Version:
+			r.PreviousVersion = prev.Version
+			r.Change = CMDBChanged
+			if cmp, ok := CompareVersions(r.Version, prev.Version); ok && cmp > 0 {
+				r.Change = CMDBUpgraded
+			} else if ok && cmp < 0 {
+				r.Change = CMDBDowngraded
+			}
+		case prev != r.inventory():
+			r.Change = CMDBChanged
+		case !full:
+			continue
+		}
+		changes = append(changes, r)
+	}
+
+	var gone []string
+	for id := range previous {
+		if !seen[id] {
+			gone = append(gone, id)
+		}
+	}
+	sort.Strings(gone)
+	discovered := ""
+	if len(current) > 0 {
+		discovered = current[0].LastDiscovered
+	}
+	for _, id := range gone {
+		r := previous[id]
+		r.Operation, r.Change, r.LastDiscovered = CMDBDelete, CMDBRemoved, discovered
+		changes = append(changes, r)
+	}
+	return changes
+}
+
+// cmdbState is the state file recording the inventory last sent to the CMDB.
+type cmdbState struct {
+	Version  int          `json:"version"`
+	ServerCI string       `json:"server_ci_id"`
+	SyncedAt time.Time    `json:"synced_at"`
+	Records  []CMDBRecord `json:"records"`
+}
+
+// loadCMDBState returns the CIs last sent for serverCI by ID, or an empty
+// map if there are none yet.
+func loadCMDBState(path, serverCI string) (map[string]CMDBRecord, error) {
+	records := make(map[string]CMDBRecord)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	} else if err != nil {
+		return records, err
+	}
+	var state cmdbState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return records, err
+	}
+	if state.Version != cmdbStateVersion {
+		return records, nil
+	}
+	if state.ServerCI != serverCI {
+		return records, fmt.Errorf("it belongs to another server (%s)", state.ServerCI)
+	}
+	for _, r := range state.Records {
+		records[r.CIID] = r
+	}
+	return records, nil
+}
+
+func saveCMDBState(path, serverCI string, records []CMDBRecord) error {
+	state := cmdbState{Version: cmdbStateVersion, ServerCI: serverCI, SyncedAt: time.Now().UTC()}
+	for _, r := range records {
+		state.Records = append(state.Records, r.inventory())
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// CMDBSync sends the inventory's changes to an import set endpoint.
+type CMDBSync struct {
+	URL       string // e.g. https://INSTANCE.service-now.com/api/now/import/TABLE/insertMultiple
+	Username  string // Basic auth with Password when set
+	Password  string
+	Token     string // Bearer token, when Username is not set
+	StatePath string // The inventory last sent
+	Full      bool   // Send every CI, not just the changes
+	Client    *http.Client
+	Logf      func(string, ...interface{})
+}
+
+// Name returns the endpoint's scheme and host.
+func (s *CMDBSync) Name() string {
+	if u, err := url.Parse(s.URL); err == nil && u.Host != "" {
+		return "CMDB " + u.Scheme + "://" + u.Host
+	}
+	return "CMDB"
+}
+
+func (s *CMDBSync) auth(req *http.Request) {
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	} else if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+}
+
+// Run sends the CIs added, changed or removed since the last successful sync,
+// in batches. The state is saved only once every batch is accepted, so a
+// failed sync is retried in full on the next run; the endpoint must therefore
+// coalesce on u_ci_id.
+func (s *CMDBSync) Run(ctx context.Context, result *AuditResult) error {
+	records, err := CMDBRecords(result)
+	if err != nil {
+		return err
+	}
+	serverCI := records[0].CIID
+	previous, err := loadCMDBState(s.StatePath, serverCI)
+	if err != nil {
+		s.Logf("Ignoring CMDB state %s: %v", s.StatePath, err)
+	}
+	changes := cmdbChanges(previous, records, s.Full)
+	if len(changes) == 0 {
+		s.Logf("%s is up to date; nothing sent", s.Name())
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, r := range changes {
+		counts[r.Change]++
+	}
+	var summary []string
+	for _, c := range []string{CMDBAdded, CMDBUpgraded, CMDBDowngraded, CMDBChanged, CMDBRemoved} {
+		if counts[c] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[c], c))
+		}
+	}
+	if counts[""] > 0 {
+		summary = append(summary, fmt.Sprintf("%d unchanged", counts[""]))
+	}
+	s.Logf("Sending %d CI(s) to %s: %s", len(changes), s.Name(), strings.Join(summary, ", "))
+
+	for start := 0; start < len(changes); start += cmdbBatchSize {
+		batch := changes[start:min(start+cmdbBatchSize, len(changes))]
+		var resp struct {
+			Result []struct {
+				Status       string `json:"status"`
+				ErrorMessage string `json:"error_message"`
+			} `json:"result"`
+		}
+		if err := jsonRequest(ctx, s.Client, http.MethodPost, s.URL, s.auth, cmdbImportSet{Records: batch}, &resp); err != nil {
+			return notifyError(fmt.Sprintf("error: CMDB sync with %s failed: %v", s.Name(), err), err)
+		}
+		// ServiceNow accepts the batch but reports rows its transform rejected
+		for _, row := range resp.Result {
+			if row.Status == "error" {
+				err := errors.New(row.ErrorMessage)
+				return notifyError(fmt.Sprintf("error: CMDB sync with %s failed: a record was rejected: %s", s.Name(), row.ErrorMessage), err)
+			}
+		}
+	}
+
+	if err := saveCMDBState(s.StatePath, serverCI, records); err != nil {
+		s.Logf("Unable to save CMDB state %s: %v", s.StatePath, err)
+	}
+	return nil
+}
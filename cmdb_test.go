@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// cmdbTestResult is the sample result for the server at serverURL, with
+// plugins as its installed and reported plugins.
+func cmdbTestResult(serverURL string, plugins ...PluginReport) *AuditResult {
+	result := sampleResultWithServer()
+	result.Plugins, result.Installed = plugins, plugins
+	result.Server.URL = serverURL
+	return result
+}
+
+func TestCMDBRecords(t *testing.T) {
+	result := cmdbTestResult("https://Chat.Example.com/", outdatedPlugin("zoom", "1.0.0", "1.2.0"), upToDatePlugin("calls", "1.0.0"))
+	result.Plugins = result.Plugins[:1] // Filters don't shrink the inventory
+
+	records, err := CMDBRecords(result)
+	if err != nil {
+		t.Fatalf("CMDBRecords() returned error: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected the server and 2 plugins, got %d records", len(records))
+	}
+	server := records[0]
+	if server.Class != CMDBClassServer || server.Name != "Chat.Example.com" || server.Version != "10.5.0" || server.LastDiscovered != "2025-03-14 09:30:00" {
+		t.Errorf("server record = %+v", server)
+	}
+	if records[1].PluginID != "calls" || records[2].PluginID != "zoom" {
+		t.Errorf("plugins not in ID order: %s, %s", records[1].PluginID, records[2].PluginID)
+	}
+	for _, r := range records[1:] {
+		if r.Class != CMDBClassPlugin || r.ParentCIID != server.CIID || r.Relationship != "Runs on::Runs" || r.Operation != CMDBUpsert {
+			t.Errorf("plugin record = %+v", r)
+		}
+	}
+
+	// CI IDs are stable across spellings of the server URL, and differ between servers
+	same, _ := CMDBRecords(cmdbTestResult("https://chat.example.com", upToDatePlugin("Calls", "1.0.0")))
+	if same[0].CIID != server.CIID || same[1].CIID != records[1].CIID {
+		t.Errorf("CI IDs changed with the URL's spelling: %s/%s vs %s/%s", same[0].CIID, same[1].CIID, server.CIID, records[1].CIID)
+	}
+	other, _ := CMDBRecords(cmdbTestResult("https://other.example.com", upToDatePlugin("calls", "1.0.0")))
+	if other[0].CIID == server.CIID || other[1].CIID == records[1].CIID {
+		t.Error("different servers share CI IDs")
+	}
+
+	_, err = CMDBRecords(cmdbTestResult(""))
+	if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitConfigError {
+		t.Errorf("expected a config error without a server URL, got %v", err)
+	}
+}
+
+func TestFormatCMDB(t *testing.T) {
+	var buf bytes.Buffer
+	if err := FormatOutput(&buf, cmdbTestResult("https://chat.example.com", upToDatePlugin("calls", "1.0.0")), "cmdb"); err != nil {
+		t.Fatalf("FormatOutput() returned error: %v", err)
+	}
+	var set struct {
+		Records []map[string]string `json:"records"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &set); err != nil {
+		t.Fatalf("output is not an import set: %v\n%s", err, buf.String())
+	}
+	if len(set.Records) != 2 || set.Records[1]["u_plugin_id"] != "calls" || set.Records[1]["u_operation"] != "upsert" {
+		t.Errorf("unexpected records: %v", set.Records)
+	}
+	// Every row has every column, as staging tables expect
+	if len(set.Records[0]) != len(set.Records[1]) {
+		t.Errorf("server and plugin rows have different columns: %v", set.Records)
+	}
+}
+
+func TestCMDBChanges(t *testing.T) {
+	base, _ := CMDBRecords(cmdbTestResult("https://chat.example.com",
+		outdatedPlugin("jira", "4.0.0", "4.1.0"), outdatedPlugin("zoom", "1.2.0", "1.3.0"), upToDatePlugin("calls", "1.0.0"), upToDatePlugin("nps", "1.0.0")))
+	previous := make(map[string]CMDBRecord)
+	for _, r := range base {
+		previous[r.CIID] = r.inventory()
+	}
+
+	disabled := upToDatePlugin("calls", "1.0.0")
+	disabled.Status = "disabled"
+	current, _ := CMDBRecords(cmdbTestResult("https://chat.example.com",
+		outdatedPlugin("jira", "4.0.0", "4.1.0"), outdatedPlugin("zoom", "1.0.0", "1.3.0"), disabled, upToDatePlugin("playbooks", "2.0.0")))
+	current[0].Version = "10.6.0"
+
+	tests := []struct {
+		full bool
+		want []string // name:operation:change:previous_version
+	}{
+		{false, []string{
+			"chat.example.com:upsert:upgraded:10.5.0",
+			"calls:upsert:changed:",
+			"playbooks:upsert:added:",
+			"zoom:upsert:downgraded:1.2.0",
+			"nps:delete:removed:",
+		}},
+		{true, []string{
+			"chat.example.com:upsert:upgraded:10.5.0",
+			"calls:upsert:changed:",
+			"jira:upsert::",
+			"playbooks:upsert:added:",
+			"zoom:upsert:downgraded:1.2.0",
+			"nps:delete:removed:",
+		}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range cmdbChanges(previous, current, tt.full) {
+			got = append(got, strings.Join([]string{r.Name, r.Operation, r.Change, r.PreviousVersion}, ":"))
+			if r.LastDiscovered != "2025-03-14 09:30:00" {
+				t.Errorf("%s: last discovered = %q", r.Name, r.LastDiscovered)
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("cmdbChanges(full=%v) = %v, want %v", tt.full, got, tt.want)
+		}
+	}
+}
+
+// importSetReceiver records the records posted to it, rejecting rows for
+// rejectPlugin as a ServiceNow transform would.
+type importSetReceiver struct {
+	mu           sync.Mutex
+	batches      [][]CMDBRecord
+	users        []string
+	rejectPlugin string
+}
+
+func (rc *importSetReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	user, _, _ := r.BasicAuth()
+	rc.users = append(rc.users, user)
+	var set cmdbImportSet
+	if err := json.NewDecoder(r.Body).Decode(&set); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc.batches = append(rc.batches, set.Records)
+	var result []map[string]string
+	for _, rec := range set.Records {
+		if rec.PluginID != "" && rec.PluginID == rc.rejectPlugin {
+			result = append(result, map[string]string{"status": "error", "error_message": "Invalid version"})
+		} else {
+			result = append(result, map[string]string{"status": "inserted"})
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"import_set": "ISET0010001", "result": result})
+}
+
+func (rc *importSetReceiver) sent() int {
+	n := 0
+	for _, b := range rc.batches {
+		n += len(b)
+	}
+	return n
+}
+
+func TestCMDBSync(t *testing.T) {
+	rc := &importSetReceiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	state := filepath.Join(t.TempDir(), "cmdb", "state.json")
+	sync := &CMDBSync{URL: srv.URL, Username: "svc_audit", Password: "pw", StatePath: state, Client: testHTTPClient(t, 0), Logf: noopLogger}
+
+	// 150 plugins go in two batches
+	var plugins []PluginReport
+	for i := 0; i < 150; i++ {
+		plugins = append(plugins, upToDatePlugin(fmt.Sprintf("plugin-%03d", i), "1.0.0"))
+	}
+	if err := sync.Run(context.Background(), cmdbTestResult("https://chat.example.com", plugins...)); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if len(rc.batches) != 2 || len(rc.batches[0]) != cmdbBatchSize || rc.sent() != 151 {
+		t.Fatalf("expected 151 records in 2 batches, got %d batch(es) of %d record(s)", len(rc.batches), rc.sent())
+	}
+	if rc.users[0] != "svc_audit" {
+		t.Errorf("basic auth user = %q", rc.users[0])
+	}
+
+	// Nothing changed, so nothing is sent
+	rc.batches = nil
+	if err := sync.Run(context.Background(), cmdbTestResult("https://chat.example.com", plugins...)); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if len(rc.batches) != 0 {
+		t.Errorf("unchanged inventory sent %d record(s)", rc.sent())
+	}
+
+	// An upgrade and a removal; a rejected row fails the sync and keeps the state
+	plugins[0].InstalledVersion = "1.1.0"
+	rc.rejectPlugin = "plugin-000"
+	err := sync.Run(context.Background(), cmdbTestResult("https://chat.example.com", plugins[:149]...))
+	if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitNotifyError || !strings.Contains(cliErr.Message, "Invalid version") {
+		t.Fatalf("expected a notify error naming the rejection, got %v", err)
+	}
+
+	rc.batches, rc.rejectPlugin = nil, ""
+	if err := sync.Run(context.Background(), cmdbTestResult("https://chat.example.com", plugins[:149]...)); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if len(rc.batches) != 1 || len(rc.batches[0]) != 2 {
+		t.Fatalf("expected the upgrade and removal to be resent, got %v", rc.batches)
+	}
+	if up, gone := rc.batches[0][0], rc.batches[0][1]; up.Change != CMDBUpgraded || up.PreviousVersion != "1.0.0" ||
+		gone.PluginID != "plugin-149" || gone.Operation != CMDBDelete {
+		t.Errorf("unexpected changes: %+v", rc.batches[0])
+	}
+
+	// A state file for another server is ignored rather than deleting its CIs
+	rc.batches = nil
+	if err := sync.Run(context.Background(), cmdbTestResult("https://other.example.com", plugins[0])); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	for _, r := range rc.batches[0] {
+		if r.Operation == CMDBDelete {
+			t.Errorf("deleted %s from another server's state", r.Name)
+		}
+	}
+	if _, err := os.Stat(state); err != nil {
+		t.Errorf("state not saved: %v", err)
+	}
+}
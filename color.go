@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Colour modes for --color.
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+var ansiColors = map[string]string{
+	"bold":    "1",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"gray":    "90",
+}
+
+// colorize wraps s in the ANSI escape for the named colour. Unknown names
+// return s unchanged.
+func colorize(name, s string) string {
+	code, ok := ansiColors[name]
+	if !ok {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+// resolveColor decides whether to emit colour. "auto" colours only a terminal,
+// and only when NO_COLOR is unset (https://no-color.org); "always" and
+// "never" override both.
+func resolveColor(mode string, isTerminal bool, noColor string) (bool, error) {
+	switch strings.ToLower(mode) {
+	case ColorAuto, "":
+		return isTerminal && noColor == "", nil
+	case ColorAlways:
+		return true, nil
+	case ColorNever:
+		return false, nil
+	}
+	return false, configError(fmt.Sprintf("error: invalid --color value %q. Use auto, always, or never.", mode), nil)
+}
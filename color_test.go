@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestResolveColor(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		isTerminal bool
+		noColor    string
+		expect     bool
+	}{
+		{"auto on terminal", "auto", true, "", true},
+		{"auto when piped", "auto", false, "", false},
+		{"auto with NO_COLOR", "auto", true, "1", false},
+		{"always when piped", "always", false, "", true},
+		{"always overrides NO_COLOR", "always", true, "1", true},
+		{"never on terminal", "never", true, "", false},
+		{"mixed case", "ALWAYS", false, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveColor(tt.mode, tt.isTerminal, tt.noColor)
+			if err != nil {
+				t.Fatalf("resolveColor() returned error: %v", err)
+			}
+			if got != tt.expect {
+				t.Errorf("resolveColor(%q, %v, %q) = %v, want %v", tt.mode, tt.isTerminal, tt.noColor, got, tt.expect)
+			}
+		})
+	}
+
+	if _, err := resolveColor("sometimes", true, ""); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
+
+func TestColorize(t *testing.T) {
+	if got := colorize("red", "Confluence"); got != "\x1b[31mConfluence\x1b[0m" {
+		t.Errorf("colorize(red) = %q", got)
+	}
+	if got := colorize("plaid", "Confluence"); got != "Confluence" {
+		t.Errorf("expected unknown colour to leave text unchanged, got %q", got)
+	}
+}
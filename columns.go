@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseColumns parses a comma-separated --columns value into report fields.
+// Any PluginReport field can be selected by its JSON name.
+func ParseColumns(s string) ([]reportField, error) {
+	var columns []reportField
+	for _, name := range splitList(strings.ToLower(s)) {
+		field, ok := lookupReportField(name)
+		if !ok {
+			return nil, configError(fmt.Sprintf("error: unknown column %q. Available columns: %s.",
+				name, strings.Join(reportFieldNames(), ", ")), nil)
+		}
+		columns = append(columns, field)
+	}
+	return columns, nil
+}
+
+// SortKey orders plugins by one report field.
+type SortKey struct {
+	Field      reportField
+	Descending bool
+}
+
+// ParseSortKeys parses a comma-separated --sort value such as "status,-name".
+// A leading "-" sorts that key in descending order.
+func ParseSortKeys(s string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, item := range splitList(strings.ToLower(s)) {
+		key := SortKey{}
+		name := item
+		if strings.HasPrefix(item, "-") {
+			key.Descending = true
+			name = item[1:]
+		} else if strings.HasPrefix(item, "+") {
+			name = item[1:]
+		}
+		field, ok := lookupReportField(name)
+		if !ok {
+			return nil, configError(fmt.Sprintf("error: unknown sort key %q. Available keys: %s.",
+				name, strings.Join(reportFieldNames(), ", ")), nil)
+		}
+		key.Field = field
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sortReports stably sorts reports by keys, comparing numbers numerically,
+// versions as versions and everything else case-insensitively.
+func sortReports(reports []PluginReport, keys []SortKey) {
+	sort.SliceStable(reports, func(i, j int) bool {
+		for _, key := range keys {
+			a := strings.ToLower(key.Field.Value(reports[i]))
+			b := strings.ToLower(key.Field.Value(reports[j]))
+			c := compareOrdered(a, b)
+			if c == 0 {
+				continue
+			}
+			if key.Descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
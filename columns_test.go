@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseColumns(t *testing.T) {
+	columns, err := ParseColumns("plugin_id, Name,releases_behind")
+	if err != nil {
+		t.Fatalf("ParseColumns() returned error: %v", err)
+	}
+	var names []string
+	for _, col := range columns {
+		names = append(names, col.Name)
+	}
+	if strings.Join(names, ",") != "plugin_id,name,releases_behind" {
+		t.Errorf("unexpected columns: %v", names)
+	}
+
+	if columns, err := ParseColumns(""); err != nil || columns != nil {
+		t.Errorf("expected no columns for empty value, got %v, %v", columns, err)
+	}
+
+	_, err = ParseColumns("name,colour")
+	if err == nil {
+		t.Fatal("expected error for unknown column")
+	}
+	if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitConfigError || !strings.Contains(cliErr.Message, "update_state") {
+		t.Errorf("expected config error listing available columns, got %v", err)
+	}
+}
+
+func TestSortReports(t *testing.T) {
+	reports := []PluginReport{
+		{Name: "Calls", Status: "enabled", InstalledVersion: "1.10.0", ReleasesBehind: intPtr(2)},
+		{Name: "boards", Status: "disabled", InstalledVersion: "1.9.0"},
+		{Name: "Apps", Status: "enabled", InstalledVersion: "1.2.0", ReleasesBehind: intPtr(10)},
+		{Name: "Zoom", Status: "disabled", InstalledVersion: "1.10.0"},
+	}
+
+	tests := []struct {
+		sort   string
+		expect string
+	}{
+		{"name", "Apps,boards,Calls,Zoom"},
+		{"-name", "Zoom,Calls,boards,Apps"},
+		{"status,-name", "Zoom,boards,Calls,Apps"},
+		{"installed_version,name", "Apps,boards,Calls,Zoom"},
+		{"-releases_behind", "Apps,Calls,boards,Zoom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			keys, err := ParseSortKeys(tt.sort)
+			if err != nil {
+				t.Fatalf("ParseSortKeys() returned error: %v", err)
+			}
+			sorted := append([]PluginReport(nil), reports...)
+			sortReports(sorted, keys)
+			var names []string
+			for _, r := range sorted {
+				names = append(names, r.Name)
+			}
+			if got := strings.Join(names, ","); got != tt.expect {
+				t.Errorf("sort %q = %s, want %s", tt.sort, got, tt.expect)
+			}
+		})
+	}
+
+	if _, err := ParseSortKeys("-colour"); err == nil {
+		t.Error("expected error for unknown sort key")
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTP connection security modes for --smtp-tls.
+const (
+	SMTPStartTLS = "starttls" // Upgrade a plain connection; fail if the server can't
+	SMTPTLS      = "tls"      // Implicit TLS from the first byte, usually port 465
+	SMTPNone     = "none"     // No encryption, for local relays; authentication is refused
+)
+
+// Email body formats for --email-body.
+const (
+	EmailBodyHTML     = "html"     // HTML, with the Markdown rendering as the plain-text alternative
+	EmailBodyMarkdown = "markdown" // Markdown only, sent as plain text
+)
+
+// DefaultSMTPPort is used when --smtp-host has no port.
+const DefaultSMTPPort = "587"
+
+// attachmentTypes maps each --email-attach format to its file extension and
+// MIME type.
+var attachmentTypes = map[string]struct{ ext, mimeType string }{
+	"csv":    {".csv", "text/csv"},
+	"json":   {".json", "application/json"},
+	"ndjson": {".ndjson", "application/x-ndjson"},
+	"xlsx":   {".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+}
+
+// SMTPConfig is where and how to send email.
+type SMTPConfig struct {
+	Addr      string // host:port
+	Security  string // SMTPStartTLS, SMTPTLS or SMTPNone
+	Username  string // Authenticate with PLAIN when set
+	Password  string
+	Timeout   time.Duration // Bounds the whole conversation; 0 for none
+	TLSConfig *tls.Config   // Overrides the default verification of the server's certificate
+}
+
+// Email sends the audit report as an email with the results attached.
+type Email struct {
+	SMTP        SMTPConfig
+	From        string // An address, optionally with a display name
+	To          []string
+	Subject     string        // Defaults to a summary of the audit
+	Body        string        // EmailBodyHTML or EmailBodyMarkdown
+	Attachments []string      // Formats from attachmentTypes
+	Columns     []reportField // Passed to the attachment formats
+}
+
+// ParseEmailAddresses validates a comma-separated list of addresses,
+// returning the bare addresses.
+func ParseEmailAddresses(flagName, s string) ([]string, error) {
+	list, err := mail.ParseAddressList(s)
+	if err != nil {
+		return nil, configError(fmt.Sprintf("error: invalid address in %s: %v.", flagName, err), err)
+	}
+	addrs := make([]string, len(list))
+	for i, a := range list {
+		addrs[i] = a.Address
+	}
+	return addrs, nil
+}
+
+// ParseSMTPAddr validates --smtp-host, adding the default port if missing.
+func ParseSMTPAddr(s string) (string, error) {
+	if _, _, err := net.SplitHostPort(s); err == nil {
+		return s, nil
+	}
+	if s == "" || strings.ContainsAny(s, "/ ") {
+		return "", configError(fmt.Sprintf("error: invalid SMTP host %q. Use host or host:port.", s), nil)
+	}
+	return net.JoinHostPort(s, DefaultSMTPPort), nil
+}
+
+// ParseEmailAttachments validates a comma-separated --email-attach value.
+func ParseEmailAttachments(s string) ([]string, error) {
+	var formats []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" || f == "none" {
+			continue
+		}
+		if _, ok := attachmentTypes[f]; !ok {
+			return nil, configError(fmt.Sprintf("error: invalid attachment format %q. Use csv, json, ndjson, xlsx, or none.", f), nil)
+		}
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+// buildEmail validates the email flags. The SMTP password comes only from
+// MM_SMTP_PASSWORD, so it never appears in the process list.
+func buildEmail(to, from, subject, body, attach, host, username, security string) (*Email, error) {
+	e := &Email{Subject: subject}
+	var err error
+	if e.To, err = ParseEmailAddresses("--email-to", to); err != nil {
+		return nil, err
+	}
+	if from == "" {
+		return nil, configError("error: --email-to requires a sender. Use --email-from or set MM_EMAIL_FROM.", nil)
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, configError(fmt.Sprintf("error: invalid --email-from address %q: %v.", from, err), err)
+	}
+	e.From = from
+	switch e.Body = strings.ToLower(body); e.Body {
+	case EmailBodyHTML, EmailBodyMarkdown:
+	default:
+		return nil, configError(fmt.Sprintf("error: invalid --email-body %q. Use html or markdown.", body), nil)
+	}
+	if e.Attachments, err = ParseEmailAttachments(attach); err != nil {
+		return nil, err
+	}
+
+	if host == "" {
+		return nil, configError("error: --email-to requires an SMTP server. Use --smtp-host or set MM_SMTP_HOST.", nil)
+	}
+	if e.SMTP.Addr, err = ParseSMTPAddr(host); err != nil {
+		return nil, err
+	}
+	switch e.SMTP.Security = strings.ToLower(security); e.SMTP.Security {
+	case SMTPStartTLS, SMTPTLS:
+	case SMTPNone:
+		if username != "" {
+			return nil, configError("error: --smtp-username needs an encrypted connection. Use --smtp-tls starttls or tls.", nil)
+		}
+	default:
+		return nil, configError(fmt.Sprintf("error: invalid --smtp-tls %q. Use starttls, tls, or none.", security), nil)
+	}
+	if username != "" {
+		e.SMTP.Username = username
+		e.SMTP.Password = os.Getenv("MM_SMTP_PASSWORD")
+		if e.SMTP.Password == "" {
+			return nil, configError("error: --smtp-username requires a password. Set the MM_SMTP_PASSWORD environment variable.", nil)
+		}
+	}
+	return e, nil
+}
+
+// Name returns the recipients.
+func (e *Email) Name() string {
+	return "email to " + strings.Join(e.To, ", ")
+}
+
+// Notify builds the message and delivers it over SMTP.
+func (e *Email) Notify(ctx context.Context, result *AuditResult) error {
+	msg, err := e.buildMessage(result, time.Now())
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, msg)
+}
+
+// send delivers msg to every recipient in one SMTP transaction.
+func (e *Email) send(ctx context.Context, msg []byte) error {
+	host, _, err := net.SplitHostPort(e.SMTP.Addr)
+	if err != nil {
+		return err
+	}
+	tlsConfig := e.SMTP.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: host}
+	}
+
+	if e.SMTP.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.SMTP.Timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.SMTP.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Abandon the conversation if the audit is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if e.SMTP.Security == SMTPTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if e.SMTP.Security == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("the SMTP server does not offer STARTTLS; use --smtp-tls tls or, for a trusted local relay, none")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS: %w", err)
+		}
+	}
+	if e.SMTP.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("the SMTP server does not offer authentication")
+		}
+		if err := c.Auth(smtp.PlainAuth("", e.SMTP.Username, e.SMTP.Password, host)); err != nil {
+			return fmt.Errorf("authentication: %w", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(e.From)
+	if err != nil {
+		return err
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildMessage renders the MIME message: the report body, then one
+// attachment per format.
+func (e *Email) buildMessage(result *AuditResult, now time.Time) ([]byte, error) {
+	markdown, err := renderBuiltinTemplate("markdown", result)
+	if err != nil {
+		return nil, err
+	}
+	var html []byte
+	if e.Body != EmailBodyMarkdown {
+		if html, err = renderBuiltinTemplate("html", result); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	subject := e.Subject
+	if subject == "" {
+		subject = defaultEmailSubject(result)
+	}
+	header := []struct{ key, value string }{
+		{"From", e.From},
+		{"To", strings.Join(e.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", messageID(e.From)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/mixed; boundary=" + mw.Boundary()},
+	}
+	for _, h := range header {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h.key, h.value)
+	}
+	buf.WriteString("\r\n")
+
+	if html == nil {
+		if err := writeTextPart(mw, "text/plain; charset=utf-8", markdown); err != nil {
+			return nil, err
+		}
+	} else {
+		var alt bytes.Buffer
+		aw := multipart.NewWriter(&alt)
+		if err := writeTextPart(aw, "text/plain; charset=utf-8", markdown); err != nil {
+			return nil, err
+		}
+		if err := writeTextPart(aw, "text/html; charset=utf-8", html); err != nil {
+			return nil, err
+		}
+		aw.Close()
+		part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/alternative; boundary=" + aw.Boundary()}})
+		if err != nil {
+			return nil, err
+		}
+		part.Write(alt.Bytes())
+	}
+
+	for _, format := range e.Attachments {
+		var data bytes.Buffer
+		if err := WriteOutput(&data, result, OutputOptions{Format: format, Columns: e.Columns}); err != nil {
+			return nil, fmt.Errorf("rendering %s attachment: %w", format, err)
+		}
+		t := attachmentTypes[format]
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {t.mimeType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachmentName(result, t.ext)})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64Lines(part, data.Bytes())
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func renderBuiltinTemplate(name string, result *AuditResult) ([]byte, error) {
+	tmpl, err := LoadTemplate(name, "")
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := formatTemplate(&buf, result, tmpl, false); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeTextPart(mw *multipart.Writer, contentType string, body []byte) error {
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write(body); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64Lines writes data as base64 in 76-character lines, as MIME
+// requires.
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
+
+// defaultEmailSubject summarises the audit, as the email template does.
+func defaultEmailSubject(result *AuditResult) string {
+	subject := "Mattermost plugin audit"
+	if result.Server != nil && result.Server.URL != "" {
+		subject += " for " + result.Server.URL
+	}
+	return fmt.Sprintf("%s: %d update(s) available", subject, result.Summary.Outdated)
+}
+
+// attachmentName names an attachment after the server and audit date, e.g.
+// plugin-audit-chat.example.com-2025-03-14.csv.
+func attachmentName(result *AuditResult, ext string) string {
+	name := "plugin-audit"
+	if result.Server != nil {
+		if result.Server.URL != "" {
+			name += "-" + strings.Trim(unsafeCacheKey.ReplaceAllString(result.Server.Host(), "_"), "_")
+		}
+		if !result.Server.AuditedAt.IsZero() {
+			name += "-" + result.Server.AuditedAt.Format("2006-01-02")
+		}
+	}
+	return name + ext
+}
+
+// messageID returns a unique Message-ID in the sender's domain.
+func messageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.TrimSuffix(from[at+1:], ">")
+	} else if host, err := os.Hostname(); err == nil {
+		domain = host
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + ".mm-plugin-audit@" + domain + ">"
+}
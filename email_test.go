@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpStandIn is a minimal SMTP server recording what it is sent. It offers
+// STARTTLS (or speaks TLS from the start, with implicit) when tls is set, and
+// AUTH PLAIN only once the connection is encrypted.
+type smtpStandIn struct {
+	tls      *tls.Config
+	implicit bool
+	reject   string // Recipient answered with 550
+
+	mu        sync.Mutex
+	encrypted bool
+	auth      string // Decoded AUTH PLAIN response
+	from      string
+	rcpts     []string
+	data      string
+	done      chan struct{}
+}
+
+func newSMTPStandIn(t *testing.T, s *smtpStandIn) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if s.implicit {
+			conn = tls.Server(conn, s.tls)
+			s.encrypted = true
+		}
+		s.serve(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP stand-in")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		s.mu.Lock()
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-localhost")
+			if s.tls != nil && !s.encrypted {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			if s.encrypted {
+				tp.PrintfLine("250-AUTH PLAIN")
+			}
+			tp.PrintfLine("250 8BITMIME")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			conn = tls.Server(conn, s.tls)
+			tp = textproto.NewConn(conn)
+			s.encrypted = true
+		case "AUTH":
+			resp, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			s.auth = string(resp)
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.from = arg
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			if s.reject != "" && strings.Contains(arg, s.reject) {
+				tp.PrintfLine("550 no such user")
+				break
+			}
+			s.rcpts = append(s.rcpts, arg)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, _ := io.ReadAll(tp.DotReader())
+			s.data = string(data)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+		s.mu.Unlock()
+	}
+}
+
+// testTLSConfigs returns a server certificate and a client config trusting it.
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return &tls.Config{Certificates: srv.TLS.Certificates}, &tls.Config{RootCAs: pool, ServerName: "example.com"}
+}
+
+func emailTestResult() *AuditResult {
+	result := sampleResultWithServer()
+	result.Plugins[0].Name = "Confluence <beta>"
+	return result
+}
+
+// parseEmail returns the message's headers and its leaf parts keyed by
+// Content-Type, with transfer encodings decoded.
+func parseEmail(t *testing.T, raw string) (mail.Header, map[string][]*emailPart) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("message does not parse: %v", err)
+	}
+	parts := make(map[string][]*emailPart)
+	collectParts(t, msg.Header.Get("Content-Type"), msg.Body, parts)
+	return msg.Header, parts
+}
+
+type emailPart struct {
+	header textproto.MIMEHeader
+	body   string
+}
+
+func collectParts(t *testing.T, contentType string, body io.Reader, parts map[string][]*emailPart) {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("bad Content-Type %q: %v", contentType, err)
+	}
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("reading %s part: %v", mediaType, err)
+		}
+		partType := p.Header.Get("Content-Type")
+		if strings.HasPrefix(partType, "multipart/") {
+			collectParts(t, partType, p, parts)
+			continue
+		}
+		var r io.Reader = p
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			r = base64.NewDecoder(base64.StdEncoding, p)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("reading %s part: %v", partType, err)
+		}
+		base, _, _ := mime.ParseMediaType(partType)
+		parts[base] = append(parts[base], &emailPart{p.Header, string(data)})
+	}
+}
+
+func TestEmail_Send(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	tests := []struct {
+		name     string
+		security string
+		implicit bool
+		username string
+	}{
+		{"starttls with auth", SMTPStartTLS, false, "audit@example.com"},
+		{"implicit tls", SMTPTLS, true, ""},
+		{"plain local relay", SMTPNone, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &smtpStandIn{implicit: tt.implicit}
+			if tt.security != SMTPNone {
+				server.tls = serverTLS
+			}
+			addr := newSMTPStandIn(t, server)
+			e := &Email{
+				SMTP:        SMTPConfig{Addr: addr, Security: tt.security, Username: tt.username, Password: "hunter2", Timeout: 5 * time.Second, TLSConfig: clientTLS},
+				From:        "Plugin Audit <audit@example.com>",
+				To:          []string{"ops@example.com", "security@example.com"},
+				Body:        EmailBodyHTML,
+				Attachments: []string{"csv", "json"},
+			}
+
+			if err := e.Notify(context.Background(), emailTestResult()); err != nil {
+				t.Fatalf("Notify() returned error: %v", err)
+			}
+			<-server.done
+			if server.encrypted != (tt.security != SMTPNone) {
+				t.Errorf("encrypted = %v", server.encrypted)
+			}
+			if tt.username != "" && server.auth != "\x00audit@example.com\x00hunter2" {
+				t.Errorf("AUTH PLAIN = %q", server.auth)
+			}
+			if !strings.HasPrefix(server.from, "FROM:<audit@example.com>") || strings.Join(server.rcpts, ",") != "TO:<ops@example.com>,TO:<security@example.com>" {
+				t.Errorf("envelope = %s %v", server.from, server.rcpts)
+			}
+
+			header, parts := parseEmail(t, server.data)
+			if got := header.Get("Subject"); got != "Mattermost plugin audit for https://mattermost.example.com: 1 update(s) available" {
+				t.Errorf("Subject = %q", got)
+			}
+			if header.Get("To") != "ops@example.com, security@example.com" || header.Get("Message-ID") == "" {
+				t.Errorf("unexpected headers: %v", header)
+			}
+			if len(parts["text/plain"]) != 1 || !strings.Contains(parts["text/plain"][0].body, "| Confluence <beta> |") {
+				t.Errorf("missing Markdown alternative: %+v", parts["text/plain"])
+			}
+			if len(parts["text/html"]) != 1 || !strings.Contains(parts["text/html"][0].body, "<td>Confluence &lt;beta&gt;</td>") {
+				t.Errorf("missing or unescaped HTML body: %+v", parts["text/html"])
+			}
+
+			if len(parts["text/csv"]) != 1 || !strings.Contains(parts["text/csv"][0].body, "com.mattermost.confluence") {
+				t.Fatalf("missing CSV attachment: %+v", parts["text/csv"])
+			}
+			if got := parts["text/csv"][0].header.Get("Content-Disposition"); got != "attachment; filename=plugin-audit-mattermost.example.com-2025-03-14.csv" {
+				t.Errorf("CSV Content-Disposition = %q", got)
+			}
+			if len(parts["application/json"]) != 1 {
+				t.Fatalf("missing JSON attachment")
+			}
+			var got struct{ Plugins []PluginReport }
+			if err := json.Unmarshal([]byte(parts["application/json"][0].body), &got); err != nil || len(got.Plugins) != 5 {
+				t.Errorf("JSON attachment = %s (%v)", parts["application/json"][0].body, err)
+			}
+		})
+	}
+}
+
+func TestEmail_MarkdownBody(t *testing.T) {
+	e := &Email{From: "audit@example.com", To: []string{"ops@example.com"}, Subject: "Plugins ✓", Body: EmailBodyMarkdown}
+	msg, err := e.buildMessage(emailTestResult(), time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, parts := parseEmail(t, string(msg))
+	if got, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Subject")); got != "Plugins ✓" {
+		t.Errorf("Subject = %q", got)
+	}
+	if header.Get("Date") != "Fri, 14 Mar 2025 10:00:00 +0000" {
+		t.Errorf("Date = %q", header.Get("Date"))
+	}
+	if len(parts) != 1 || len(parts["text/plain"]) != 1 || !strings.Contains(parts["text/plain"][0].body, "# Mattermost Plugin Audit") {
+		t.Errorf("expected only the Markdown body, got %v", parts)
+	}
+}
+
+func TestEmail_Failures(t *testing.T) {
+	_, clientTLS := testTLSConfigs(t)
+	tests := []struct {
+		name   string
+		server *smtpStandIn
+		want   string
+	}{
+		{"no starttls", &smtpStandIn{}, "does not offer STARTTLS"},
+		{"rejected recipient", &smtpStandIn{reject: "nobody@"}, "recipient nobody@example.com: 550"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			security := SMTPStartTLS
+			if tt.server.reject != "" {
+				security = SMTPNone
+			}
+			e := &Email{
+				SMTP: SMTPConfig{Addr: newSMTPStandIn(t, tt.server), Security: security, Timeout: 5 * time.Second, TLSConfig: clientTLS},
+				From: "audit@example.com",
+				To:   []string{"ops@example.com", "nobody@example.com"},
+			}
+			err := e.Notify(context.Background(), emailTestResult())
+			<-tt.server.done
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Notify() error = %v, want %q", err, tt.want)
+			}
+			if tt.server.data != "" {
+				t.Error("message sent despite the failure")
+			}
+		})
+	}
+}
+
+func TestBuildEmail(t *testing.T) {
+	t.Setenv("MM_SMTP_PASSWORD", "")
+	tests := []struct {
+		name     string
+		to, from string
+		attach   string
+		host     string
+		username string
+		security string
+		password string
+		wantAddr string
+		wantErr  string
+	}{
+		{name: "defaults", to: "ops@example.com", from: "audit@example.com", attach: "csv,json", host: "smtp.example.com", security: "starttls", wantAddr: "smtp.example.com:587"},
+		{name: "with port and auth", to: "a@example.com, B <b@example.com>", from: "audit@example.com", attach: "none", host: "smtp.example.com:465", username: "audit", security: "TLS", password: "x", wantAddr: "smtp.example.com:465"},
+		{name: "bad recipient", to: "ops", from: "audit@example.com", host: "smtp.example.com", security: "starttls", wantErr: "invalid address in --email-to"},
+		{name: "no sender", to: "ops@example.com", host: "smtp.example.com", security: "starttls", wantErr: "requires a sender"},
+		{name: "no host", to: "ops@example.com", from: "audit@example.com", security: "starttls", wantErr: "requires an SMTP server"},
+		{name: "bad attachment", to: "ops@example.com", from: "audit@example.com", attach: "pdf", host: "smtp.example.com", security: "starttls", wantErr: `invalid attachment format "pdf"`},
+		{name: "bad security", to: "ops@example.com", from: "audit@example.com", host: "smtp.example.com", security: "ssl", wantErr: `invalid --smtp-tls "ssl"`},
+		{name: "auth without encryption", to: "ops@example.com", from: "audit@example.com", host: "localhost", username: "audit", security: "none", password: "x", wantErr: "needs an encrypted connection"},
+		{name: "auth without password", to: "ops@example.com", from: "audit@example.com", host: "smtp.example.com", username: "audit", security: "starttls", wantErr: "MM_SMTP_PASSWORD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MM_SMTP_PASSWORD", tt.password)
+			e, err := buildEmail(tt.to, tt.from, "", "html", tt.attach, tt.host, tt.username, tt.security)
+			if tt.wantErr != "" {
+				cliErr, ok := err.(*CLIError)
+				if !ok || cliErr.Code != ExitConfigError || !strings.Contains(cliErr.Message, tt.wantErr) {
+					t.Errorf("buildEmail() error = %v, want a config error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildEmail() returned error: %v", err)
+			}
+			if e.SMTP.Addr != tt.wantAddr || e.SMTP.Password != tt.password {
+				t.Errorf("SMTP = %+v", e.SMTP)
+			}
+		})
+	}
+}
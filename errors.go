@@ -4,11 +4,13 @@ import "fmt"
 
 // Exit codes
 const (
-	ExitSuccess          = 0 // Success
-	ExitConfigError      = 1 // Missing URL, invalid auth, bad flags
-	ExitAPIError         = 2 // Mattermost instance unreachable or unexpected response
-	ExitMarketplaceError = 3 // Marketplace API unreachable (air-gapped)
-	ExitOutputError      = 4 // Unable to write output file
+	ExitSuccess          = 0   // Success
+	ExitConfigError      = 1   // Missing URL, invalid auth, bad flags
+	ExitAPIError         = 2   // Mattermost instance unreachable or unexpected response
+	ExitMarketplaceError = 3   // Marketplace API unreachable (air-gapped)
+	ExitOutputError      = 4   // Unable to write output file
+	ExitNotifyError      = 5   // A notification could not be delivered
+	ExitInterrupted      = 130 // Cancelled by SIGINT/SIGTERM
 )
 
 // CLIError wraps an error with an exit code for structured error handling.
@@ -44,3 +46,11 @@ func marketplaceError(msg string, err error) *CLIError {
 func outputError(msg string, err error) *CLIError {
 	return &CLIError{Code: ExitOutputError, Message: msg, Err: err}
 }
+
+func notifyError(msg string, err error) *CLIError {
+	return &CLIError{Code: ExitNotifyError, Message: msg, Err: err}
+}
+
+func cancelledError(err error) *CLIError {
+	return &CLIError{Code: ExitInterrupted, Message: "error: audit cancelled.", Err: err}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PluginFilter selects plugins from an audit. Each criterion that is set must
+// match; within a list criterion, any one value may match.
+type PluginFilter struct {
+	Sources      []string       // Plugin sources, e.g. "marketplace"
+	Statuses     []string       // "enabled" or "disabled"
+	Types        []string       // "server", "webapp", "both" or "unknown"
+	UpdateStates []string       // Update states, e.g. "outdated"
+	IDs          []string       // Glob patterns matched against the plugin ID
+	Name         *regexp.Regexp // Matched against the plugin name
+	Where        *WhereExpr     // Expression evaluated against the report fields
+}
+
+// Match reports whether r satisfies every criterion in the filter.
+func (f *PluginFilter) Match(r PluginReport) bool {
+	if len(f.Sources) > 0 && !containsFold(f.Sources, r.Source) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !containsFold(f.Statuses, r.Status) {
+		return false
+	}
+	if len(f.Types) > 0 && !containsFold(f.Types, r.PluginType) {
+		return false
+	}
+	if len(f.UpdateStates) > 0 && !containsFold(f.UpdateStates, r.UpdateState) {
+		return false
+	}
+	if len(f.IDs) > 0 {
+		matched := false
+		for _, pattern := range f.IDs {
+			if ok, _ := path.Match(pattern, r.PluginID); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if f.Name != nil && !f.Name.MatchString(r.Name) {
+		return false
+	}
+	if f.Where != nil && !f.Where.Match(r) {
+		return false
+	}
+	return true
+}
+
+// FilterSpec holds the raw filter flag values. List values are comma-separated.
+type FilterSpec struct {
+	Sources      string
+	Statuses     string
+	Types        string
+	UpdateStates string
+	IDs          string
+	Name         string
+	Where        string
+}
+
+var (
+	filterSources      = []string{SourceMarketplace, SourceMattermost, SourceBundled, SourceThirdParty}
+	filterStatuses     = []string{"enabled", "disabled"}
+	filterTypes        = []string{"server", "webapp", "both", "unknown"}
+	filterUpdateStates = []string{UpdateStateOutdated, UpdateStateUpToDate, UpdateStateAhead, UpdateStateIncomparable, UpdateStateUnknown}
+)
+
+// Build validates the spec and returns the filter, or nil if no criteria are set.
+func (s FilterSpec) Build() (*PluginFilter, error) {
+	var f PluginFilter
+	var err error
+
+	if f.Sources, err = filterChoices("--source", s.Sources, filterSources); err != nil {
+		return nil, err
+	}
+	if f.Statuses, err = filterChoices("--status", s.Statuses, filterStatuses); err != nil {
+		return nil, err
+	}
+	if f.Types, err = filterChoices("--type", s.Types, filterTypes); err != nil {
+		return nil, err
+	}
+	if f.UpdateStates, err = filterChoices("--update-state", s.UpdateStates, filterUpdateStates); err != nil {
+		return nil, err
+	}
+
+	f.IDs = splitList(s.IDs)
+	for _, pattern := range f.IDs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, configError(fmt.Sprintf("error: invalid --id pattern %q.", pattern), err)
+		}
+	}
+
+	if s.Name != "" {
+		if f.Name, err = regexp.Compile(s.Name); err != nil {
+			return nil, configError(fmt.Sprintf("error: invalid --name regular expression: %v", err), err)
+		}
+	}
+
+	if strings.TrimSpace(s.Where) != "" {
+		if f.Where, err = ParseWhere(s.Where); err != nil {
+			return nil, configError(fmt.Sprintf("error: invalid --where expression: %v", err), err)
+		}
+	}
+
+	if reflect.DeepEqual(f, PluginFilter{}) {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+// filterChoices splits a comma-separated flag value and checks each item is allowed.
+func filterChoices(flagName, value string, allowed []string) ([]string, error) {
+	items := splitList(strings.ToLower(value))
+	for _, item := range items {
+		if !containsFold(allowed, item) {
+			return nil, configError(fmt.Sprintf("error: invalid %s value %q. Use %s.", flagName, item, strings.Join(allowed, ", ")), nil)
+		}
+	}
+	return items, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportField describes a PluginReport field addressable by name in filters
+// and output columns. Names come from the "report" struct tag if present,
+// otherwise the "json" tag, so new report fields are picked up automatically.
+type reportField struct {
+	Name  string
+	index int
+}
+
+var reportFields = func() []reportField {
+	var fields []reportField
+	t := reflect.TypeOf(PluginReport{})
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := sf.Tag.Lookup("report")
+		if !ok {
+			name = strings.Split(sf.Tag.Get("json"), ",")[0]
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, reportField{Name: name, index: i})
+	}
+	return fields
+}()
+
+// lookupReportField returns the field with the given name.
+func lookupReportField(name string) (reportField, bool) {
+	for _, f := range reportFields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return reportField{}, false
+}
+
+// reportFieldNames lists the addressable field names, sorted.
+func reportFieldNames() []string {
+	names := make([]string, 0, len(reportFields))
+	for _, f := range reportFields {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Numeric reports whether the field holds an integer.
+func (f reportField) Numeric() bool {
+	t := reflect.TypeOf(PluginReport{}).Field(f.index).Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// Value returns the field's value in r as a string; nil pointers are "".
+func (f reportField) Value(r PluginReport) string {
+	v := reflect.ValueOf(r).Field(f.index)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	}
+	return fmt.Sprint(v.Interface())
+}
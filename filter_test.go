@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPluginFilter_Match(t *testing.T) {
+	reports := []PluginReport{
+		{PluginID: "com.mattermost.confluence", Name: "Confluence", Status: "enabled", Source: SourceMarketplace, PluginType: "both", UpdateState: UpdateStateOutdated},
+		{PluginID: "com.mattermost.calls", Name: "Calls", Status: "disabled", Source: SourceBundled, PluginType: "both", UpdateState: UpdateStateUnknown},
+		{PluginID: "com.pexip.meetings", Name: "Pexip Meetings", Status: "enabled", Source: SourceThirdParty, PluginType: "server", UpdateState: UpdateStateUnknown},
+	}
+
+	tests := []struct {
+		name   string
+		spec   FilterSpec
+		expect []string
+	}{
+		{"source", FilterSpec{Sources: "marketplace,bundled"}, []string{"Confluence", "Calls"}},
+		{"status", FilterSpec{Statuses: "disabled"}, []string{"Calls"}},
+		{"type", FilterSpec{Types: "server"}, []string{"Pexip Meetings"}},
+		{"update state", FilterSpec{UpdateStates: "outdated"}, []string{"Confluence"}},
+		{"id glob", FilterSpec{IDs: "com.mattermost.*"}, []string{"Confluence", "Calls"}},
+		{"name regex", FilterSpec{Name: "(?i)^p"}, []string{"Pexip Meetings"}},
+		{"combined", FilterSpec{IDs: "com.mattermost.*", Statuses: "enabled"}, []string{"Confluence"}},
+		{"where", FilterSpec{Where: `type == "both" && status == "enabled"`}, []string{"Confluence"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := tt.spec.Build()
+			if err != nil {
+				t.Fatalf("Build() returned error: %v", err)
+			}
+			var got []string
+			for _, r := range reports {
+				if filter.Match(r) {
+					got = append(got, r.Name)
+				}
+			}
+			if len(got) != len(tt.expect) {
+				t.Fatalf("expected %v, got %v", tt.expect, got)
+			}
+			for i := range got {
+				if got[i] != tt.expect[i] {
+					t.Errorf("expected %v, got %v", tt.expect, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterSpec_Build(t *testing.T) {
+	if filter, err := (FilterSpec{}).Build(); err != nil || filter != nil {
+		t.Errorf("expected nil filter for empty spec, got %v, %v", filter, err)
+	}
+
+	invalid := []FilterSpec{
+		{Sources: "marketplace,appstore"},
+		{Statuses: "paused"},
+		{Types: "mobile"},
+		{UpdateStates: "stale"},
+		{IDs: "com.[mattermost"},
+		{Name: "("},
+		{Where: `source ==`},
+	}
+	for _, spec := range invalid {
+		_, err := spec.Build()
+		if err == nil {
+			t.Errorf("expected error for %+v", spec)
+			continue
+		}
+		if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitConfigError {
+			t.Errorf("expected config error for %+v, got %v", spec, err)
+		}
+	}
+}
+
+func TestReportFields(t *testing.T) {
+	r := PluginReport{UpdateAvailable: "ahead", ReleasesBehind: intPtr(2)}
+
+	field, ok := lookupReportField("update_available")
+	if !ok || field.Value(r) != "ahead" {
+		t.Errorf("expected update_available to read the string state, got %v %q", ok, field.Value(r))
+	}
+	field, ok = lookupReportField("releases_behind")
+	if !ok || field.Value(r) != "2" {
+		t.Errorf("expected releases_behind 2, got %v %q", ok, field.Value(r))
+	}
+	if field.Value(PluginReport{}) != "" {
+		t.Errorf("expected empty value for nil releases_behind, got %q", field.Value(PluginReport{}))
+	}
+}
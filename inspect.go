@@ -0,0 +1,494 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"gopkg.in/yaml.v3"
+)
+
+// bundleMaxManifest bounds how much of a bundle's manifest is read.
+const bundleMaxManifest = 1 << 20
+
+// bundleManifestNames are the manifest file names Mattermost accepts, in the
+// order it looks for them.
+var bundleManifestNames = []string{"plugin.json", "plugin.yaml", "plugin.yml"}
+
+// BundleReport describes a plugin bundle (.tar.gz) read from disk.
+type BundleReport struct {
+	File              string
+	Manifest          *model.Manifest
+	ServerExecutables []BundleFile // Sorted by platform; "any" for a single executable
+	WebappBundle      *BundleFile  // nil if the plugin has no webapp
+	Settings          []*model.PluginSetting
+	Warnings          []string
+	Audit             PluginReport // Classification and Marketplace comparison
+}
+
+// BundleFile is a file named by a bundle's manifest.
+type BundleFile struct {
+	Platform string `json:"platform,omitempty"`
+	Path     string `json:"path"`
+	Present  bool   `json:"present"`
+}
+
+// InspectBundle reads the manifest of the plugin bundle at file and checks
+// that the executables and webapp bundle it names are in the archive.
+func InspectBundle(file string) (*BundleReport, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, configError(fmt.Sprintf("error: unable to read %s: %v", file, err), err)
+	}
+	defer f.Close()
+
+	invalid := func(err error) error {
+		return configError(fmt.Sprintf("error: %s is not a valid plugin bundle: %v", file, err), err)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	defer gz.Close()
+
+	// Bundles normally hold a single top-level directory named after the
+	// plugin; the manifest may also sit at the root.
+	files := make(map[string]bool)
+	var manifestName string
+	var manifestData []byte
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, invalid(err)
+		}
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		files[name] = true
+
+		if strings.Count(name, "/") > 1 || !isBundleManifest(path.Base(name)) {
+			continue
+		}
+		if manifestName != "" && !betterManifest(name, manifestName) {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, bundleMaxManifest+1))
+		if err != nil {
+			return nil, invalid(err)
+		}
+		if len(data) > bundleMaxManifest {
+			return nil, invalid(fmt.Errorf("%s is larger than %d KiB", name, bundleMaxManifest>>10))
+		}
+		manifestName, manifestData = name, data
+	}
+	if manifestName == "" {
+		return nil, invalid(errors.New("no plugin.json or plugin.yaml found"))
+	}
+
+	var manifest model.Manifest
+	if path.Ext(manifestName) == ".json" {
+		err = json.Unmarshal(manifestData, &manifest)
+	} else {
+		err = yaml.Unmarshal(manifestData, &manifest)
+	}
+	if err != nil {
+		return nil, invalid(fmt.Errorf("%s: %v", manifestName, err))
+	}
+
+	b := &BundleReport{File: file, Manifest: &manifest}
+	if err := manifest.IsValid(); err != nil {
+		b.Warnings = append(b.Warnings, fmt.Sprintf("invalid manifest: %v", err))
+	}
+
+	root := path.Dir(manifestName)
+	inBundle := func(p string) BundleFile {
+		return BundleFile{Path: p, Present: files[path.Join(root, path.Clean(p))]}
+	}
+	if s := manifest.Server; s != nil {
+		for platform, p := range s.Executables {
+			exe := inBundle(p)
+			exe.Platform = platform
+			b.ServerExecutables = append(b.ServerExecutables, exe)
+		}
+		sort.Slice(b.ServerExecutables, func(i, j int) bool {
+			return b.ServerExecutables[i].Platform < b.ServerExecutables[j].Platform
+		})
+		if s.Executable != "" {
+			exe := inBundle(s.Executable)
+			exe.Platform = "any"
+			b.ServerExecutables = append(b.ServerExecutables, exe)
+		}
+	}
+	if w := manifest.Webapp; w != nil {
+		bundle := inBundle(w.BundlePath)
+		b.WebappBundle = &bundle
+	}
+	for _, exe := range b.ServerExecutables {
+		if !exe.Present {
+			b.Warnings = append(b.Warnings, fmt.Sprintf("server executable %s (%s) is missing from the bundle", exe.Path, exe.Platform))
+		}
+	}
+	if b.WebappBundle != nil && !b.WebappBundle.Present {
+		b.Warnings = append(b.Warnings, fmt.Sprintf("webapp bundle %s is missing from the bundle", b.WebappBundle.Path))
+	}
+
+	b.Settings = manifestSettings(&manifest)
+	return b, nil
+}
+
+func isBundleManifest(name string) bool {
+	for _, m := range bundleManifestNames {
+		if name == m {
+			return true
+		}
+	}
+	return false
+}
+
+// betterManifest reports whether candidate should replace current: shallower
+// paths win, then the preferred file name.
+func betterManifest(candidate, current string) bool {
+	if dc, dm := strings.Count(candidate, "/"), strings.Count(current, "/"); dc != dm {
+		return dc < dm
+	}
+	rank := func(name string) int {
+		for i, m := range bundleManifestNames {
+			if path.Base(name) == m {
+				return i
+			}
+		}
+		return len(bundleManifestNames)
+	}
+	return rank(candidate) < rank(current)
+}
+
+// installedPlugin describes the bundle as RunAudit sees an installed plugin.
+func (b *BundleReport) installedPlugin() InstalledPlugin {
+	m := b.Manifest
+	return InstalledPlugin{
+		ID:              m.Id,
+		Name:            m.Name,
+		Version:         m.Version,
+		HomepageURL:     m.HomepageURL,
+		ReleaseNotesURL: m.ReleaseNotesURL,
+		HasServer:       m.Server != nil,
+		HasWebapp:       m.Webapp != nil,
+	}
+}
+
+// checkTarget warns when the bundle cannot run on a server of the given
+// platform and version. Either may be "" to skip that check.
+func (b *BundleReport) checkTarget(platform, serverVersion string) {
+	if platform != "" && b.Manifest.Server != nil {
+		supported := false
+		for _, exe := range b.ServerExecutables {
+			if exe.Platform == platform || exe.Platform == "any" {
+				supported = true
+			}
+		}
+		if !supported {
+			b.Warnings = append(b.Warnings, fmt.Sprintf("no server executable for %s", platform))
+		}
+	}
+	if minVersion := b.Manifest.MinServerVersion; serverVersion != "" && minVersion != "" {
+		if cmp, ok := CompareVersions(serverVersion, minVersion); ok && cmp < 0 {
+			b.Warnings = append(b.Warnings, fmt.Sprintf("requires Mattermost %s or later, but the target server runs %s", minVersion, serverVersion))
+		}
+	}
+}
+
+// InspectOptions controls runInspect's Marketplace comparison and target checks.
+type InspectOptions struct {
+	Platform      string // Server platform the bundle must support
+	ServerVersion string // Server version the bundle must support, and the Marketplace is queried for
+}
+
+// InspectBundles inspects each bundle and compares it with the Marketplace
+// catalogue from mp, or classifies it without one when mp is nil. Bundles
+// that cannot be read are returned as errors alongside the others.
+func InspectBundles(ctx context.Context, files []string, mp MarketplaceSource, opts InspectOptions, logf func(string, ...interface{})) ([]*BundleReport, []error, error) {
+	catalogue := map[string]*MarketplacePlugin{}
+	if mp != nil {
+		logf("Fetching Marketplace catalogue...")
+		var err error
+		if catalogue, err = mp.GetMarketplacePlugins(ctx); err != nil {
+			return nil, nil, err
+		}
+		logf("Marketplace catalogue contains %d plugin(s)", len(catalogue))
+	}
+
+	var bundles []*BundleReport
+	var errs []error
+	for _, file := range files {
+		logf("Inspecting %s...", file)
+		b, err := InspectBundle(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		b.checkTarget(opts.Platform, opts.ServerVersion)
+		b.Audit = buildReport(b.installedPlugin(), catalogue, logf)
+		bundles = append(bundles, b)
+	}
+	return bundles, errs, nil
+}
+
+// jsonBundle is the JSON representation of a BundleReport.
+type jsonBundle struct {
+	File              string        `json:"file"`
+	PluginID          string        `json:"plugin_id"`
+	Name              string        `json:"name"`
+	Version           string        `json:"version"`
+	MinServerVersion  string        `json:"min_server_version"`
+	Type              string        `json:"type"`
+	ServerExecutables []BundleFile  `json:"server_executables"`
+	WebappBundle      *BundleFile   `json:"webapp_bundle"`
+	Settings          []jsonSetting `json:"settings"`
+	Source            string        `json:"source"`
+	LatestVersion     string        `json:"latest_version"`
+	UpdateAvailable   *bool         `json:"update_available"`
+	UpdateState       string        `json:"update_state"`
+	UpdateSeverity    string        `json:"update_severity"`
+	ReleasesBehind    *int          `json:"releases_behind"`
+	MarketplaceURL    string        `json:"marketplace_url"`
+	Warnings          []string      `json:"warnings"`
+}
+
+type jsonSetting struct {
+	Key         string      `json:"key"`
+	DisplayName string      `json:"display_name"`
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default"`
+	Secret      bool        `json:"secret"`
+}
+
+// formatInspectJSON writes the bundles as a JSON array.
+func formatInspectJSON(w io.Writer, bundles []*BundleReport) error {
+	out := make([]jsonBundle, 0, len(bundles))
+	for _, b := range bundles {
+		a := b.Audit
+		jb := jsonBundle{
+			File:              b.File,
+			PluginID:          b.Manifest.Id,
+			Name:              b.Manifest.Name,
+			Version:           b.Manifest.Version,
+			MinServerVersion:  b.Manifest.MinServerVersion,
+			Type:              a.PluginType,
+			ServerExecutables: b.ServerExecutables,
+			WebappBundle:      b.WebappBundle,
+			Settings:          []jsonSetting{},
+			Source:            a.Source,
+			LatestVersion:     a.LatestVersion,
+			UpdateAvailable:   a.UpdateAvailJSON,
+			UpdateState:       a.UpdateState,
+			UpdateSeverity:    a.UpdateSeverity,
+			ReleasesBehind:    a.ReleasesBehind,
+			MarketplaceURL:    a.MarketplaceURL,
+			Warnings:          b.Warnings,
+		}
+		if jb.ServerExecutables == nil {
+			jb.ServerExecutables = []BundleFile{}
+		}
+		if jb.Warnings == nil {
+			jb.Warnings = []string{}
+		}
+		for _, s := range b.Settings {
+			jb.Settings = append(jb.Settings, jsonSetting{Key: s.Key, DisplayName: s.DisplayName, Type: s.Type, Default: s.Default, Secret: s.Secret})
+		}
+		out = append(out, jb)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// formatInspectTable writes one section per bundle.
+func formatInspectTable(w io.Writer, bundles []*BundleReport) error {
+	for _, b := range bundles {
+		m, a := b.Manifest, b.Audit
+		fmt.Fprintf(w, "=== %s ===\n", b.File)
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "Plugin:\t%s (%s)\n", m.Name, m.Id)
+		fmt.Fprintf(tw, "Version:\t%s\n", m.Version)
+		fmt.Fprintf(tw, "Min server version:\t%s\n", valueOr(m.MinServerVersion, "(any)"))
+		fmt.Fprintf(tw, "Type:\t%s\n", a.PluginType)
+		fmt.Fprintf(tw, "Source:\t%s\n", a.Source)
+		if a.Source == SourceMarketplace {
+			fmt.Fprintf(tw, "Latest version:\t%s\n", a.LatestVersion)
+			fmt.Fprintf(tw, "Update?:\t%s\n", updateIndicator(a))
+		}
+		if len(b.ServerExecutables) == 0 {
+			fmt.Fprintf(tw, "Server:\t(none)\n")
+		}
+		for i, exe := range b.ServerExecutables {
+			label := ""
+			if i == 0 {
+				label = "Server:"
+			}
+			fmt.Fprintf(tw, "%s\t%s  %s%s\n", label, exe.Platform, exe.Path, missingNote(exe.Present))
+		}
+		if b.WebappBundle != nil {
+			fmt.Fprintf(tw, "Webapp:\t%s%s\n", b.WebappBundle.Path, missingNote(b.WebappBundle.Present))
+		} else {
+			fmt.Fprintf(tw, "Webapp:\t(none)\n")
+		}
+		fmt.Fprintf(tw, "Settings:\t%d\n", len(b.Settings))
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		if len(b.Settings) > 0 {
+			tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "  KEY\tTYPE\tDEFAULT\tSECRET")
+			for _, s := range b.Settings {
+				def := ""
+				if s.Default != nil {
+					def = fmt.Sprint(s.Default)
+				}
+				secret := "No"
+				if s.Secret {
+					secret = "Yes"
+				}
+				fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", s.Key, s.Type, truncate(40, def), secret)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+		for _, warning := range b.Warnings {
+			fmt.Fprintf(w, "warning: %s\n", warning)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func missingNote(present bool) string {
+	if present {
+		return ""
+	}
+	return "  (missing)"
+}
+
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// runInspect implements the "inspect" subcommand.
+func runInspect(args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mm-plugin-audit inspect [flags] BUNDLE.tar.gz...")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "table", "Output format: table, json")
+	outputFlag := fs.String("output", "", "Write output to file")
+	marketplaceURL := fs.String("marketplace-url", "", "Marketplace to compare against (or set MM_MARKETPLACE_URL; default "+DefaultMarketplaceURL+")")
+	offline := fs.Bool("offline", false, "Skip the Marketplace comparison")
+	platform := fs.String("platform", DefaultMarketplacePlatform, "Server platform the bundle must include an executable for")
+	serverVersion := fs.String("server-version", "", "Target server version: checked against min_server_version, and used to find the latest compatible release")
+	timeout := fs.Duration("timeout", DefaultRequestTimeout, "Timeout for each request attempt (0 to disable)")
+	retries := fs.Int("retries", DefaultRetries, "Retries for rate-limited, 5xx or reset requests")
+	proxyFlag := fs.String("proxy", "", "HTTP(S) proxy URL (or set MM_PROXY)")
+	verbose := fs.Bool("verbose", false, "Enable verbose logging to stderr")
+	fs.BoolVar(verbose, "v", false, "Enable verbose logging to stderr")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitSuccess
+		}
+		return ExitConfigError
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "error: at least one plugin bundle is required.")
+		fs.Usage()
+		return ExitConfigError
+	}
+	*format = strings.ToLower(*format)
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "error: invalid format %q. Use table or json.\n", *format)
+		return ExitConfigError
+	}
+
+	logf := verboseLogger(*verbose)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var mp MarketplaceSource
+	if !*offline {
+		httpClient, err := newHTTPClient(HTTPConfig{
+			RequestTimeout: *timeout,
+			Retries:        *retries,
+			ProxyURL:       resolveFlag(*proxyFlag, "MM_PROXY"),
+		}, logf)
+		if err != nil {
+			return exitWithError(err)
+		}
+		mpURL := resolveFlag(*marketplaceURL, "MM_MARKETPLACE_URL")
+		if mpURL == "" {
+			mpURL = DefaultMarketplaceURL
+		}
+		if mp, err = NewMarketplaceClient(mpURL, httpClient, *serverVersion, *platform); err != nil {
+			return exitWithError(err)
+		}
+	}
+
+	bundles, errs, err := InspectBundles(ctx, fs.Args(), mp, InspectOptions{Platform: *platform, ServerVersion: *serverVersion}, logf)
+	if err != nil {
+		return exitWithError(err)
+	}
+	for _, e := range errs {
+		exitWithError(e)
+	}
+
+	var w io.Writer = os.Stdout
+	var outFile *atomicFile
+	if *outputFlag != "" {
+		if outFile, err = createAtomic(*outputFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "error: unable to write to %s: %v\n", *outputFlag, err)
+			return ExitOutputError
+		}
+		defer outFile.Abort()
+		w = outFile
+	}
+	if *format == "json" {
+		err = formatInspectJSON(w, bundles)
+	} else {
+		err = formatInspectTable(w, bundles)
+	}
+	if err == nil && outFile != nil {
+		err = outFile.Commit()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to write output: %v\n", err)
+		return ExitOutputError
+	}
+
+	if len(errs) > 0 {
+		return ExitConfigError
+	}
+	return ExitSuccess
+}
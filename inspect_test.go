@@ -0,0 +1,193 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBundle creates a .tar.gz plugin bundle in a temporary directory.
+func writeBundle(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testBundleManifest = `{
+  "id": "com.mattermost.confluence",
+  "name": "Confluence",
+  "version": "1.3.0",
+  "min_server_version": "9.5.0",
+  "server": {"executables": {
+    "linux-amd64": "server/dist/plugin-linux-amd64",
+    "darwin-arm64": "server/dist/plugin-darwin-arm64"
+  }},
+  "webapp": {"bundle_path": "webapp/dist/main.js"},
+  "settings_schema": {
+    "settings": [{"key": "Secret", "display_name": "Webhook Secret", "type": "generated", "secret": true}],
+    "sections": [{"key": "advanced", "settings": [{"key": "Timeout", "type": "number", "default": 30}]}]
+  }
+}`
+
+func TestInspectBundle(t *testing.T) {
+	path := writeBundle(t, map[string]string{
+		"./com.mattermost.confluence/plugin.json":                    testBundleManifest,
+		"./com.mattermost.confluence/server/dist/plugin-linux-amd64": "ELF",
+		"./com.mattermost.confluence/webapp/dist/main.js":            "js",
+		"./com.mattermost.confluence/assets/plugin.json":             `{"id": "decoy"}`,
+	})
+
+	b, err := InspectBundle(path)
+	if err != nil {
+		t.Fatalf("InspectBundle() returned error: %v", err)
+	}
+	if b.Manifest.Id != "com.mattermost.confluence" || b.Manifest.MinServerVersion != "9.5.0" {
+		t.Errorf("unexpected manifest: %+v", b.Manifest)
+	}
+	want := []BundleFile{
+		{Platform: "darwin-arm64", Path: "server/dist/plugin-darwin-arm64", Present: false},
+		{Platform: "linux-amd64", Path: "server/dist/plugin-linux-amd64", Present: true},
+	}
+	if len(b.ServerExecutables) != 2 || b.ServerExecutables[0] != want[0] || b.ServerExecutables[1] != want[1] {
+		t.Errorf("unexpected executables: %+v", b.ServerExecutables)
+	}
+	if b.WebappBundle == nil || !b.WebappBundle.Present {
+		t.Errorf("expected the webapp bundle to be present, got %+v", b.WebappBundle)
+	}
+	if len(b.Settings) != 2 || b.Settings[0].Key != "Secret" || !b.Settings[0].Secret || b.Settings[1].Key != "Timeout" {
+		t.Errorf("expected settings from the schema and its sections, got %d", len(b.Settings))
+	}
+	if len(b.Warnings) != 1 || !strings.Contains(b.Warnings[0], "plugin-darwin-arm64") {
+		t.Errorf("expected a warning for the missing executable, got %v", b.Warnings)
+	}
+}
+
+func TestInspectBundle_YAMLAtRoot(t *testing.T) {
+	path := writeBundle(t, map[string]string{
+		"plugin.yaml":   "id: com.example.tool\nname: Tool\nversion: 0.1.0\nserver:\n  executable: server/plugin\n",
+		"server/plugin": "ELF",
+	})
+
+	b, err := InspectBundle(path)
+	if err != nil {
+		t.Fatalf("InspectBundle() returned error: %v", err)
+	}
+	if b.Manifest.Id != "com.example.tool" || len(b.ServerExecutables) != 1 || b.ServerExecutables[0].Platform != "any" || !b.ServerExecutables[0].Present {
+		t.Errorf("unexpected bundle: %+v %+v", b.Manifest, b.ServerExecutables)
+	}
+	if b.WebappBundle != nil {
+		t.Errorf("expected no webapp bundle, got %+v", b.WebappBundle)
+	}
+}
+
+func TestInspectBundle_Errors(t *testing.T) {
+	notGzip := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	os.WriteFile(notGzip, []byte("not gzip"), 0o644)
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing.tar.gz")},
+		{"not gzip", notGzip},
+		{"no manifest", writeBundle(t, map[string]string{"README.md": "hello"})},
+		{"invalid manifest", writeBundle(t, map[string]string{"p/plugin.json": "{"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := InspectBundle(tt.path)
+			if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitConfigError {
+				t.Errorf("expected a config error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInspectBundles(t *testing.T) {
+	good := writeBundle(t, map[string]string{
+		"confluence/plugin.json":                     testBundleManifest,
+		"confluence/server/dist/plugin-linux-amd64":  "ELF",
+		"confluence/server/dist/plugin-darwin-arm64": "ELF",
+		"confluence/webapp/dist/main.js":             "js",
+	})
+	mp := &mockMMClient{mpPlugins: map[string]*MarketplacePlugin{
+		"com.mattermost.confluence": {Version: "1.4.0", Versions: []string{"1.3.0", "1.4.0"}},
+	}}
+
+	bundles, errs, err := InspectBundles(context.Background(), []string{good, "missing.tar.gz"}, mp,
+		InspectOptions{Platform: "windows-amd64", ServerVersion: "9.4.2"}, noopLogger)
+	if err != nil {
+		t.Fatalf("InspectBundles() returned error: %v", err)
+	}
+	if len(bundles) != 1 || len(errs) != 1 {
+		t.Fatalf("expected one bundle and one error, got %d and %d", len(bundles), len(errs))
+	}
+
+	a := bundles[0].Audit
+	if a.Source != SourceMarketplace || a.UpdateState != UpdateStateOutdated || a.UpdateSeverity != SeverityMinor || a.PluginType != "both" {
+		t.Errorf("unexpected classification: %+v", a)
+	}
+	warnings := strings.Join(bundles[0].Warnings, "\n")
+	for _, want := range []string{"no server executable for windows-amd64", "requires Mattermost 9.5.0 or later, but the target server runs 9.4.2"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("expected warning %q, got:\n%s", want, warnings)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := formatInspectJSON(&out, bundles); err != nil {
+		t.Fatalf("formatInspectJSON() returned error: %v", err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if decoded[0]["plugin_id"] != "com.mattermost.confluence" || decoded[0]["update_available"] != true || decoded[0]["latest_version"] != "1.4.0" {
+		t.Errorf("unexpected JSON: %s", out.String())
+	}
+
+	out.Reset()
+	if err := formatInspectTable(&out, bundles); err != nil {
+		t.Fatalf("formatInspectTable() returned error: %v", err)
+	}
+	for _, want := range []string{
+		"Plugin:              Confluence (com.mattermost.confluence)",
+		"Update?:             YES ⚠ (minor, 1 behind)",
+		"linux-amd64  server/dist/plugin-linux-amd64",
+		"  Secret   generated           Yes",
+		"warning: no server executable for windows-amd64",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("table output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestInspectBundles_Offline(t *testing.T) {
+	path := writeBundle(t, map[string]string{"p/plugin.json": `{"id": "zoom", "name": "Zoom", "version": "1.8.0"}`})
+	bundles, _, err := InspectBundles(context.Background(), []string{path}, nil, InspectOptions{}, noopLogger)
+	if err != nil {
+		t.Fatalf("InspectBundles() returned error: %v", err)
+	}
+	if a := bundles[0].Audit; a.Source != SourceBundled || a.UpdateState != UpdateStateUnknown {
+		t.Errorf("expected a bundled plugin with unknown update state, got %+v", a)
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"golang.org/x/term"
 )
@@ -20,14 +25,85 @@ func main() {
 }
 
 func run() int {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "mirror":
+			return runMirror(os.Args[2:])
+		case "inspect":
+			return runInspect(os.Args[2:])
+		}
+	}
+
 	// Define flags
 	urlFlag := flag.String("url", "", "Mattermost server URL (or set MM_URL)")
 	tokenFlag := flag.String("token", "", "Personal Access Token (or set MM_TOKEN)")
 	usernameFlag := flag.String("username", "", "Username for password auth (or set MM_USERNAME)")
-	formatFlag := flag.String("format", "table", "Output format: table, csv, json")
+	supportPacket := flag.String("from-support-packet", "", "Audit offline from this support packet zip instead of a live server")
+	localMode := flag.Bool("local", false, "Connect over the server's local-mode Unix socket, without authentication")
+	socketPathFlag := flag.String("socket-path", "", "Local-mode socket path (or set MMCTL_LOCAL_SOCKET_PATH; default "+DefaultSocketPath+")")
+	formatFlag := flag.String("format", "table", "Output format: table, csv, json, ndjson, template, xlsx, cmdb")
+	templateName := flag.String("template", "", "Built-in template for --format template: "+strings.Join(BuiltinTemplates(), ", "))
+	templateFile := flag.String("template-file", "", "Go text/template file for --format template")
 	outputFlag := flag.String("output", "", "Write output to file")
+	colorFlag := flag.String("color", ColorAuto, "Colour table rows by update state: auto, always, never (auto honours NO_COLOR)")
+	columnsFlag := flag.String("columns", "", "Comma-separated columns to output, e.g. plugin_id,name,installed_version (any JSON field name)")
+	sortFlag := flag.String("sort", "", "Comma-separated sort keys; prefix with - for descending, e.g. status,-name")
+	interactive := flag.Bool("interactive", false, "Browse the results in a full-screen terminal UI")
 	outdatedOnly := flag.Bool("outdated-only", false, "Show only plugins with available updates (plus custom/private)")
+	includeAhead := flag.Bool("include-ahead", false, "With --outdated-only or --min-severity, also show plugins newer than the Marketplace")
+	includeIncomparable := flag.Bool("include-incomparable", false, "With --outdated-only or --min-severity, also show plugins whose version can't be compared with the Marketplace")
+	minSeverity := flag.String("min-severity", "", "Show only Marketplace plugins at least this far behind: major, minor, patch, prerelease (plus custom/private)")
+	sourceFilter := flag.String("source", "", "Show only these sources (comma-separated): marketplace, mattermost-plugin, bundled, third-party")
+	statusFilter := flag.String("status", "", "Show only plugins with this status: enabled, disabled")
+	typeFilter := flag.String("type", "", "Show only these plugin types (comma-separated): server, webapp, both, unknown")
+	idFilter := flag.String("id", "", "Show only plugin IDs matching these glob patterns (comma-separated), e.g. 'com.mattermost.*'")
+	nameFilter := flag.String("name", "", "Show only plugins whose name matches this regular expression")
+	updateStateFilter := flag.String("update-state", "", "Show only these update states (comma-separated): outdated, up-to-date, ahead, incomparable, unknown")
+	whereFilter := flag.String("where", "", "Show only plugins matching this expression, e.g. 'source == \"marketplace\" && status == \"disabled\"'")
+	auditSettingsFlag := flag.Bool("audit-settings", false, "Also check each plugin's configuration (needs system admin, --local or a support packet)")
+	auditServerSettings := flag.Bool("audit-server-settings", false, "Also check the server's plugin settings against a hardening profile (needs system admin, --local or a support packet)")
+	orphansFlag := flag.Bool("orphans", false, "Also report plugins configured but not installed, and installed but not configured (needs system admin, --local or a support packet)")
+	summaryAll := flag.Bool("summary-all", false, "Compute the summary over all installed plugins rather than the filtered set")
 	verbose := flag.Bool("verbose", false, "Enable verbose logging to stderr")
+	timeout := flag.Duration("timeout", DefaultRequestTimeout, "Timeout for each API request attempt (0 to disable)")
+	overallTimeout := flag.Duration("overall-timeout", 0, "Deadline for the whole audit, e.g. 5m (0 to disable)")
+	retries := flag.Int("retries", DefaultRetries, "Retries for rate-limited, 5xx or reset API requests")
+	proxyFlag := flag.String("proxy", "", "HTTP(S) proxy URL (or set MM_PROXY; defaults to HTTPS_PROXY/HTTP_PROXY)")
+	marketplaceURL := flag.String("marketplace-url", "", "Query this Marketplace directly instead of the server's proxy, which is also needed to count releases behind (or set MM_MARKETPLACE_URL), e.g. "+DefaultMarketplaceURL)
+	marketplacePlatform := flag.String("marketplace-platform", DefaultMarketplacePlatform, "Server platform used to filter a direct Marketplace query")
+	cacheTTL := flag.Duration("cache-ttl", 0, "Reuse a cached Marketplace catalogue younger than this, e.g. 6h (0 disables the cache)")
+	refreshCache := flag.Bool("refresh-cache", false, "Fetch the Marketplace catalogue even if a fresh cached copy exists")
+	cacheDir := flag.String("cache-dir", defaultCacheDir(), "Directory for the Marketplace catalogue cache")
+	var notifyWebhooks stringList
+	flag.Var(&notifyWebhooks, "notify-webhook", "POST the results to this URL (repeatable)")
+	notifyTemplate := flag.String("notify-template", "", "Go text/template file rendering the webhook body (default: the results as JSON)")
+	notifyContentType := flag.String("notify-content-type", "application/json", "Content-Type of the webhook body")
+	notifySecret := flag.String("notify-secret", "", "Sign webhook bodies with HMAC-SHA256 using this shared secret (or set MM_NOTIFY_SECRET)")
+	notifyWhen := flag.String("notify-when", NotifyAlways, "Only notify when these all hold (comma-separated): always, outdated, changed")
+	notifyState := flag.String("notify-state", "", "Snapshot file for --notify-when changed (default: in --cache-dir, per server)")
+	emailTo := flag.String("email-to", "", "Email the report to these comma-separated addresses")
+	emailFrom := flag.String("email-from", "", "Sender address for --email-to (or set MM_EMAIL_FROM)")
+	emailSubject := flag.String("email-subject", "", "Email subject (default: a summary of the audit)")
+	emailBody := flag.String("email-body", EmailBodyHTML, "Email body: html (with a plain-text alternative) or markdown")
+	emailAttach := flag.String("email-attach", "csv,json", "Comma-separated formats to attach: csv, json, ndjson, xlsx, or none")
+	smtpHost := flag.String("smtp-host", "", "SMTP server as host or host:port, default port "+DefaultSMTPPort+" (or set MM_SMTP_HOST)")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username; the password is read from MM_SMTP_PASSWORD (or set MM_SMTP_USERNAME)")
+	smtpTLS := flag.String("smtp-tls", SMTPStartTLS, "SMTP connection security: starttls, tls, or none")
+	trackerFlag := flag.String("tracker", "", "Open an issue for each outdated plugin in this tracker: jira, github, or rest")
+	trackerURL := flag.String("tracker-url", "", "Tracker base URL: the Jira site, GitHub API (default "+DefaultGitHubAPIURL+"), or REST API (or set MM_TRACKER_URL)")
+	trackerProject := flag.String("tracker-project", "", "Jira project key, or GitHub repository as owner/name")
+	trackerToken := flag.String("tracker-token", "", "Tracker API token (or set MM_TRACKER_TOKEN)")
+	trackerUsername := flag.String("tracker-username", "", "Jira Cloud account email, for basic auth with --tracker-token (or set MM_TRACKER_USERNAME)")
+	trackerIssueType := flag.String("tracker-issue-type", "", "Jira issue type for new issues (default "+DefaultJiraIssueType+")")
+	trackerCloseTransition := flag.String("tracker-close-transition", "", "Jira transition that closes issues (default: the first into a Done status)")
+	trackerLabel := flag.String("tracker-label", DefaultTrackerLabel, "Label marking the issues this tool manages")
+	trackerServerName := flag.String("tracker-server-name", "", "Name identifying the audited server in issues (default: the host of its URL)")
+	trackerDryRun := flag.Bool("tracker-dry-run", false, "Print the issues that would be opened, updated and closed without changing them")
+	cmdbURL := flag.String("cmdb-url", "", "Send inventory changes to this CMDB import set endpoint (or set MM_CMDB_URL)")
+	cmdbUsername := flag.String("cmdb-username", "", "CMDB username; the password is read from MM_CMDB_PASSWORD (or set MM_CMDB_USERNAME)")
+	cmdbState := flag.String("cmdb-state", "", "File recording the inventory last sent to the CMDB (default: in --cache-dir, per server)")
+	cmdbFull := flag.Bool("cmdb-full", false, "Send every configuration item to the CMDB, not just the changes")
 	showVersion := flag.Bool("version", false, "Print version and exit")
 
 	// Short flags
@@ -42,25 +118,221 @@ func run() int {
 
 	// Resolve URL
 	serverURL := resolveFlag(*urlFlag, "MM_URL")
-	if serverURL == "" {
-		fmt.Fprintln(os.Stderr, "error: server URL is required. Use --url or set the MM_URL environment variable.")
+	if serverURL == "" && *supportPacket == "" && !*localMode {
+		fmt.Fprintln(os.Stderr, "error: server URL is required. Use --url or set the MM_URL environment variable, use --local on the server host, or audit a support packet with --from-support-packet.")
 		return ExitConfigError
 	}
 	serverURL = strings.TrimRight(serverURL, "/")
 
 	// Validate format
 	format := strings.ToLower(*formatFlag)
-	if format != "table" && format != "csv" && format != "json" {
-		fmt.Fprintf(os.Stderr, "error: invalid format %q. Use table, csv, or json.\n", *formatFlag)
+	if format != "table" && format != "csv" && format != "json" && format != "ndjson" && format != "template" && format != "xlsx" && format != "cmdb" {
+		fmt.Fprintf(os.Stderr, "error: invalid format %q. Use table, csv, json, ndjson, template, xlsx, or cmdb.\n", *formatFlag)
+		return ExitConfigError
+	}
+	if format == "cmdb" && serverURL == "" {
+		return exitWithError(errNoCMDBServer())
+	}
+	if format == "xlsx" && *outputFlag == "" && !*interactive && term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, "error: --format xlsx writes a binary workbook. Use --output to choose a file, or redirect stdout.")
+		return ExitConfigError
+	}
+	var tmpl Template
+	if format == "template" {
+		var err error
+		if tmpl, err = LoadTemplate(*templateName, *templateFile); err != nil {
+			return exitWithError(err)
+		}
+	} else if *templateName != "" || *templateFile != "" {
+		fmt.Fprintln(os.Stderr, "error: --template and --template-file require --format template.")
+		return ExitConfigError
+	}
+
+	// Validate interactive mode
+	if *interactive {
+		if *outputFlag != "" {
+			fmt.Fprintln(os.Stderr, "error: --interactive cannot be combined with --output. Use the x key to export from the browser.")
+			return ExitConfigError
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+			fmt.Fprintln(os.Stderr, "error: --interactive requires a terminal on stdin and stdout.")
+			return ExitConfigError
+		}
+	}
+
+	// Validate colour mode
+	if _, err := resolveColor(*colorFlag, false, ""); err != nil {
+		return exitWithError(err)
+	}
+
+	// Validate column selection and sort keys
+	columns, err := ParseColumns(*columnsFlag)
+	if err != nil {
+		return exitWithError(err)
+	}
+	sortKeys, err := ParseSortKeys(*sortFlag)
+	if err != nil {
+		return exitWithError(err)
+	}
+
+	// Validate severity filter
+	severity := strings.ToLower(*minSeverity)
+	if _, ok := severityRank[severity]; severity != "" && !ok {
+		fmt.Fprintf(os.Stderr, "error: invalid severity %q. Use major, minor, patch, or prerelease.\n", *minSeverity)
+		return ExitConfigError
+	}
+
+	// Validate filters
+	filter, err := FilterSpec{
+		Sources:      *sourceFilter,
+		Statuses:     *statusFilter,
+		Types:        *typeFilter,
+		UpdateStates: *updateStateFilter,
+		IDs:          *idFilter,
+		Name:         *nameFilter,
+		Where:        *whereFilter,
+	}.Build()
+	if err != nil {
+		return exitWithError(err)
+	}
+
+	// Validate network settings
+	if *timeout < 0 || *overallTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "error: --timeout and --overall-timeout must not be negative.")
+		return ExitConfigError
+	}
+	if *retries < 0 {
+		fmt.Fprintln(os.Stderr, "error: --retries must not be negative.")
+		return ExitConfigError
+	}
+	proxyURL := resolveFlag(*proxyFlag, "MM_PROXY")
+	httpCfg := HTTPConfig{
+		RequestTimeout: *timeout,
+		Retries:        *retries,
+		ProxyURL:       proxyURL,
+	}
+	mpURL := resolveFlag(*marketplaceURL, "MM_MARKETPLACE_URL")
+	if *cacheTTL < 0 {
+		fmt.Fprintln(os.Stderr, "error: --cache-ttl must not be negative.")
 		return ExitConfigError
 	}
 
+	// Validate notifications
+	notifyConditions, err := ParseNotifyConditions(*notifyWhen)
+	if err != nil {
+		return exitWithError(err)
+	}
+	for i, raw := range notifyWebhooks {
+		if notifyWebhooks[i], err = ParseWebhookURL(raw); err != nil {
+			return exitWithError(err)
+		}
+	}
+	if len(notifyWebhooks) == 0 && (*notifyTemplate != "" || *notifySecret != "" || *notifyContentType != "application/json") {
+		fmt.Fprintln(os.Stderr, "error: --notify-template, --notify-content-type and --notify-secret require --notify-webhook.")
+		return ExitConfigError
+	}
+	var email *Email
+	if *emailTo != "" {
+		if email, err = buildEmail(*emailTo, resolveFlag(*emailFrom, "MM_EMAIL_FROM"), *emailSubject, *emailBody, *emailAttach,
+			resolveFlag(*smtpHost, "MM_SMTP_HOST"), resolveFlag(*smtpUsername, "MM_SMTP_USERNAME"), *smtpTLS); err != nil {
+			return exitWithError(err)
+		}
+		email.Columns = columns
+		email.SMTP.Timeout = *timeout
+	} else if *emailFrom != "" || *emailSubject != "" || *emailBody != EmailBodyHTML || *emailAttach != "csv,json" ||
+		*smtpHost != "" || *smtpUsername != "" || *smtpTLS != SMTPStartTLS {
+		fmt.Fprintln(os.Stderr, "error: --email-from, --email-subject, --email-body, --email-attach and the --smtp flags require --email-to.")
+		return ExitConfigError
+	}
+	notifying := len(notifyWebhooks) > 0 || email != nil
+	if !notifying && (*notifyState != "" || *notifyWhen != NotifyAlways) {
+		fmt.Fprintln(os.Stderr, "error: --notify-when and --notify-state require --notify-webhook or --email-to.")
+		return ExitConfigError
+	}
+	var trackerCfg *TrackerConfig
+	if *trackerFlag != "" {
+		trackerCfg = &TrackerConfig{
+			Kind:            *trackerFlag,
+			URL:             resolveFlag(*trackerURL, "MM_TRACKER_URL"),
+			Project:         *trackerProject,
+			Username:        resolveFlag(*trackerUsername, "MM_TRACKER_USERNAME"),
+			Token:           resolveFlag(*trackerToken, "MM_TRACKER_TOKEN"),
+			IssueType:       *trackerIssueType,
+			CloseTransition: *trackerCloseTransition,
+			Label:           *trackerLabel,
+			ServerName:      *trackerServerName,
+		}
+		if err := trackerCfg.Validate(); err != nil {
+			return exitWithError(err)
+		}
+	} else if *trackerURL != "" || *trackerProject != "" || *trackerToken != "" || *trackerUsername != "" || *trackerIssueType != "" ||
+		*trackerCloseTransition != "" || *trackerLabel != DefaultTrackerLabel || *trackerServerName != "" || *trackerDryRun {
+		fmt.Fprintln(os.Stderr, "error: the --tracker-* flags require --tracker.")
+		return ExitConfigError
+	}
+	var cmdb *CMDBSync
+	if u := resolveFlag(*cmdbURL, "MM_CMDB_URL"); u != "" {
+		if _, err := ParseWebhookURL(u); err != nil {
+			return exitWithError(configError(fmt.Sprintf("error: invalid --cmdb-url %q. Use an http:// or https:// URL.", u), err))
+		}
+		if serverURL == "" {
+			return exitWithError(errNoCMDBServer())
+		}
+		cmdb = &CMDBSync{URL: u, Username: resolveFlag(*cmdbUsername, "MM_CMDB_USERNAME"), StatePath: *cmdbState, Full: *cmdbFull}
+		if cmdb.Username != "" {
+			if cmdb.Password = os.Getenv("MM_CMDB_PASSWORD"); cmdb.Password == "" {
+				fmt.Fprintln(os.Stderr, "error: --cmdb-username requires a password. Set the MM_CMDB_PASSWORD environment variable.")
+				return ExitConfigError
+			}
+		} else {
+			cmdb.Token = os.Getenv("MM_CMDB_TOKEN")
+		}
+		if cmdb.StatePath == "" {
+			cmdb.StatePath = serverStatePath(*cacheDir, "cmdb", serverURL)
+		}
+	} else if *cmdbUsername != "" || *cmdbState != "" || *cmdbFull {
+		fmt.Fprintln(os.Stderr, "error: --cmdb-username, --cmdb-state and --cmdb-full require --cmdb-url.")
+		return ExitConfigError
+	}
+	if (notifying || trackerCfg != nil || cmdb != nil) && *interactive {
+		fmt.Fprintln(os.Stderr, "error: --notify-webhook, --email-to, --tracker and --cmdb-url cannot be combined with --interactive.")
+		return ExitConfigError
+	}
+	var notifyTmpl Template
+	if *notifyTemplate != "" {
+		if notifyTmpl, err = LoadTemplate("", *notifyTemplate); err != nil {
+			return exitWithError(err)
+		}
+	}
+
 	// Resolve authentication
 	token := resolveFlag(*tokenFlag, "MM_TOKEN")
 	username := resolveFlag(*usernameFlag, "MM_USERNAME")
 
 	var password string
-	if token == "" && username == "" {
+	socketPath := resolveFlag(*socketPathFlag, "MMCTL_LOCAL_SOCKET_PATH")
+	if *socketPathFlag != "" && !*localMode {
+		fmt.Fprintln(os.Stderr, "error: --socket-path requires --local.")
+		return ExitConfigError
+	}
+	if socketPath == "" {
+		socketPath = DefaultSocketPath
+	}
+	if *supportPacket != "" {
+		if *localMode {
+			fmt.Fprintln(os.Stderr, "error: --from-support-packet cannot be combined with --local.")
+			return ExitConfigError
+		}
+		if *tokenFlag != "" || *usernameFlag != "" {
+			fmt.Fprintln(os.Stderr, "error: --from-support-packet audits offline and cannot be combined with --token or --username.")
+			return ExitConfigError
+		}
+	} else if *localMode {
+		if *tokenFlag != "" || *usernameFlag != "" {
+			fmt.Fprintln(os.Stderr, "error: --local needs no authentication and cannot be combined with --token or --username.")
+			return ExitConfigError
+		}
+	} else if token == "" && username == "" {
 		fmt.Fprintln(os.Stderr, "error: authentication required. Use --token (or MM_TOKEN) for token auth, or --username (or MM_USERNAME) for password auth.")
 		return ExitConfigError
 	}
@@ -87,56 +359,278 @@ func run() int {
 
 	logf := verboseLogger(*verbose)
 
-	// Create Mattermost client
-	logf("Connecting to %s...", serverURL)
-	mmClient, err := NewMMClient(ClientConfig{
-		URL:      serverURL,
-		Token:    token,
-		Username: username,
-		Password: password,
-	})
-	if err != nil {
-		if cliErr, ok := err.(*CLIError); ok {
-			fmt.Fprintln(os.Stderr, cliErr.Message)
-			return cliErr.Code
+	// Cancel in-flight requests on Ctrl-C / SIGTERM, and bound the whole run if requested
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *overallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *overallTimeout)
+		defer cancel()
+	}
+
+	// Create Mattermost client: a live server over the network or the local-mode
+	// socket, or a support packet read offline.
+	// A packet has no Marketplace proxy, so the Marketplace is queried directly.
+	var mmClient MattermostClient
+	platform := *marketplacePlatform
+	if *supportPacket != "" {
+		logf("Reading support packet %s...", *supportPacket)
+		packet, err := OpenSupportPacket(*supportPacket)
+		if err != nil {
+			return exitWithError(err)
+		}
+		mmClient = packet
+		if serverURL == "" {
+			serverURL = packet.SiteURL()
+		}
+		if mpURL == "" {
+			mpURL = DefaultMarketplaceURL
+		}
+		if platform == DefaultMarketplacePlatform && packet.Platform() != "" {
+			platform = packet.Platform()
+		}
+	} else if *localMode {
+		logf("Connecting to local mode socket %s...", socketPath)
+		client, err := NewMMClient(ctx, ClientConfig{SocketPath: socketPath, HTTP: httpCfg, Logf: logf})
+		if err != nil {
+			return exitWithError(err)
+		}
+		mmClient = client
+		if serverURL == "" {
+			serverURL = client.SiteURL(ctx)
+		}
+	} else {
+		logf("Connecting to %s...", serverURL)
+		client, err := NewMMClient(ctx, ClientConfig{
+			URL:      serverURL,
+			Token:    token,
+			Username: username,
+			Password: password,
+			HTTP:     httpCfg,
+			Logf:     logf,
+		})
+		if err != nil {
+			return exitWithError(err)
 		}
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		return ExitAPIError
+		mmClient = client
+	}
+	if trackerCfg != nil && trackerCfg.ServerName == "" && serverURL == "" {
+		return exitWithError(errNoTrackerServer())
 	}
 
-	// Run audit
-	result, err := RunAudit(mmClient, AuditOptions{
-		OutdatedOnly: *outdatedOnly,
-		Verbose:      *verbose,
-	}, logf)
+	// The server version keys the Marketplace query and cache, and is
+	// reported with the results.
+	serverVersion, err := mmClient.GetServerVersion(ctx)
 	if err != nil {
-		if cliErr, ok := err.(*CLIError); ok {
-			fmt.Fprintln(os.Stderr, cliErr.Message)
-			return cliErr.Code
+		logf("Unable to determine server version: %v", err)
+	}
+
+	// Choose where the Marketplace catalogue comes from: the server's proxy
+	// endpoint by default, or a Marketplace queried directly. Either may be
+	// wrapped by the on-disk cache.
+
+	var mpSource MarketplaceSource = mmClient
+	if mpURL == "" {
+		// The server's proxy lists only the latest release of each plugin
+		selected := make(map[string]bool)
+		for _, col := range columns {
+			selected[col.Name] = true
+		}
+		for _, key := range sortKeys {
+			selected[key.Field.Name] = true
+		}
+		if selected["releases_behind"] {
+			fmt.Fprintln(os.Stderr, "warning: releases_behind needs --marketplace-url; the server's Marketplace proxy has no release history, so it is empty.")
+		}
+	} else {
+		logf("Querying Marketplace directly at %s (server version %s, platform %s)", mpURL, displayVersion(serverVersion), platform)
+		httpClient, err := newHTTPClient(httpCfg, logf)
+		if err != nil {
+			return exitWithError(err)
+		}
+		mpSource, err = NewMarketplaceClient(mpURL, httpClient, serverVersion, platform)
+		if err != nil {
+			return exitWithError(err)
 		}
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		return ExitAPIError
+	}
+	if *cacheTTL > 0 || *refreshCache {
+		cache := &MarketplaceCache{Dir: *cacheDir, TTL: *cacheTTL, Refresh: *refreshCache, Logf: logf}
+		var mpPlatform string
+		if mpURL != "" {
+			mpPlatform = platform
+		}
+		cacheServer := serverURL
+		if cacheServer == "" && *localMode {
+			cacheServer = "unix://" + socketPath
+		}
+		mpSource = cache.Wrap(mpSource, cacheServer, serverVersion, mpURL, mpPlatform)
 	}
 
-	// Determine output writer
+	// Determine output writer. Files are written to a temporary sibling and
+	// renamed into place, so an interrupted run never truncates a previous report.
 	var w io.Writer = os.Stdout
-	if *outputFlag != "" {
-		f, err := os.Create(*outputFlag)
+	var outFile *atomicFile
+	if *outputFlag != "" && !*interactive {
+		f, err := createAtomic(*outputFlag)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "warning: unable to write to %s (%v), falling back to stdout\n", *outputFlag, err)
 		} else {
-			defer f.Close()
+			defer f.Abort()
+			outFile = f
 			w = f
 		}
 	}
 
-	// Write output
-	if err := FormatOutput(w, result, format); err != nil {
+	auditOpts := AuditOptions{
+		OutdatedOnly:        *outdatedOnly,
+		IncludeAhead:        *includeAhead,
+		IncludeIncomparable: *includeIncomparable,
+		MinSeverity:         severity,
+		Filter:              filter,
+		SummaryAll:          *summaryAll,
+		Sort:                sortKeys,
+		AuditSettings:       *auditSettingsFlag,
+		AuditServerSettings: *auditServerSettings,
+		FindOrphans:         *orphansFlag,
+		Verbose:             *verbose,
+	}
+	server := &ServerInfo{URL: serverURL, Version: serverVersion, AuditedAt: time.Now().UTC()}
+
+	// NDJSON streams each plugin as it is audited, unless it must be sorted first
+	var stream *NDJSONWriter
+	if format == "ndjson" && len(sortKeys) == 0 && !*interactive {
+		stream = NewNDJSONWriter(w, server, columns)
+		auditOpts.OnReport = func(p PluginReport) error {
+			if err := stream.WritePlugin(p); err != nil {
+				return outputError(fmt.Sprintf("error: failed to write output: %v", err), err)
+			}
+			return nil
+		}
+	}
+
+	// Run audit
+	result, err := RunAudit(ctx, withMarketplace(mmClient, mpSource), auditOpts, logf)
+	if err != nil {
+		return exitWithError(err)
+	}
+	result.Server = server
+
+	if *interactive {
+		if err := runInteractive(ctx, result); err != nil {
+			return exitWithError(err)
+		}
+		return ExitSuccess
+	}
+
+	// Colour and fit the table to the terminal only when writing to one
+	outOpts := OutputOptions{Format: format, Columns: columns, Template: tmpl}
+	isTerminal := outFile == nil && term.IsTerminal(int(os.Stdout.Fd()))
+	outOpts.Color, _ = resolveColor(*colorFlag, isTerminal, os.Getenv("NO_COLOR"))
+	if isTerminal {
+		if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			outOpts.Width = width
+		}
+	}
+
+	// Write output (or, when streaming, just the closing records)
+	if stream != nil {
+		if err = stream.writeExtras(result); err == nil {
+			err = stream.WriteSummary(result.Summary)
+		}
+	} else {
+		err = WriteOutput(w, result, outOpts)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: failed to write output: %v\n", err)
 		return ExitOutputError
 	}
 
-	return ExitSuccess
+	if outFile != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			fmt.Fprintln(os.Stderr, cancelledError(ctx.Err()).Message)
+			return ExitInterrupted
+		}
+		if err := outFile.Commit(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to write output: %v\n", err)
+			return ExitOutputError
+		}
+	}
+
+	// Notify and update the tracker and CMDB once the report is safely written
+	if !notifying && trackerCfg == nil && cmdb == nil {
+		return ExitSuccess
+	}
+	httpClient, err := newHTTPClient(HTTPConfig{RequestTimeout: *timeout, Retries: *retries, ProxyURL: proxyURL}, logf)
+	if err != nil {
+		return exitWithError(err)
+	}
+	code := ExitSuccess
+	if notifying {
+		notification := &Notification{Conditions: notifyConditions, StatePath: *notifyState, Logf: logf}
+		if notification.StatePath == "" {
+			notification.StatePath = defaultNotifyStatePath(*cacheDir, serverURL)
+		}
+		secret := resolveFlag(*notifySecret, "MM_NOTIFY_SECRET")
+		for _, u := range notifyWebhooks {
+			notification.Notifiers = append(notification.Notifiers, &Webhook{
+				URL:         u,
+				Template:    notifyTmpl,
+				ContentType: *notifyContentType,
+				Secret:      secret,
+				Client:      httpClient,
+			})
+		}
+		if email != nil {
+			notification.Notifiers = append(notification.Notifiers, email)
+		}
+		if err := notification.Run(ctx, result); err != nil {
+			code = exitWithError(err)
+		}
+	}
+	if trackerCfg != nil {
+		sync := &TrackerSync{
+			Tracker:    NewIssueTracker(*trackerCfg, httpClient),
+			ServerName: trackerCfg.ServerName,
+			Wiki:       trackerCfg.Kind == TrackerJira,
+			DryRun:     *trackerDryRun,
+			Logf:       logf,
+		}
+		if *trackerDryRun {
+			// A dry run exists to show its plan, so print it without -v
+			sync.Logf = func(format string, args ...interface{}) { fmt.Fprintf(logOutput, format+"\n", args...) }
+		}
+		if err := sync.Run(ctx, result); err != nil {
+			code = exitWithError(err)
+		}
+	}
+	if cmdb != nil {
+		cmdb.Client, cmdb.Logf = httpClient, logf
+		if err := cmdb.Run(ctx, result); err != nil {
+			code = exitWithError(err)
+		}
+	}
+	return code
+}
+
+// exitWithError prints err to stderr and returns the matching exit code.
+func exitWithError(err error) int {
+	if cliErr, ok := err.(*CLIError); ok {
+		fmt.Fprintln(os.Stderr, cliErr.Message)
+		return cliErr.Code
+	}
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	return ExitAPIError
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 // resolveFlag returns the flag value if set, otherwise falls back to the environment variable.
@@ -1,7 +1,158 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// MarketplaceSource supplies the Marketplace catalogue, keyed by plugin ID.
+type MarketplaceSource interface {
+	GetMarketplacePlugins(ctx context.Context) (map[string]*MarketplacePlugin, error)
+}
+
 // MarketplacePlugin represents the relevant fields from a Marketplace plugin entry.
 type MarketplacePlugin struct {
-	Version     string
-	HomepageURL string
+	Version         string   `json:"version"`
+	HomepageURL     string   `json:"homepage_url"`
+	ReleaseNotesURL string   `json:"release_notes_url,omitempty"` // For the latest version
+	Versions        []string `json:"versions,omitempty"`          // Release history, when the source provides it
+}
+
+// DefaultMarketplaceURL is the public Mattermost Marketplace API.
+const DefaultMarketplaceURL = "https://api.integrations.mattermost.com"
+
+// DefaultMarketplacePlatform is the server platform assumed when filtering the
+// Marketplace catalogue, matching the overwhelmingly common deployment.
+const DefaultMarketplacePlatform = "linux-amd64"
+
+// MarketplaceClient queries a Marketplace server (the public Marketplace or a
+// self-hosted one) directly, bypassing the Mattermost server's proxy endpoint.
+type MarketplaceClient struct {
+	baseURL       string
+	httpClient    *http.Client
+	serverVersion string
+	platform      string
+}
+
+// NewMarketplaceClient creates a client for the Marketplace at baseURL. The
+// serverVersion and platform filters select the releases compatible with the
+// audited server; either may be empty.
+func NewMarketplaceClient(baseURL string, httpClient *http.Client, serverVersion, platform string) (*MarketplaceClient, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, configError(fmt.Sprintf("error: invalid Marketplace URL %q.", baseURL), err)
+	}
+	return &MarketplaceClient{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		httpClient:    httpClient,
+		serverVersion: serverVersion,
+		platform:      platform,
+	}, nil
+}
+
+// GetMarketplacePlugins fetches the full catalogue, page by page, including
+// each plugin's release history so the audit can count releases behind.
+func (c *MarketplaceClient) GetMarketplacePlugins(ctx context.Context) (map[string]*MarketplacePlugin, error) {
+	plugins, err := c.ListPlugins(ctx, c.serverVersion, true)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*MarketplacePlugin)
+	for _, p := range plugins {
+		if p.Manifest == nil {
+			continue
+		}
+		entry, ok := result[p.Manifest.Id]
+		if !ok {
+			entry = &MarketplacePlugin{}
+			result[p.Manifest.Id] = entry
+		}
+		entry.Versions = append(entry.Versions, p.Manifest.Version)
+		if cmp, _ := CompareVersions(entry.Version, p.Manifest.Version); entry.Version == "" || cmp < 0 {
+			entry.Version = p.Manifest.Version
+			entry.HomepageURL = p.HomepageURL
+			entry.ReleaseNotesURL = p.ReleaseNotesURL
+		}
+	}
+	return result, nil
+}
+
+// ListPlugins returns the raw Marketplace entries compatible with serverVersion.
+// With allVersions, every published release is returned rather than only the latest.
+func (c *MarketplaceClient) ListPlugins(ctx context.Context, serverVersion string, allVersions bool) ([]*model.BaseMarketplacePlugin, error) {
+	var result []*model.BaseMarketplacePlugin
+
+	page := 0
+	perPage := 200
+	for {
+		plugins, err := c.fetchPage(ctx, &model.MarketplacePluginFilter{
+			Page:                 page,
+			PerPage:              perPage,
+			ServerVersion:        serverVersion,
+			Platform:             c.platform,
+			BuildEnterpriseReady: true,
+			EnterprisePlugins:    true,
+			ReturnAllVersions:    allVersions,
+		})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, plugins...)
+
+		if len(plugins) < perPage {
+			break
+		}
+		page++
+	}
+
+	return result, nil
+}
+
+func (c *MarketplaceClient) fetchPage(ctx context.Context, filter *model.MarketplacePluginFilter) ([]*model.BaseMarketplacePlugin, error) {
+	u := c.baseURL + "/api/v1/plugins?" + filter.ToValues().Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, marketplaceError(fmt.Sprintf("error: invalid Marketplace URL %q.", c.baseURL), err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, classifyMarketplaceError(c.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, marketplaceError(
+			fmt.Sprintf("error: the Marketplace at %s returned HTTP %d.", c.baseURL, resp.StatusCode),
+			nil,
+		)
+	}
+
+	plugins, err := model.BaseMarketplacePluginsFromReader(resp.Body)
+	if err != nil {
+		return nil, marketplaceError(fmt.Sprintf("error: unexpected response from the Marketplace at %s.", c.baseURL), err)
+	}
+	return plugins, nil
+}
+
+// classifyMarketplaceError maps transport failures to CLIErrors.
+func classifyMarketplaceError(baseURL string, err error) *CLIError {
+	if errors.Is(err, context.Canceled) {
+		return cancelledError(err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return marketplaceError(fmt.Sprintf("error: timed out waiting for the Marketplace at %s.", baseURL), err)
+	}
+	return marketplaceError(
+		fmt.Sprintf("error: unable to reach the Marketplace at %s. Check network connectivity or proxy settings.", baseURL),
+		err,
+	)
 }
@@ -1,7 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
 )
 
 func TestMarketplacePlugin_Struct(t *testing.T) {
@@ -16,3 +25,129 @@ func TestMarketplacePlugin_Struct(t *testing.T) {
 		t.Errorf("unexpected HomepageURL: %s", mp.HomepageURL)
 	}
 }
+
+// marketplaceServer serves count plugins from a fake Marketplace, recording the query of each request.
+func marketplaceServer(t *testing.T, count int, queries *[]url.Values) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/plugins" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		*queries = append(*queries, q)
+
+		page, _ := strconv.Atoi(q.Get("page"))
+		perPage, _ := strconv.Atoi(q.Get("per_page"))
+		var plugins []*model.BaseMarketplacePlugin
+		for i := page * perPage; i < count && i < (page+1)*perPage; i++ {
+			plugins = append(plugins, &model.BaseMarketplacePlugin{
+				HomepageURL: fmt.Sprintf("https://github.com/example/plugin-%d", i),
+				Manifest:    &model.Manifest{Id: fmt.Sprintf("plugin-%d", i), Version: "1.0.0"},
+			})
+		}
+		json.NewEncoder(w).Encode(plugins)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMarketplaceClient_Pagination(t *testing.T) {
+	var queries []url.Values
+	srv := marketplaceServer(t, 250, &queries)
+
+	client, err := NewMarketplaceClient(srv.URL+"/", srv.Client(), "10.5.0", "linux-arm64")
+	if err != nil {
+		t.Fatalf("NewMarketplaceClient() returned error: %v", err)
+	}
+
+	plugins, err := client.GetMarketplacePlugins(context.Background())
+	if err != nil {
+		t.Fatalf("GetMarketplacePlugins() returned error: %v", err)
+	}
+
+	if len(plugins) != 250 {
+		t.Errorf("expected 250 plugins across pages, got %d", len(plugins))
+	}
+	if len(queries) != 2 {
+		t.Fatalf("expected 2 page requests, got %d", len(queries))
+	}
+	if queries[0].Get("server_version") != "10.5.0" {
+		t.Errorf("expected server_version filter 10.5.0, got %q", queries[0].Get("server_version"))
+	}
+	if queries[0].Get("platform") != "linux-arm64" {
+		t.Errorf("expected platform filter linux-arm64, got %q", queries[0].Get("platform"))
+	}
+	if p := plugins["plugin-7"]; p == nil || p.HomepageURL != "https://github.com/example/plugin-7" {
+		t.Errorf("unexpected entry for plugin-7: %+v", p)
+	}
+}
+
+func TestMarketplaceClient_HTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	client, _ := NewMarketplaceClient(srv.URL, srv.Client(), "", "")
+	_, err := client.GetMarketplacePlugins(context.Background())
+
+	cliErr, ok := err.(*CLIError)
+	if !ok {
+		t.Fatalf("expected *CLIError, got %T", err)
+	}
+	if cliErr.Code != ExitMarketplaceError {
+		t.Errorf("expected exit code %d, got %d", ExitMarketplaceError, cliErr.Code)
+	}
+}
+
+func TestMarketplaceClient_Unreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	client, _ := NewMarketplaceClient(srv.URL, &http.Client{}, "", "")
+	_, err := client.GetMarketplacePlugins(context.Background())
+
+	cliErr, ok := err.(*CLIError)
+	if !ok || cliErr.Code != ExitMarketplaceError {
+		t.Errorf("expected marketplace error for unreachable Marketplace, got %v", err)
+	}
+}
+
+func TestNewMarketplaceClient_InvalidURL(t *testing.T) {
+	for _, u := range []string{"", "api.integrations.mattermost.com", "ftp://example.com"} {
+		_, err := NewMarketplaceClient(u, &http.Client{}, "", "")
+		cliErr, ok := err.(*CLIError)
+		if !ok || cliErr.Code != ExitConfigError {
+			t.Errorf("NewMarketplaceClient(%q): expected config error, got %v", u, err)
+		}
+	}
+}
+
+func TestMarketplaceClient_VersionHistory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("return_all_versions") != "true" {
+			t.Errorf("expected return_all_versions=true, got %q", r.URL.Query().Get("return_all_versions"))
+		}
+		json.NewEncoder(w).Encode([]*model.BaseMarketplacePlugin{
+			{HomepageURL: "old", Manifest: &model.Manifest{Id: "com.mattermost.confluence", Version: "1.3.0"}},
+			{HomepageURL: "new", Manifest: &model.Manifest{Id: "com.mattermost.confluence", Version: "1.10.0"}},
+			{HomepageURL: "mid", Manifest: &model.Manifest{Id: "com.mattermost.confluence", Version: "1.9.0"}},
+		})
+	}))
+	defer srv.Close()
+
+	client, _ := NewMarketplaceClient(srv.URL, srv.Client(), "", "")
+	plugins, err := client.GetMarketplacePlugins(context.Background())
+	if err != nil {
+		t.Fatalf("GetMarketplacePlugins() returned error: %v", err)
+	}
+
+	p := plugins["com.mattermost.confluence"]
+	if p == nil || p.Version != "1.10.0" || p.HomepageURL != "new" {
+		t.Fatalf("expected latest release 1.10.0, got %+v", p)
+	}
+	if len(p.Versions) != 3 {
+		t.Errorf("expected 3 versions in history, got %v", p.Versions)
+	}
+}
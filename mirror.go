@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// mirrorIndexFile is the catalogue written by the mirror command and served at /api/v1/plugins.
+const mirrorIndexFile = "index.json"
+
+// DefaultMirrorListen is the address the built-in mirror server listens on.
+const DefaultMirrorListen = ":8085"
+
+// MirrorOptions controls which parts of the Marketplace are mirrored.
+type MirrorOptions struct {
+	Dir            string   // Destination directory
+	ServerVersions []string // Mirror the latest release compatible with each of these; empty means latest overall
+	PluginIDs      []string // Restrict the mirror to these plugin IDs; empty means all
+	AllVersions    bool     // Mirror every published release, not only the latest
+	BaseURL        string   // Absolute URL the mirror will be served at; empty writes relative download URLs
+}
+
+// BuildMirror downloads the selected Marketplace entries, their bundles and
+// signatures into opts.Dir and writes an index that a Mattermost server's
+// MarketplaceURL (or --marketplace-url) can point at. It returns the number of
+// releases mirrored.
+func BuildMirror(ctx context.Context, mp *MarketplaceClient, httpClient *http.Client, opts MirrorOptions, logf func(string, ...interface{})) (int, error) {
+	serverVersions := opts.ServerVersions
+	if len(serverVersions) == 0 {
+		serverVersions = []string{""}
+	}
+	wanted := make(map[string]bool)
+	for _, id := range opts.PluginIDs {
+		wanted[id] = true
+	}
+
+	// Collect the releases needed across every server version, de-duplicated
+	releases := make(map[string]*model.BaseMarketplacePlugin)
+	for _, sv := range serverVersions {
+		logf("Fetching Marketplace catalogue for server version %s...", displayVersion(sv))
+		entries, err := mp.ListPlugins(ctx, sv, opts.AllVersions)
+		if err != nil {
+			return 0, err
+		}
+		for _, e := range entries {
+			if e.Manifest == nil || (len(wanted) > 0 && !wanted[e.Manifest.Id]) {
+				continue
+			}
+			releases[e.Manifest.Id+"@"+e.Manifest.Version] = e
+		}
+	}
+	for id := range wanted {
+		if !mirrorHasPlugin(releases, id) {
+			fmt.Fprintf(logOutput, "warning: plugin %s was not found in the Marketplace\n", id)
+		}
+	}
+
+	if mp.platform != "" && !safePathComponent(mp.platform) {
+		return 0, configError(fmt.Sprintf("error: invalid --platform %q.", mp.platform), nil)
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return 0, outputError(fmt.Sprintf("error: unable to create mirror directory %s.", opts.Dir), err)
+	}
+
+	var index []*model.BaseMarketplacePlugin
+	for _, e := range releases {
+		if e.DownloadURL == "" {
+			logf("Skipping %s %s: no download URL", e.Manifest.Id, e.Manifest.Version)
+			continue
+		}
+
+		if !safePathComponent(e.Manifest.Id) || !safePathComponent(e.Manifest.Version) {
+			fmt.Fprintf(logOutput, "warning: skipping release with unsafe plugin ID or version %q %q\n", e.Manifest.Id, e.Manifest.Version)
+			continue
+		}
+
+		bundlePath := mirrorBundlePath(e.Manifest.Id, mp.platform, e.Manifest.Version)
+		if err := mirrorDownload(ctx, httpClient, e.DownloadURL, filepath.Join(opts.Dir, filepath.FromSlash(bundlePath)), logf); err != nil {
+			return 0, err
+		}
+		if e.Signature != "" {
+			sig, err := base64.StdEncoding.DecodeString(e.Signature)
+			if err != nil {
+				return 0, marketplaceError(fmt.Sprintf("error: invalid signature for %s %s.", e.Manifest.Id, e.Manifest.Version), err)
+			}
+			if err := writeFileAtomic(filepath.Join(opts.Dir, filepath.FromSlash(bundlePath+".sig")), sig); err != nil {
+				return 0, outputError("error: unable to write plugin signature.", err)
+			}
+		}
+
+		entry := *e
+		entry.DownloadURL = bundlePath
+		if opts.BaseURL != "" {
+			entry.DownloadURL = strings.TrimRight(opts.BaseURL, "/") + "/" + bundlePath
+		}
+		index = append(index, &entry)
+	}
+
+	sortMirrorIndex(index)
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(filepath.Join(opts.Dir, mirrorIndexFile), data); err != nil {
+		return 0, outputError("error: unable to write mirror index.", err)
+	}
+	logf("Wrote %s with %d release(s)", filepath.Join(opts.Dir, mirrorIndexFile), len(index))
+
+	return len(index), nil
+}
+
+func mirrorHasPlugin(releases map[string]*model.BaseMarketplacePlugin, id string) bool {
+	for _, e := range releases {
+		if e.Manifest.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// safePathComponent reports whether s can be used as a single path element.
+func safePathComponent(s string) bool {
+	return s != "" && s != "." && !strings.Contains(s, "..") && !strings.ContainsAny(s, `/\`)
+}
+
+// mirrorBundlePath is the slash-separated path of a bundle relative to the
+// mirror root. Bundles differ by platform, so each platform gets its own
+// directory and a rebuild for another platform never reuses a bundle that
+// doesn't match its new signature.
+func mirrorBundlePath(id, platform, version string) string {
+	return path.Join("plugins", id, platform, id+"-"+version+".tar.gz")
+}
+
+// mirrorDownload fetches url into dest, skipping bundles that are already present.
+func mirrorDownload(ctx context.Context, httpClient *http.Client, url, dest string, logf func(string, ...interface{})) error {
+	if _, err := os.Stat(dest); err == nil {
+		logf("Already mirrored: %s", dest)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return outputError(fmt.Sprintf("error: unable to create %s.", filepath.Dir(dest)), err)
+	}
+
+	logf("Downloading %s", url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return marketplaceError(fmt.Sprintf("error: invalid download URL %q.", url), err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return classifyMarketplaceError(url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return marketplaceError(fmt.Sprintf("error: downloading %s returned HTTP %d.", url, resp.StatusCode), nil)
+	}
+
+	f, err := createAtomic(dest)
+	if err != nil {
+		return outputError(fmt.Sprintf("error: unable to write %s.", dest), err)
+	}
+	defer f.Abort()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		if ctx.Err() != nil {
+			return cancelledError(ctx.Err())
+		}
+		return marketplaceError(fmt.Sprintf("error: download of %s was interrupted.", url), err)
+	}
+	if err := f.Commit(); err != nil {
+		return outputError(fmt.Sprintf("error: unable to write %s.", dest), err)
+	}
+	return nil
+}
+
+// sortMirrorIndex orders entries by plugin ID, newest release first.
+func sortMirrorIndex(index []*model.BaseMarketplacePlugin) {
+	sort.SliceStable(index, func(i, j int) bool {
+		if index[i].Manifest.Id != index[j].Manifest.Id {
+			return index[i].Manifest.Id < index[j].Manifest.Id
+		}
+		cmp, ok := CompareVersions(index[i].Manifest.Version, index[j].Manifest.Version)
+		if !ok {
+			return index[i].Manifest.Version > index[j].Manifest.Version
+		}
+		return cmp > 0
+	})
+}
+
+// mirrorHandler serves a mirror directory using the Marketplace API's
+// /api/v1/plugins contract, plus the mirrored bundles themselves.
+type mirrorHandler struct {
+	index []*model.BaseMarketplacePlugin
+	files http.Handler
+}
+
+// newMirrorHandler loads the index from dir.
+func newMirrorHandler(dir string) (*mirrorHandler, error) {
+	data, err := os.ReadFile(filepath.Join(dir, mirrorIndexFile))
+	if err != nil {
+		return nil, configError(fmt.Sprintf("error: %s is not a mirror directory (missing %s). Run the mirror command first.", dir, mirrorIndexFile), err)
+	}
+	var index []*model.BaseMarketplacePlugin
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, configError(fmt.Sprintf("error: unable to parse %s.", filepath.Join(dir, mirrorIndexFile)), err)
+	}
+	return &mirrorHandler{
+		index: index,
+		files: http.StripPrefix("/plugins/", http.FileServer(http.Dir(filepath.Join(dir, "plugins")))),
+	}, nil
+}
+
+func (h *mirrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/api/v1/plugins":
+		h.serveCatalogue(w, r)
+	case strings.HasPrefix(r.URL.Path, "/plugins/"):
+		h.files.ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveCatalogue answers a Marketplace query, honouring the filters a
+// Mattermost server sends: plugin_id, filter, server_version,
+// return_all_versions, page and per_page.
+func (h *mirrorHandler) serveCatalogue(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pluginID := q.Get("plugin_id")
+	search := strings.ToLower(q.Get("filter"))
+	serverVersion := q.Get("server_version")
+	allVersions, _ := strconv.ParseBool(q.Get("return_all_versions"))
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	perPage, err := strconv.Atoi(q.Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = 100
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	seen := make(map[string]bool)
+	var matches []*model.BaseMarketplacePlugin
+	for _, e := range h.index {
+		m := e.Manifest
+		if pluginID != "" && m.Id != pluginID {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(m.Id+" "+m.Name+" "+m.Description), search) {
+			continue
+		}
+		if serverVersion != "" && m.MinServerVersion != "" {
+			if cmp, ok := CompareVersions(m.MinServerVersion, serverVersion); ok && cmp > 0 {
+				continue
+			}
+		}
+		// The index is sorted newest first, so the first match per plugin is the latest
+		if !allVersions {
+			if seen[m.Id] {
+				continue
+			}
+			seen[m.Id] = true
+		}
+
+		entry := *e
+		entry.DownloadURL = absoluteDownloadURL(r, e.DownloadURL)
+		matches = append(matches, &entry)
+	}
+
+	start := page * perPage
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := start + perPage
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(append([]*model.BaseMarketplacePlugin{}, matches[start:end]...))
+}
+
+// absoluteDownloadURL resolves a relative bundle path against the request's own origin.
+func absoluteDownloadURL(r *http.Request, downloadURL string) string {
+	if strings.Contains(downloadURL, "://") {
+		return downloadURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + "/" + strings.TrimLeft(downloadURL, "/")
+}
+
+// runMirror implements the "mirror" subcommand.
+func runMirror(args []string) int {
+	fs := flag.NewFlagSet("mirror", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mm-plugin-audit mirror --dir DIR [flags]")
+		fmt.Fprintln(fs.Output(), "       mm-plugin-audit mirror --serve --dir DIR [--listen ADDR]")
+		fs.PrintDefaults()
+	}
+	dir := fs.String("dir", "", "Mirror directory (required)")
+	marketplaceURL := fs.String("marketplace-url", DefaultMarketplaceURL, "Marketplace to mirror from")
+	platform := fs.String("platform", DefaultMarketplacePlatform, "Server platform whose bundles are mirrored")
+	serverVersions := fs.String("server-versions", "", "Comma-separated server versions whose latest compatible releases are mirrored")
+	pluginIDs := fs.String("plugins", "", "Comma-separated plugin IDs to mirror (default: all)")
+	allVersions := fs.Bool("all-versions", false, "Mirror every published release rather than only the latest")
+	baseURL := fs.String("base-url", "", "Absolute URL the mirror is served at (default: resolved per request by --serve)")
+	serve := fs.Bool("serve", false, "Serve an existing mirror directory over HTTP")
+	listen := fs.String("listen", DefaultMirrorListen, "Listen address for --serve")
+	timeout := fs.Duration("timeout", DefaultRequestTimeout, "Timeout for each request attempt (0 to disable)")
+	retries := fs.Int("retries", DefaultRetries, "Retries for rate-limited, 5xx or reset requests")
+	proxyFlag := fs.String("proxy", "", "HTTP(S) proxy URL (or set MM_PROXY)")
+	verbose := fs.Bool("verbose", false, "Enable verbose logging to stderr")
+	fs.BoolVar(verbose, "v", false, "Enable verbose logging to stderr")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitSuccess
+		}
+		return ExitConfigError
+	}
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "error: --dir is required.")
+		return ExitConfigError
+	}
+
+	logf := verboseLogger(*verbose)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *serve {
+		return serveMirror(ctx, *dir, *listen)
+	}
+
+	httpClient, err := newHTTPClient(HTTPConfig{
+		RequestTimeout: *timeout,
+		Retries:        *retries,
+		ProxyURL:       resolveFlag(*proxyFlag, "MM_PROXY"),
+	}, logf)
+	if err != nil {
+		return exitWithError(err)
+	}
+	mp, err := NewMarketplaceClient(*marketplaceURL, httpClient, "", *platform)
+	if err != nil {
+		return exitWithError(err)
+	}
+
+	count, err := BuildMirror(ctx, mp, httpClient, MirrorOptions{
+		Dir:            *dir,
+		ServerVersions: splitList(*serverVersions),
+		PluginIDs:      splitList(*pluginIDs),
+		AllVersions:    *allVersions,
+		BaseURL:        *baseURL,
+	}, logf)
+	if err != nil {
+		return exitWithError(err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Mirrored %d plugin release(s) into %s\n", count, *dir)
+	return ExitSuccess
+}
+
+// serveMirror serves dir until ctx is cancelled.
+func serveMirror(ctx context.Context, dir, listen string) int {
+	handler, err := newMirrorHandler(dir)
+	if err != nil {
+		return exitWithError(err)
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: unable to listen on %s: %v\n", listen, err)
+		return ExitConfigError
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving Marketplace mirror of %d release(s) from %s on http://%s\n", len(handler.index), dir, ln.Addr())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "error: mirror server failed: %v\n", err)
+		return ExitAPIError
+	}
+	return ExitSuccess
+}
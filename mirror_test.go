@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// upstreamMarketplace is a fake Marketplace that also serves plugin bundles.
+func upstreamMarketplace(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/plugins":
+			all := []*model.BaseMarketplacePlugin{
+				{
+					HomepageURL: "https://github.com/mattermost/mattermost-plugin-confluence",
+					DownloadURL: srv.URL + "/bundles/confluence-1.4.0.tar.gz",
+					Signature:   base64.StdEncoding.EncodeToString([]byte("sig-1.4.0")),
+					Manifest:    &model.Manifest{Id: "com.mattermost.confluence", Name: "Confluence", Version: "1.4.0", MinServerVersion: "10.0.0"},
+				},
+				{
+					HomepageURL: "https://github.com/mattermost/mattermost-plugin-confluence",
+					DownloadURL: srv.URL + "/bundles/confluence-1.3.0.tar.gz",
+					Manifest:    &model.Manifest{Id: "com.mattermost.confluence", Name: "Confluence", Version: "1.3.0", MinServerVersion: "9.0.0"},
+				},
+				{
+					HomepageURL: "https://github.com/mattermost/mattermost-plugin-welcomebot",
+					DownloadURL: srv.URL + "/bundles/welcomebot-1.2.0.tar.gz",
+					Manifest:    &model.Manifest{Id: "com.mattermost.welcomebot", Name: "WelcomeBot", Version: "1.2.0"},
+				},
+			}
+			q := r.URL.Query()
+			allVersions, _ := strconv.ParseBool(q.Get("return_all_versions"))
+			seen := map[string]bool{}
+			var out []*model.BaseMarketplacePlugin
+			for _, p := range all {
+				sv := q.Get("server_version")
+				if cmp, _ := CompareVersions(p.Manifest.MinServerVersion, sv); sv != "" && p.Manifest.MinServerVersion != "" && cmp > 0 {
+					continue
+				}
+				if !allVersions && seen[p.Manifest.Id] {
+					continue
+				}
+				seen[p.Manifest.Id] = true
+				out = append(out, p)
+			}
+			json.NewEncoder(w).Encode(out)
+		default:
+			io.WriteString(w, "bundle:"+filepath.Base(r.URL.Path))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBuildMirror(t *testing.T) {
+	upstream := upstreamMarketplace(t)
+	dir := t.TempDir()
+
+	mp, _ := NewMarketplaceClient(upstream.URL, upstream.Client(), "", "linux-amd64")
+	count, err := BuildMirror(context.Background(), mp, upstream.Client(), MirrorOptions{
+		Dir:            dir,
+		ServerVersions: []string{"9.11.0", "10.5.0"},
+	}, noopLogger)
+	if err != nil {
+		t.Fatalf("BuildMirror() returned error: %v", err)
+	}
+
+	// Confluence 1.3.0 (for 9.11), Confluence 1.4.0 (for 10.5), WelcomeBot 1.2.0 (both)
+	if count != 3 {
+		t.Errorf("expected 3 releases mirrored, got %d", count)
+	}
+
+	bundle, err := os.ReadFile(filepath.Join(dir, "plugins", "com.mattermost.confluence", "linux-amd64", "com.mattermost.confluence-1.4.0.tar.gz"))
+	if err != nil || string(bundle) != "bundle:confluence-1.4.0.tar.gz" {
+		t.Errorf("expected Confluence 1.4.0 bundle to be mirrored, got %q (%v)", bundle, err)
+	}
+	sig, err := os.ReadFile(filepath.Join(dir, "plugins", "com.mattermost.confluence", "linux-amd64", "com.mattermost.confluence-1.4.0.tar.gz.sig"))
+	if err != nil || string(sig) != "sig-1.4.0" {
+		t.Errorf("expected decoded signature to be mirrored, got %q (%v)", sig, err)
+	}
+
+	var index []*model.BaseMarketplacePlugin
+	data, _ := os.ReadFile(filepath.Join(dir, mirrorIndexFile))
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("index is not valid JSON: %v", err)
+	}
+	if len(index) != 3 || index[0].Manifest.Version != "1.4.0" || index[1].Manifest.Version != "1.3.0" {
+		t.Errorf("expected index sorted by ID, newest first; got %d entries", len(index))
+	}
+	if index[0].DownloadURL != "plugins/com.mattermost.confluence/linux-amd64/com.mattermost.confluence-1.4.0.tar.gz" {
+		t.Errorf("expected relative download URL, got %q", index[0].DownloadURL)
+	}
+}
+
+func TestBuildMirror_OtherPlatform(t *testing.T) {
+	upstream := upstreamMarketplace(t)
+	dir := t.TempDir()
+	for _, platform := range []string{"linux-amd64", "linux-arm64"} {
+		mp, _ := NewMarketplaceClient(upstream.URL, upstream.Client(), "", platform)
+		if _, err := BuildMirror(context.Background(), mp, upstream.Client(), MirrorOptions{Dir: dir}, noopLogger); err != nil {
+			t.Fatalf("BuildMirror(%s) returned error: %v", platform, err)
+		}
+	}
+
+	// The second build downloads its own bundle next to its signature
+	for _, platform := range []string{"linux-amd64", "linux-arm64"} {
+		bundle := filepath.Join(dir, "plugins", "com.mattermost.confluence", platform, "com.mattermost.confluence-1.4.0.tar.gz")
+		for _, name := range []string{bundle, bundle + ".sig"} {
+			if _, err := os.Stat(name); err != nil {
+				t.Errorf("missing %s: %v", name, err)
+			}
+		}
+	}
+	var index []*model.BaseMarketplacePlugin
+	data, _ := os.ReadFile(filepath.Join(dir, mirrorIndexFile))
+	json.Unmarshal(data, &index)
+	if len(index) == 0 || !strings.Contains(index[0].DownloadURL, "/linux-arm64/") {
+		t.Errorf("index does not point at the rebuilt platform's bundles: %+v", index)
+	}
+
+	mp, _ := NewMarketplaceClient(upstream.URL, upstream.Client(), "", "../linux")
+	_, err := BuildMirror(context.Background(), mp, upstream.Client(), MirrorOptions{Dir: dir}, noopLogger)
+	if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitConfigError {
+		t.Errorf("expected a config error for an unsafe platform, got %v", err)
+	}
+}
+
+func TestBuildMirror_PluginFilterAndBaseURL(t *testing.T) {
+	upstream := upstreamMarketplace(t)
+	dir := t.TempDir()
+
+	mp, _ := NewMarketplaceClient(upstream.URL, upstream.Client(), "", "")
+	count, err := BuildMirror(context.Background(), mp, upstream.Client(), MirrorOptions{
+		Dir:       dir,
+		PluginIDs: []string{"com.mattermost.welcomebot"},
+		BaseURL:   "https://mirror.internal/",
+	}, noopLogger)
+	if err != nil {
+		t.Fatalf("BuildMirror() returned error: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 release mirrored, got %d", count)
+	}
+
+	var index []*model.BaseMarketplacePlugin
+	data, _ := os.ReadFile(filepath.Join(dir, mirrorIndexFile))
+	json.Unmarshal(data, &index)
+	want := "https://mirror.internal/plugins/com.mattermost.welcomebot/com.mattermost.welcomebot-1.2.0.tar.gz"
+	if index[0].DownloadURL != want {
+		t.Errorf("download URL = %q, want %q", index[0].DownloadURL, want)
+	}
+}
+
+func TestMirrorHandler_ActsAsMarketplace(t *testing.T) {
+	upstream := upstreamMarketplace(t)
+	dir := t.TempDir()
+	mp, _ := NewMarketplaceClient(upstream.URL, upstream.Client(), "", "")
+	if _, err := BuildMirror(context.Background(), mp, upstream.Client(), MirrorOptions{Dir: dir, AllVersions: true}, noopLogger); err != nil {
+		t.Fatalf("BuildMirror() returned error: %v", err)
+	}
+
+	handler, err := newMirrorHandler(dir)
+	if err != nil {
+		t.Fatalf("newMirrorHandler() returned error: %v", err)
+	}
+	mirror := httptest.NewServer(handler)
+	defer mirror.Close()
+
+	// The audit's direct Marketplace client sees the latest compatible release
+	client, _ := NewMarketplaceClient(mirror.URL, mirror.Client(), "9.11.0", "linux-amd64")
+	catalogue, err := client.GetMarketplacePlugins(context.Background())
+	if err != nil {
+		t.Fatalf("GetMarketplacePlugins() against mirror returned error: %v", err)
+	}
+	if catalogue["com.mattermost.confluence"] == nil || catalogue["com.mattermost.confluence"].Version != "1.3.0" {
+		t.Errorf("expected Confluence 1.3.0 for server 9.11.0, got %+v", catalogue["com.mattermost.confluence"])
+	}
+
+	// Download URLs resolve against the mirror and serve the bundle
+	entries, _ := client.ListPlugins(context.Background(), "", false)
+	if len(entries) != 2 {
+		t.Fatalf("expected latest release per plugin, got %d entries", len(entries))
+	}
+	resp, err := mirror.Client().Get(entries[0].DownloadURL)
+	if err != nil {
+		t.Fatalf("fetching %s: %v", entries[0].DownloadURL, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "bundle:confluence-1.4.0.tar.gz" {
+		t.Errorf("unexpected bundle from mirror: %q", body)
+	}
+}
+
+func TestNewMirrorHandler_MissingIndex(t *testing.T) {
+	_, err := newMirrorHandler(t.TempDir())
+	cliErr, ok := err.(*CLIError)
+	if !ok || cliErr.Code != ExitConfigError {
+		t.Errorf("expected config error for a directory without an index, got %v", err)
+	}
+}
+
+func TestSafePathComponent(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect bool
+	}{
+		{"com.mattermost.confluence", true},
+		{"1.4.0", true},
+		{"", false},
+		{"..", false},
+		{"../etc", false},
+		{"a/b", false},
+		{`a\b`, false},
+	}
+	for _, tt := range tests {
+		if got := safePathComponent(tt.input); got != tt.expect {
+			t.Errorf("safePathComponent(%q) = %v, want %v", tt.input, got, tt.expect)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// NDJSON record types, in the record_type field of every line.
+const (
+	ndjsonRecordPlugin         = "plugin"
+	ndjsonRecordServerSettings = "server_plugin_settings"
+	ndjsonRecordOrphan         = "orphan"
+	ndjsonRecordSummary        = "summary"
+)
+
+// ndjsonEnvelope is the metadata leading every NDJSON record, so each line
+// stands alone once it reaches a log pipeline.
+type ndjsonEnvelope struct {
+	RecordType    string     `json:"record_type"`
+	ServerURL     string     `json:"server_url"`
+	ServerVersion string     `json:"server_version"`
+	AuditedAt     *time.Time `json:"audited_at"`
+}
+
+// NDJSONWriter writes audit results as newline-delimited JSON: one compact
+// object per plugin, then the server plugin settings and orphans if audited,
+// then a summary record. Plugins can be written one at a time as they are audited.
+type NDJSONWriter struct {
+	w       io.Writer
+	server  *ServerInfo
+	columns []reportField
+}
+
+// NewNDJSONWriter returns a writer that stamps records with server, if set, and
+// limits plugin records to columns, if any.
+func NewNDJSONWriter(w io.Writer, server *ServerInfo, columns []reportField) *NDJSONWriter {
+	return &NDJSONWriter{w: w, server: server, columns: columns}
+}
+
+// WritePlugin writes one plugin record.
+func (n *NDJSONWriter) WritePlugin(p PluginReport) error {
+	var body []byte
+	var err error
+	if len(n.columns) > 0 {
+		body, err = jsonColumnsObject(p, n.columns)
+	} else {
+		body, err = json.Marshal(newJSONPlugin(p))
+	}
+	if err != nil {
+		return err
+	}
+	return n.writeRecord(ndjsonRecordPlugin, body)
+}
+
+// WriteServerSettings writes the server plugin settings record.
+func (n *NDJSONWriter) WriteServerSettings(report *ServerSettingsReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return n.writeRecord(ndjsonRecordServerSettings, body)
+}
+
+// WriteOrphan writes one orphan record.
+func (n *NDJSONWriter) WriteOrphan(o Orphan) error {
+	body, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return n.writeRecord(ndjsonRecordOrphan, body)
+}
+
+// writeExtras writes the records that follow the plugins: the server plugin
+// settings and orphans, when audited.
+func (n *NDJSONWriter) writeExtras(result *AuditResult) error {
+	if result.ServerSettings != nil {
+		if err := n.WriteServerSettings(result.ServerSettings); err != nil {
+			return err
+		}
+	}
+	for _, o := range result.Orphans {
+		if err := n.WriteOrphan(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSummary writes the closing summary record.
+func (n *NDJSONWriter) WriteSummary(summary AuditSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	return n.writeRecord(ndjsonRecordSummary, body)
+}
+
+// writeRecord merges the envelope and body objects into one line.
+func (n *NDJSONWriter) writeRecord(recordType string, body []byte) error {
+	env := ndjsonEnvelope{RecordType: recordType}
+	if n.server != nil {
+		env.ServerURL = n.server.URL
+		env.ServerVersion = n.server.Version
+		at := n.server.AuditedAt
+		env.AuditedAt = &at
+	}
+	head, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	var line bytes.Buffer
+	line.Write(head[:len(head)-1])
+	if len(body) > 2 {
+		line.WriteByte(',')
+		line.Write(body[1:])
+	} else {
+		line.WriteByte('}')
+	}
+	line.WriteByte('\n')
+	_, err = n.w.Write(line.Bytes())
+	return err
+}
+
+func formatNDJSON(w io.Writer, result *AuditResult, columns []reportField) error {
+	nw := NewNDJSONWriter(w, result.Server, columns)
+	for _, p := range result.Plugins {
+		if err := nw.WritePlugin(p); err != nil {
+			return err
+		}
+	}
+	if err := nw.writeExtras(result); err != nil {
+		return err
+	}
+	return nw.WriteSummary(result.Summary)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFormatNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteOutput(&buf, sampleResultWithServer(), OutputOptions{Format: "ndjson"}); err != nil {
+		t.Fatalf("WriteOutput() returned error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected 5 plugin records and a summary, got %d lines:\n%s", len(lines), buf.String())
+	}
+
+	want := `{"record_type":"plugin","server_url":"https://mattermost.example.com","server_version":"10.5.0","audited_at":"2025-03-14T09:30:00Z","plugin_id":"com.mattermost.confluence",`
+	if !strings.HasPrefix(lines[0], want) {
+		t.Errorf("unexpected first record:\n%s\nwant prefix:\n%s", lines[0], want)
+	}
+
+	for i, line := range lines {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line %d is not valid JSON: %v\n%s", i+1, err, line)
+		}
+		if rec["server_url"] != "https://mattermost.example.com" || rec["audited_at"] != "2025-03-14T09:30:00Z" {
+			t.Errorf("line %d missing server metadata: %s", i+1, line)
+		}
+		wantType := ndjsonRecordPlugin
+		if i == len(lines)-1 {
+			wantType = ndjsonRecordSummary
+		}
+		if rec["record_type"] != wantType {
+			t.Errorf("line %d: expected record_type %s, got %v", i+1, wantType, rec["record_type"])
+		}
+	}
+
+	var summary struct {
+		Total    int `json:"total"`
+		Outdated int `json:"outdated"`
+	}
+	if err := json.Unmarshal([]byte(lines[5]), &summary); err != nil || summary.Total != 5 || summary.Outdated != 1 {
+		t.Errorf("unexpected summary record: %s", lines[5])
+	}
+}
+
+func TestNDJSONWriter_ColumnsWithoutServer(t *testing.T) {
+	columns, _ := ParseColumns("plugin_id,update_available")
+	var buf bytes.Buffer
+	nw := NewNDJSONWriter(&buf, nil, columns)
+	if err := nw.WritePlugin(sampleResult().Plugins[0]); err != nil {
+		t.Fatalf("WritePlugin() returned error: %v", err)
+	}
+	if err := nw.WriteSummary(AuditSummary{}); err != nil {
+		t.Fatalf("WriteSummary() returned error: %v", err)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	scanner.Scan()
+	if got := scanner.Text(); got != `{"record_type":"plugin","server_url":"","server_version":"","audited_at":null,"plugin_id":"com.mattermost.confluence","update_available":true}` {
+		t.Errorf("unexpected plugin record: %s", got)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Conditions accepted by --notify-when. Several may be combined; all must hold.
+const (
+	NotifyAlways   = "always"
+	NotifyOutdated = "outdated" // At least one Marketplace plugin is outdated
+	NotifyChanged  = "changed"  // The results differ from the last notified snapshot
+)
+
+// webhookSignatureHeader carries the hex HMAC-SHA256 of the request body,
+// prefixed "sha256=", when a shared secret is configured.
+const webhookSignatureHeader = "X-Signature-256"
+
+// notifyStateVersion is bumped when the snapshot file format changes.
+const notifyStateVersion = 1
+
+// Notifier delivers audit results to an external system.
+type Notifier interface {
+	// Name identifies the destination in logs and errors, without secrets.
+	Name() string
+	Notify(ctx context.Context, result *AuditResult) error
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// ParseNotifyConditions validates a comma-separated --notify-when value.
+func ParseNotifyConditions(s string) ([]string, error) {
+	var conditions []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		switch c {
+		case "":
+			continue
+		case NotifyAlways, NotifyOutdated, NotifyChanged:
+			conditions = append(conditions, c)
+		default:
+			return nil, configError(fmt.Sprintf("error: invalid --notify-when condition %q. Use always, outdated, or changed.", c), nil)
+		}
+	}
+	if len(conditions) == 0 {
+		conditions = []string{NotifyAlways}
+	}
+	return conditions, nil
+}
+
+// Notification sends audit results to notifiers when its conditions hold.
+type Notification struct {
+	Notifiers  []Notifier
+	Conditions []string
+	StatePath  string // Snapshot of the last notified results, for the changed condition
+	Logf       func(string, ...interface{})
+}
+
+// Run notifies every notifier if the conditions hold, attempting all of them
+// even if some fail. The snapshot is updated only when every delivery
+// succeeds, so a failed notification is retried on the next run.
+func (n *Notification) Run(ctx context.Context, result *AuditResult) error {
+	fingerprint, err := resultFingerprint(result)
+	if err != nil {
+		return err
+	}
+	changed := true
+	if n.usesSnapshot() {
+		previous, err := loadNotifySnapshot(n.StatePath)
+		if err != nil {
+			n.Logf("Ignoring unreadable notification state %s: %v", n.StatePath, err)
+		}
+		changed = previous != fingerprint
+	}
+
+	if !n.due(result, changed) {
+		n.Logf("Notification conditions (%s) not met; nothing sent", strings.Join(n.Conditions, ", "))
+		return nil
+	}
+
+	var failed []string
+	var errs []error
+	for _, notifier := range n.Notifiers {
+		n.Logf("Notifying %s...", notifier.Name())
+		if err := notifier.Notify(ctx, result); err != nil {
+			err = fmt.Errorf("%s: %w", notifier.Name(), err)
+			failed = append(failed, err.Error())
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return notifyError("error: notification failed: "+strings.Join(failed, "; "), errors.Join(errs...))
+	}
+
+	if n.usesSnapshot() {
+		if err := saveNotifySnapshot(n.StatePath, fingerprint); err != nil {
+			n.Logf("Unable to save notification state %s: %v", n.StatePath, err)
+		}
+	}
+	return nil
+}
+
+func (n *Notification) usesSnapshot() bool {
+	for _, c := range n.Conditions {
+		if c == NotifyChanged {
+			return true
+		}
+	}
+	return false
+}
+
+// due reports whether every condition holds.
+func (n *Notification) due(result *AuditResult, changed bool) bool {
+	for _, c := range n.Conditions {
+		switch c {
+		case NotifyOutdated:
+			if result.Summary.Outdated == 0 {
+				return false
+			}
+		case NotifyChanged:
+			if !changed {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// snapshotPlugin is the part of a plugin report that counts as a change.
+type snapshotPlugin struct {
+	PluginID         string `json:"plugin_id"`
+	InstalledVersion string `json:"installed_version"`
+	LatestVersion    string `json:"latest_version"`
+	UpdateState      string `json:"update_state"`
+	Status           string `json:"status"`
+	SettingsIssues   *int   `json:"settings_issues,omitempty"`
+}
+
+// resultFingerprint hashes the parts of result that a change notification
+// cares about, ignoring when the audit ran and the order of plugins.
+func resultFingerprint(result *AuditResult) (string, error) {
+	plugins := make([]snapshotPlugin, 0, len(result.Plugins))
+	for _, p := range result.Plugins {
+		plugins = append(plugins, snapshotPlugin{p.PluginID, p.InstalledVersion, p.LatestVersion, p.UpdateState, p.Status, p.SettingsIssues})
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].PluginID < plugins[j].PluginID })
+
+	data, err := json.Marshal(struct {
+		Plugins        []snapshotPlugin      `json:"plugins"`
+		ServerSettings *ServerSettingsReport `json:"server_plugin_settings,omitempty"`
+		Orphans        []Orphan              `json:"orphans,omitempty"`
+	}{plugins, result.ServerSettings, result.Orphans})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// notifySnapshot is the state file recording the last notified results.
+type notifySnapshot struct {
+	Version     int       `json:"version"`
+	Fingerprint string    `json:"fingerprint"`
+	NotifiedAt  time.Time `json:"notified_at"`
+}
+
+// defaultNotifyStatePath returns the snapshot file for a server, alongside the
+// Marketplace cache.
+func defaultNotifyStatePath(cacheDir, serverURL string) string {
+	return serverStatePath(cacheDir, "notify", serverURL)
+}
+
+// serverStatePath returns the file in cacheDir holding prefix's state for a
+// server, named after its host and path.
+func serverStatePath(cacheDir, prefix, serverURL string) string {
+	key := serverURL
+	if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
+		key = u.Host + u.Path
+	}
+	key = strings.Trim(unsafeCacheKey.ReplaceAllString(key, "_"), "_")
+	if key == "" {
+		key = "default"
+	}
+	return filepath.Join(cacheDir, prefix+"-"+key+".json")
+}
+
+// loadNotifySnapshot returns the fingerprint in the state file at path, or ""
+// if there is none yet.
+func loadNotifySnapshot(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	var snap notifySnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return "", err
+	}
+	if snap.Version != notifyStateVersion {
+		return "", nil
+	}
+	return snap.Fingerprint, nil
+}
+
+func saveNotifySnapshot(path, fingerprint string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(notifySnapshot{Version: notifyStateVersion, Fingerprint: fingerprint, NotifiedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// Webhook posts audit results to an HTTP endpoint.
+type Webhook struct {
+	URL         string
+	Template    Template // Renders the body; nil sends the AuditResult as JSON
+	ContentType string
+	Secret      string // Signs the body with HMAC-SHA256 when set
+	Client      *http.Client
+}
+
+// ParseWebhookURL validates a --notify-webhook URL.
+func ParseWebhookURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", configError(fmt.Sprintf("error: invalid webhook URL %q. Use an http:// or https:// URL.", raw), err)
+	}
+	return raw, nil
+}
+
+// Name returns the webhook's scheme and host. Paths are left out, since
+// incoming webhook URLs often embed a secret key.
+func (wh *Webhook) Name() string {
+	u, err := url.Parse(wh.URL)
+	if err != nil {
+		return "webhook"
+	}
+	return "webhook " + u.Scheme + "://" + u.Host
+}
+
+// withoutURL drops the request URL that net/http puts in its errors, since a
+// webhook's path is often its only credential.
+func withoutURL(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return fmt.Errorf("%s: %w", uerr.Op, uerr.Err)
+	}
+	return err
+}
+
+// Notify posts the rendered body, retrying as the client's transport allows.
+func (wh *Webhook) Notify(ctx context.Context, result *AuditResult) error {
+	body, err := wh.render(result)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return withoutURL(err)
+	}
+	contentType := wh.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "mm-plugin-audit/"+version)
+	if wh.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signBody(wh.Secret, body))
+	}
+	// The key is the same on every retry, so receivers can drop duplicates
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	req.Header.Set("Idempotency-Key", hex.EncodeToString(key))
+
+	resp, err := wh.Client.Do(req)
+	if err != nil {
+		return withoutURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		if msg := strings.TrimSpace(string(detail)); msg != "" {
+			return fmt.Errorf("HTTP %d: %s", resp.StatusCode, msg)
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (wh *Webhook) render(result *AuditResult) ([]byte, error) {
+	if wh.Template == nil {
+		return json.Marshal(result)
+	}
+	var buf bytes.Buffer
+	if err := formatTemplate(&buf, result, wh.Template, false); err != nil {
+		return nil, fmt.Errorf("rendering template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// signBody returns the hex HMAC-SHA256 of body keyed by secret.
+func signBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+)
+
+// webhookReceiver records the requests posted to it, answering the first
+// failures of them with status.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	failures int
+	status   int
+}
+
+func (rc *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(rc.status)
+		io.WriteString(w, "receiver unavailable")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newWebhookReceiver(t *testing.T) (*webhookReceiver, *httptest.Server) {
+	t.Helper()
+	rc := &webhookReceiver{}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	return rc, srv
+}
+
+func testHTTPClient(t *testing.T, retries int) *http.Client {
+	t.Helper()
+	client, err := newHTTPClient(HTTPConfig{Retries: retries}, noopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestWebhook_DefaultJSONSigned(t *testing.T) {
+	rc, srv := newWebhookReceiver(t)
+	wh := &Webhook{URL: srv.URL + "/hooks/s3cr3t", Secret: "shared", Client: testHTTPClient(t, 0)}
+
+	if err := wh.Notify(context.Background(), sampleResultWithServer()); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+	if len(rc.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(rc.requests))
+	}
+	req, body := rc.requests[0], rc.bodies[0]
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected request %s with Content-Type %q", req.Method, req.Header.Get("Content-Type"))
+	}
+
+	mac := hmac.New(sha256.New, []byte("shared"))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.Header.Get(webhookSignatureHeader) != want {
+		t.Errorf("signature = %q, want %q", req.Header.Get(webhookSignatureHeader), want)
+	}
+
+	var got AuditResult
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if len(got.Plugins) != 5 || got.Plugins[0].PluginID != "com.mattermost.confluence" || got.Summary.Outdated != 1 || got.Server.URL != "https://mattermost.example.com" {
+		t.Errorf("unexpected payload: %s", body)
+	}
+
+	if strings.Contains(wh.Name(), "s3cr3t") {
+		t.Errorf("Name() %q exposes the webhook path", wh.Name())
+	}
+}
+
+func TestWebhook_Template(t *testing.T) {
+	rc, srv := newWebhookReceiver(t)
+	tmpl := template.Must(template.New("hook").Funcs(templateFuncs).Parse(
+		`{"text": {{ printf "%d outdated on %s" .Summary.Outdated .Server.URL | json }}}`))
+	wh := &Webhook{URL: srv.URL, Template: tmpl, ContentType: "application/vnd.example+json", Client: testHTTPClient(t, 0)}
+
+	if err := wh.Notify(context.Background(), sampleResultWithServer()); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+	if got := string(rc.bodies[0]); got != `{"text": "1 outdated on https://mattermost.example.com"}` {
+		t.Errorf("body = %s", got)
+	}
+	if got := rc.requests[0].Header.Get("Content-Type"); got != "application/vnd.example+json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if rc.requests[0].Header.Get(webhookSignatureHeader) != "" {
+		t.Error("unsigned webhook sent a signature")
+	}
+}
+
+func TestWebhook_Retries(t *testing.T) {
+	noSleep(t)
+	rc, srv := newWebhookReceiver(t)
+	rc.failures, rc.status = 2, http.StatusServiceUnavailable
+	wh := &Webhook{URL: srv.URL, Client: testHTTPClient(t, 3)}
+
+	if err := wh.Notify(context.Background(), sampleResultWithServer()); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+	if len(rc.bodies) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(rc.bodies))
+	}
+	if string(rc.bodies[2]) != string(rc.bodies[0]) {
+		t.Error("retried request has a different body")
+	}
+	if key := rc.requests[0].Header.Get("Idempotency-Key"); key == "" || rc.requests[2].Header.Get("Idempotency-Key") != key {
+		t.Errorf("retries should share one Idempotency-Key, got %q and %q", key, rc.requests[2].Header.Get("Idempotency-Key"))
+	}
+}
+
+func TestWebhook_Rejected(t *testing.T) {
+	rc, srv := newWebhookReceiver(t)
+	rc.failures, rc.status = 1, http.StatusBadRequest
+	wh := &Webhook{URL: srv.URL, Client: testHTTPClient(t, 3)}
+
+	err := wh.Notify(context.Background(), sampleResultWithServer())
+	if err == nil || err.Error() != "HTTP 400: receiver unavailable" {
+		t.Errorf("Notify() error = %v, want HTTP 400 with the response body", err)
+	}
+	if len(rc.bodies) != 1 {
+		t.Errorf("a 4xx response should not be retried, got %d attempts", len(rc.bodies))
+	}
+}
+
+func TestWebhook_UnreachableHidesPath(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close() // Nothing listens here any more
+	wh := &Webhook{URL: "http://" + addr + "/hooks/s3cr3t", Client: testHTTPClient(t, 0)}
+
+	err = wh.Notify(context.Background(), sampleResultWithServer())
+	if err == nil {
+		t.Fatal("expected an error from a dead port")
+	}
+	if strings.Contains(err.Error(), "s3cr3t") {
+		t.Errorf("error %q exposes the webhook path", err)
+	}
+}
+
+func TestNotification_Conditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions string
+		outdated   []int // Outdated count of each successive run
+		want       int   // Requests received
+	}{
+		{"always", "always", []int{0, 0}, 2},
+		{"outdated", "outdated", []int{0, 2, 0}, 1},
+		{"changed", "changed", []int{1, 1, 1}, 1},
+		{"changed after a change", "changed", []int{1, 1, 2}, 2},
+		{"outdated and changed", "outdated,changed", []int{0, 1, 1, 2}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, srv := newWebhookReceiver(t)
+			conditions, err := ParseNotifyConditions(tt.conditions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := &Notification{
+				Notifiers:  []Notifier{&Webhook{URL: srv.URL, Client: testHTTPClient(t, 0)}},
+				Conditions: conditions,
+				StatePath:  filepath.Join(t.TempDir(), "state", "notify.json"),
+				Logf:       noopLogger,
+			}
+			for _, outdated := range tt.outdated {
+				result := sampleResultWithServer()
+				result.Summary.Outdated = outdated
+				// Outdated counts stand in for a changed plugin list
+				result.Plugins[0].LatestVersion = strings.Repeat("1", outdated+1)
+				if err := n.Run(context.Background(), result); err != nil {
+					t.Fatalf("Run() returned error: %v", err)
+				}
+			}
+			if len(rc.requests) != tt.want {
+				t.Errorf("expected %d notification(s), got %d", tt.want, len(rc.requests))
+			}
+		})
+	}
+}
+
+func TestNotification_FailureKeepsSnapshot(t *testing.T) {
+	rc, srv := newWebhookReceiver(t)
+	_, good := newWebhookReceiver(t)
+	rc.failures, rc.status = 1, http.StatusBadRequest
+	state := filepath.Join(t.TempDir(), "notify.json")
+	n := &Notification{
+		Notifiers: []Notifier{
+			&Webhook{URL: srv.URL, Client: testHTTPClient(t, 0)},
+			&Webhook{URL: good.URL, Client: testHTTPClient(t, 0)},
+		},
+		Conditions: []string{NotifyChanged},
+		StatePath:  state,
+		Logf:       noopLogger,
+	}
+
+	err := n.Run(context.Background(), sampleResultWithServer())
+	if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitNotifyError || !strings.Contains(cliErr.Message, "HTTP 400") {
+		t.Fatalf("expected a notify error naming the failure, got %v", err)
+	}
+	if _, err := os.Stat(state); !os.IsNotExist(err) {
+		t.Error("snapshot saved despite a failed delivery")
+	}
+
+	// The next run retries, since the results still count as changed
+	if err := n.Run(context.Background(), sampleResultWithServer()); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if len(rc.requests) != 2 {
+		t.Errorf("expected the failed webhook to be retried, got %d requests", len(rc.requests))
+	}
+	if _, err := os.Stat(state); err != nil {
+		t.Errorf("snapshot not saved after delivery: %v", err)
+	}
+}
+
+func TestParseNotifyConditions(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", "always", false},
+		{"always", "always", false},
+		{"Outdated, changed", "outdated,changed", false},
+		{"sometimes", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseNotifyConditions(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseNotifyConditions(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("ParseNotifyConditions(%q) = %v, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseWebhookURL(t *testing.T) {
+	for _, raw := range []string{"https://hooks.example.com/x", "http://localhost:8080"} {
+		if _, err := ParseWebhookURL(raw); err != nil {
+			t.Errorf("ParseWebhookURL(%q) returned error: %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"hooks.example.com", "ftp://example.com", "https://"} {
+		if _, err := ParseWebhookURL(raw); err == nil {
+			t.Errorf("ParseWebhookURL(%q) accepted an invalid URL", raw)
+		}
+	}
+}
+
+func TestDefaultNotifyStatePath(t *testing.T) {
+	got := defaultNotifyStatePath("/cache", "https://chat.example.com:8065/mm")
+	if want := filepath.Join("/cache", "notify-chat.example.com_8065_mm.json"); got != want {
+		t.Errorf("defaultNotifyStatePath() = %q, want %q", got, want)
+	}
+	if got := defaultNotifyStatePath("/cache", ""); got != filepath.Join("/cache", "notify-default.json") {
+		t.Errorf("defaultNotifyStatePath() without a URL = %q", got)
+	}
+}
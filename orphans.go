@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Orphan issues reported by --orphans.
+const (
+	OrphanNotInstalled  = "not-installed"  // Configured in PluginStates or Plugins but not installed
+	OrphanNotConfigured = "not-configured" // Installed but absent from PluginStates
+)
+
+// Orphan is a plugin ID whose configuration and installation disagree.
+type Orphan struct {
+	PluginID    string `json:"plugin_id"`
+	Issue       string `json:"issue"`
+	State       string `json:"plugin_state"` // "enabled" or "disabled" in PluginStates, or "" if absent
+	HasSettings bool   `json:"has_settings"` // PluginSettings.Plugins holds settings for it
+	Status      string `json:"status"`       // The installed plugin's status, or "" if not installed
+}
+
+// FindOrphans compares the installed plugins with PluginSettings.PluginStates
+// and PluginSettings.Plugins, returning configured plugins that aren't
+// installed and installed plugins with no PluginStates entry, in that order.
+// Plugin IDs are compared case-insensitively, since older config stores
+// lower-cased map keys.
+func FindOrphans(installed []InstalledPlugin, cfg *model.Config) []Orphan {
+	states := make(map[string]*model.PluginState)
+	for id, state := range cfg.PluginSettings.PluginStates {
+		states[strings.ToLower(id)] = state
+	}
+	settings := make(map[string]bool)
+	for id := range cfg.PluginSettings.Plugins {
+		settings[strings.ToLower(id)] = true
+	}
+
+	var orphans []Orphan
+	isInstalled := make(map[string]bool)
+	for _, p := range installed {
+		id := strings.ToLower(p.ID)
+		isInstalled[id] = true
+		if _, ok := states[id]; !ok {
+			orphans = append(orphans, Orphan{PluginID: p.ID, Issue: OrphanNotConfigured, HasSettings: settings[id], Status: p.Status})
+		}
+	}
+
+	configured := []Orphan{}
+	seen := make(map[string]bool)
+	for id, state := range cfg.PluginSettings.PluginStates {
+		if key := strings.ToLower(id); !isInstalled[key] && !seen[key] {
+			seen[key] = true
+			configured = append(configured, Orphan{PluginID: id, Issue: OrphanNotInstalled, State: pluginStateName(state), HasSettings: settings[key]})
+		}
+	}
+	for id := range cfg.PluginSettings.Plugins {
+		if key := strings.ToLower(id); !isInstalled[key] && !seen[key] {
+			seen[key] = true
+			configured = append(configured, Orphan{PluginID: id, Issue: OrphanNotInstalled, HasSettings: true})
+		}
+	}
+	sort.Slice(configured, func(i, j int) bool { return configured[i].PluginID < configured[j].PluginID })
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].PluginID < orphans[j].PluginID })
+	return append(configured, orphans...)
+}
+
+func pluginStateName(state *model.PluginState) string {
+	if state != nil && state.Enable {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+func TestFindOrphans(t *testing.T) {
+	installed := []InstalledPlugin{
+		{ID: "com.mattermost.calls", Status: "enabled"},
+		{ID: "com.example.Uploaded", Status: "disabled"},
+		{ID: "playbooks", Status: "enabled"},
+	}
+
+	tests := []struct {
+		name   string
+		states map[string]*model.PluginState
+		saved  map[string]map[string]interface{}
+		want   []string // plugin_id:issue:plugin_state:has_settings:status
+	}{
+		{
+			name: "everything configured",
+			states: map[string]*model.PluginState{
+				"com.mattermost.calls": {Enable: true},
+				"com.example.uploaded": {Enable: false}, // Lower-cased by an older config store
+				"playbooks":            {Enable: true},
+			},
+			want: nil,
+		},
+		{
+			name: "leftovers after uninstalling",
+			states: map[string]*model.PluginState{
+				"com.mattermost.calls": {Enable: true},
+				"com.example.uploaded": {Enable: false},
+				"playbooks":            {Enable: true},
+				"jira":                 {Enable: true},
+				"zoom":                 {Enable: false},
+			},
+			saved: map[string]map[string]interface{}{
+				"jira":                 {"secret": "x"},
+				"com.mattermost.nps":   {"enablesurvey": true},
+				"com.mattermost.calls": {"rtcserverport": float64(8443)},
+			},
+			want: []string{
+				"com.mattermost.nps:not-installed::true:",
+				"jira:not-installed:enabled:true:",
+				"zoom:not-installed:disabled:false:",
+			},
+		},
+		{
+			name: "installed but never configured",
+			states: map[string]*model.PluginState{
+				"com.mattermost.calls": {Enable: true},
+			},
+			saved: map[string]map[string]interface{}{
+				"playbooks": {"enableexperimentalfeatures": false},
+			},
+			want: []string{
+				"com.example.Uploaded:not-configured::false:disabled",
+				"playbooks:not-configured::true:enabled",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &model.Config{}
+			cfg.PluginSettings.PluginStates = tt.states
+			cfg.PluginSettings.Plugins = tt.saved
+
+			orphans := FindOrphans(installed, cfg)
+			if orphans == nil {
+				t.Fatal("FindOrphans() returned nil, want an empty list when there are no orphans")
+			}
+			var got []string
+			for _, o := range orphans {
+				got = append(got, strings.Join([]string{o.PluginID, o.Issue, o.State, strconv.FormatBool(o.HasSettings), o.Status}, ":"))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("FindOrphans() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunAudit_FindOrphans(t *testing.T) {
+	cfg := &model.Config{}
+	cfg.PluginSettings.PluginStates = map[string]*model.PluginState{
+		"com.example.a": {Enable: true},
+		"com.example.b": {Enable: false},
+	}
+	mm := &mockConfigClient{
+		mockMMClient: mockMMClient{plugins: []InstalledPlugin{{ID: "com.example.a", Name: "A", Version: "1.0.0", Status: "enabled"}}},
+		cfg:          cfg,
+	}
+
+	// Orphans cover every installed plugin, whatever the filters keep
+	result, err := RunAudit(context.Background(), mm, AuditOptions{FindOrphans: true, Filter: &PluginFilter{Statuses: []string{"disabled"}}}, noopLogger)
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+	if len(result.Orphans) != 1 || result.Orphans[0].PluginID != "com.example.b" || result.Summary.Orphans != 1 {
+		t.Fatalf("orphans = %+v, want com.example.b", result.Orphans)
+	}
+
+	var buf bytes.Buffer
+	if err := FormatOutput(&buf, result, "table"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "=== Orphans (1) ===") || !strings.Contains(buf.String(), "com.example.b") {
+		t.Errorf("table output missing orphans section:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := FormatOutput(&buf, result, "ndjson"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `{"record_type":"orphan","server_url":"","server_version":"","audited_at":null,"plugin_id":"com.example.b"`) {
+		t.Errorf("NDJSON output missing orphan record:\n%s", buf.String())
+	}
+
+	// With no orphans, JSON still carries an empty orphans list
+	cfg.PluginSettings.PluginStates = map[string]*model.PluginState{"com.example.a": {Enable: true}}
+	result, _ = RunAudit(context.Background(), mm, AuditOptions{FindOrphans: true}, noopLogger)
+	buf.Reset()
+	if err := FormatOutput(&buf, result, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if string(out["orphans"]) != "[]" {
+		t.Errorf("JSON orphans = %s, want []", out["orphans"])
+	}
+}
@@ -1,130 +1,371 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
 	"text/tabwriter"
+	"unicode/utf8"
 )
 
+// OutputOptions controls how an audit result is written.
+type OutputOptions struct {
+	Format   string        // table, csv, json, ndjson, template or xlsx
+	Columns  []reportField // Replaces the default columns when set
+	Template Template      // Used by the template format
+	Color    bool          // Emit ANSI colours in table and template output
+	Width    int           // Truncate table names to fit this many columns (0 for no limit)
+}
+
 // FormatOutput writes the audit result in the specified format.
 func FormatOutput(w io.Writer, result *AuditResult, format string) error {
-	switch strings.ToLower(format) {
+	return WriteOutput(w, result, OutputOptions{Format: format})
+}
+
+// WriteOutput writes the audit result according to opts.
+func WriteOutput(w io.Writer, result *AuditResult, opts OutputOptions) error {
+	switch strings.ToLower(opts.Format) {
 	case "table":
-		return formatTable(w, result)
+		return formatTable(w, result, opts)
 	case "csv":
+		if len(opts.Columns) > 0 {
+			return formatCSVColumns(w, result, opts.Columns)
+		}
 		return formatCSV(w, result)
 	case "json":
+		if len(opts.Columns) > 0 {
+			return formatJSONColumns(w, result, opts.Columns)
+		}
 		return formatJSON(w, result)
+	case "ndjson":
+		return formatNDJSON(w, result, opts.Columns)
+	case "template":
+		return formatTemplate(w, result, opts.Template, opts.Color)
+	case "xlsx":
+		return WriteXLSX(w, result, opts.Columns)
+	case "cmdb":
+		return formatCMDB(w, result)
 	default:
-		return fmt.Errorf("unknown format: %s", format)
+		return fmt.Errorf("unknown format: %s", opts.Format)
 	}
 }
 
-func formatTable(w io.Writer, result *AuditResult) error {
-	// Separate plugins by source
-	var marketplace, mattermost, bundled, thirdParty []PluginReport
-	for _, p := range result.Plugins {
-		switch p.Source {
-		case SourceMarketplace:
-			marketplace = append(marketplace, p)
-		case SourceMattermost:
-			mattermost = append(mattermost, p)
-		case SourceBundled:
-			bundled = append(bundled, p)
-		default:
-			thirdParty = append(thirdParty, p)
-		}
-	}
-
-	// Marketplace plugins section
-	fmt.Fprintf(w, "=== Marketplace Plugins (%d) ===\n", len(marketplace))
-	if len(marketplace) > 0 {
-		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(tw, "NAME\tINSTALLED\tLATEST\tUPDATE?\tSTATUS")
-		for _, p := range marketplace {
-			updateStr := updateIndicator(p)
-			statusStr := capitalizeStatus(p.Status)
-			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.Name, p.InstalledVersion, p.LatestVersion, updateStr, statusStr)
-		}
-		tw.Flush()
-	} else {
-		fmt.Fprintln(w, "(none)")
+// defaultTableColumns returns the columns shown in a section when --columns
+// is not set: the Marketplace section adds the latest version and update
+// columns.
+func defaultTableColumns(source string) ([]string, []string) {
+	if source == SourceMarketplace {
+		return []string{"NAME", "INSTALLED", "LATEST", "UPDATE?", "STATUS"},
+			[]string{"name", "installed_version", "latest_version", "update_available", "status"}
 	}
+	return []string{"NAME", "INSTALLED", "STATUS"}, []string{"name", "installed_version", "status"}
+}
 
-	fmt.Fprintln(w)
+// formatTable writes one section per plugin source, followed by the summary.
+func formatTable(w io.Writer, result *AuditResult, opts OutputOptions) error {
+	for _, section := range tableSections {
+		var plugins []PluginReport
+		for _, p := range result.Plugins {
+			if p.Source == section.source || (section.source == SourceThirdParty && !isKnownSource(p.Source)) {
+				plugins = append(plugins, p)
+			}
+		}
 
-	// Mattermost plugins section
-	fmt.Fprintf(w, "=== Mattermost Plugins (%d) ===\n", len(mattermost))
-	if len(mattermost) > 0 {
-		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(tw, "NAME\tINSTALLED\tSTATUS")
-		for _, p := range mattermost {
-			statusStr := capitalizeStatus(p.Status)
-			fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Name, p.InstalledVersion, statusStr)
-		}
-		tw.Flush()
-	} else {
-		fmt.Fprintln(w, "(none)")
+		header, names := defaultTableColumns(section.source)
+		columns := make([]reportField, len(names))
+		for i, name := range names {
+			columns[i], _ = lookupReportField(name)
+		}
+		if len(opts.Columns) > 0 {
+			columns = opts.Columns
+			header = make([]string, len(columns))
+			for i, col := range columns {
+				header[i] = strings.ToUpper(col.Name)
+			}
+		}
+
+		fmt.Fprintf(w, "=== %s (%d) ===\n", section.title, len(plugins))
+		if len(plugins) > 0 {
+			if err := writeTableSection(w, header, columns, plugins, opts); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintln(w, "(none)")
+		}
+		fmt.Fprintln(w)
 	}
 
+	if result.ServerSettings != nil {
+		if err := writeServerSettingsSection(w, result.ServerSettings); err != nil {
+			return err
+		}
+	}
+	if result.SettingsAudited {
+		if err := writeSettingsSection(w, result.Plugins); err != nil {
+			return err
+		}
+	}
+	if result.Orphans != nil {
+		if err := writeOrphansSection(w, result.Orphans); err != nil {
+			return err
+		}
+	}
+
+	writeTableSummary(w, result.Summary)
+	return nil
+}
+
+// writeServerSettingsSection lists the server's plugin settings against the
+// hardening profile, explaining each setting that differs.
+func writeServerSettingsSection(w io.Writer, report *ServerSettingsReport) error {
+	fmt.Fprintf(w, "=== Server Plugin Settings (%d warning(s)) ===\n", report.Warnings)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tRECOMMENDED\tSTATUS\tDETAIL")
+	for _, c := range report.Checks {
+		detail := ""
+		if c.Status == ServerSettingWarn {
+			detail = c.Reason
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t%s\n", c.Setting, c.DisplayValue(), c.Recommended, c.Status, detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
 	fmt.Fprintln(w)
+	return nil
+}
 
-	// Bundled plugins section
-	fmt.Fprintf(w, "=== Bundled Mattermost Plugins (%d) ===\n", len(bundled))
-	if len(bundled) > 0 {
-		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(tw, "NAME\tINSTALLED\tSTATUS")
-		for _, p := range bundled {
-			statusStr := capitalizeStatus(p.Status)
-			fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Name, p.InstalledVersion, statusStr)
-		}
-		tw.Flush()
-	} else {
+// writeOrphansSection lists plugins whose configuration and installation
+// disagree.
+func writeOrphansSection(w io.Writer, orphans []Orphan) error {
+	fmt.Fprintf(w, "=== Orphans (%d) ===\n", len(orphans))
+	if len(orphans) == 0 {
 		fmt.Fprintln(w, "(none)")
+		fmt.Fprintln(w)
+		return nil
 	}
 
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLUGIN ID\tISSUE\tPLUGIN STATE\tSETTINGS\tSTATUS")
+	for _, o := range orphans {
+		settings := "no"
+		if o.HasSettings {
+			settings = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", o.PluginID, o.Issue, valueOr(o.State, "-"), settings, valueOr(o.Status, "-"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
 	fmt.Fprintln(w)
+	return nil
+}
 
-	// Third-party plugins section
-	fmt.Fprintf(w, "=== Third-Party / Custom Plugins (%d) ===\n", len(thirdParty))
-	if len(thirdParty) > 0 {
-		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(tw, "NAME\tINSTALLED\tSTATUS")
-		for _, p := range thirdParty {
-			statusStr := capitalizeStatus(p.Status)
-			fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Name, p.InstalledVersion, statusStr)
-		}
-		tw.Flush()
-	} else {
-		fmt.Fprintln(w, "(none)")
+// writeSettingsSection lists every settings finding, one per line.
+func writeSettingsSection(w io.Writer, plugins []PluginReport) error {
+	var findings int
+	for _, p := range plugins {
+		findings += len(p.Settings)
+	}
+	fmt.Fprintf(w, "=== Plugin Settings (%d) ===\n", findings)
+	if findings == 0 {
+		fmt.Fprintln(w, "(no issues)")
+		fmt.Fprintln(w)
+		return nil
 	}
 
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLUGIN\tSETTING\tISSUE\tVALUE\tDEFAULT\tDETAIL")
+	for _, p := range plugins {
+		for _, f := range p.Settings {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", p.PluginID, f.Key, f.Issue, valueOr(f.Value, "-"), valueOr(f.Default, "-"), f.Message)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
 	fmt.Fprintln(w)
+	return nil
+}
 
-	// Summary
-	fmt.Fprintf(w, "Summary: %d plugin(s) total — %d marketplace (%d outdated, %d up to date), %d mattermost, %d bundled, %d third-party/custom — %d enabled, %d disabled\n",
-		result.Summary.Total,
-		result.Summary.Marketplace,
-		result.Summary.Outdated,
-		result.Summary.UpToDate,
-		result.Summary.MattermostPlugin,
-		result.Summary.Bundled,
-		result.Summary.ThirdParty,
-		result.Summary.Enabled,
-		result.Summary.Disabled,
-	)
+// writeTableSection writes an aligned table of plugins. With opts.Width set,
+// the name column is truncated so rows fit; with opts.Color set, each row is
+// coloured by the plugin's state. Colour codes wrap whole lines after
+// alignment, so they never affect column widths.
+func writeTableSection(w io.Writer, header []string, columns []reportField, plugins []PluginReport, opts OutputOptions) error {
+	rows := make([][]string, len(plugins))
+	for i, p := range plugins {
+		rows[i] = make([]string, len(columns))
+		for j, col := range columns {
+			rows[i][j] = tableCell(col, p)
+		}
+	}
+	if opts.Width > 0 {
+		fitNameColumn(header, columns, rows, opts.Width)
+	}
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
 
+	if !opts.Color {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		text := strings.TrimSuffix(line, "\n")
+		if i == 0 {
+			text = colorize("bold", text)
+		} else {
+			text = colorize(rowColor(plugins[i-1]), text)
+		}
+		if _, err := io.WriteString(w, text+"\n"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// minNameWidth is the narrowest the name column is truncated to.
+const minNameWidth = 12
+
+// fitNameColumn truncates the name column so each row is at most width
+// characters wide, as laid out by tabwriter with a padding of 2.
+func fitNameColumn(header []string, columns []reportField, rows [][]string, width int) {
+	nameCol := -1
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = utf8.RuneCountInString(h)
+		if columns[i].Name == "name" {
+			nameCol = i
+		}
+	}
+	if nameCol < 0 {
+		return
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	total := 2 * (len(widths) - 1)
+	for _, cw := range widths {
+		total += cw
+	}
+	if total <= width {
+		return
+	}
+	limit := max(minNameWidth, widths[nameCol]-(total-width))
+	for _, row := range rows {
+		row[nameCol] = truncate(limit, row[nameCol])
+	}
+}
+
+// rowColor picks the colour for a plugin's table row.
+func rowColor(p PluginReport) string {
+	switch {
+	case p.UpdateState == UpdateStateOutdated:
+		return "red"
+	case p.Status == "disabled":
+		return "yellow"
+	case p.UpdateState == UpdateStateUpToDate:
+		return "green"
+	case p.UpdateState == UpdateStateAhead:
+		return "cyan"
+	case p.UpdateState == UpdateStateIncomparable:
+		return "magenta"
+	}
+	return "gray"
+}
+
+// writeTableSummary writes the one-line summary that ends the table output.
+func writeTableSummary(w io.Writer, summary AuditSummary) {
+	mpCounts := fmt.Sprintf("%d outdated, %d up to date", summary.Outdated, summary.UpToDate)
+	if summary.Ahead > 0 {
+		mpCounts += fmt.Sprintf(", %d ahead", summary.Ahead)
+	}
+	if summary.Incomparable > 0 {
+		mpCounts += fmt.Sprintf(", %d incomparable", summary.Incomparable)
+	}
+	fmt.Fprintf(w, "Summary: %d plugin(s) total — %d marketplace (%s), %d mattermost, %d bundled, %d third-party/custom — %d enabled, %d disabled\n",
+		summary.Total,
+		summary.Marketplace,
+		mpCounts,
+		summary.MattermostPlugin,
+		summary.Bundled,
+		summary.ThirdParty,
+		summary.Enabled,
+		summary.Disabled,
+	)
+	if summary.ServerSettingsWarnings > 0 {
+		fmt.Fprintf(w, "Server settings: %d warning(s)\n", summary.ServerSettingsWarnings)
+	}
+	if summary.Orphans > 0 {
+		fmt.Fprintf(w, "Orphans: %d plugin(s) configured but not installed, or installed but not configured\n", summary.Orphans)
+	}
+	if summary.SettingsIssues > 0 {
+		fmt.Fprintf(w, "Settings: %d issue(s)\n", summary.SettingsIssues)
+	}
+}
+
+// tableSections lists the table sections in display order.
+var tableSections = []struct {
+	source string
+	title  string
+}{
+	{SourceMarketplace, "Marketplace Plugins"},
+	{SourceMattermost, "Mattermost Plugins"},
+	{SourceBundled, "Bundled Mattermost Plugins"},
+	{SourceThirdParty, "Third-Party / Custom Plugins"},
+}
+
+// tableCell formats a field for the table, using the same wording as the
+// default layout for the update and status columns.
+func tableCell(col reportField, p PluginReport) string {
+	switch col.Name {
+	case "update_available":
+		return updateIndicator(p)
+	case "status":
+		return capitalizeStatus(p.Status)
+	}
+	return col.Value(p)
+}
+
+func isKnownSource(source string) bool {
+	return source == SourceMarketplace || source == SourceMattermost || source == SourceBundled
+}
+
 // updateIndicator returns a human-readable string for the UPDATE? column.
 func updateIndicator(p PluginReport) string {
 	if p.UpdateAvailable == "true" {
+		switch {
+		case p.UpdateSeverity != "" && p.ReleasesBehind != nil:
+			return fmt.Sprintf("YES ⚠ (%s, %d behind)", p.UpdateSeverity, *p.ReleasesBehind)
+		case p.UpdateSeverity != "":
+			return fmt.Sprintf("YES ⚠ (%s)", p.UpdateSeverity)
+		}
 		return "YES ⚠"
 	}
+	if p.UpdateState == UpdateStateAhead {
+		return "AHEAD ▲"
+	}
+	if p.UpdateState == UpdateStateIncomparable {
+		return "? (incomparable)"
+	}
 	return "No"
 }
 
@@ -134,7 +375,7 @@ func formatCSV(w io.Writer, result *AuditResult) error {
 	// Header
 	if err := cw.Write([]string{
 		"plugin_id", "name", "installed_version", "latest_version",
-		"update_available", "status", "type", "source", "marketplace_url",
+		"update_available", "status", "type", "source", "marketplace_url", "update_state",
 	}); err != nil {
 		return err
 	}
@@ -150,6 +391,7 @@ func formatCSV(w io.Writer, result *AuditResult) error {
 			p.PluginType,
 			p.Source,
 			p.MarketplaceURL,
+			p.UpdateState,
 		}); err != nil {
 			return err
 		}
@@ -159,10 +401,46 @@ func formatCSV(w io.Writer, result *AuditResult) error {
 	return cw.Error()
 }
 
+func formatCSVColumns(w io.Writer, result *AuditResult, columns []reportField) error {
+	cw := csv.NewWriter(w)
+
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.Name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, p := range result.Plugins {
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			row[i] = col.Value(p)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
 // jsonOutput is the JSON-specific output structure with summary at top level.
 type jsonOutput struct {
-	Plugins []jsonPlugin `json:"plugins"`
-	Summary AuditSummary `json:"summary"`
+	Plugins        []jsonPlugin          `json:"plugins"`
+	ServerSettings *ServerSettingsReport `json:"server_plugin_settings,omitempty"`
+	Orphans        *[]Orphan             `json:"orphans,omitempty"`
+	Summary        AuditSummary          `json:"summary"`
+}
+
+// jsonOrphans returns the orphans for JSON output: omitted when not checked,
+// but an empty list when none were found.
+func jsonOrphans(result *AuditResult) *[]Orphan {
+	if result.Orphans == nil {
+		return nil
+	}
+	return &result.Orphans
 }
 
 type jsonPlugin struct {
@@ -171,32 +449,52 @@ type jsonPlugin struct {
 	InstalledVersion string `json:"installed_version"`
 	LatestVersion    string `json:"latest_version"`
 	UpdateAvailable  *bool  `json:"update_available"`
+	UpdateState      string `json:"update_state"`
 	Status           string `json:"status"`
 	PluginType       string `json:"type"`
 	Source           string `json:"source"`
 	MarketplaceURL   string `json:"marketplace_url"`
+	UpdateSeverity   string `json:"update_severity"`
+	ReleasesBehind   *int   `json:"releases_behind"`
+	HomepageURL      string `json:"homepage_url"`
+	ReleaseNotesURL  string `json:"release_notes_url"`
+
+	SettingsIssues *int             `json:"settings_issues,omitempty"`
+	Settings       []SettingFinding `json:"settings,omitempty"`
+}
+
+func newJSONPlugin(p PluginReport) jsonPlugin {
+	return jsonPlugin{
+		PluginID:         p.PluginID,
+		Name:             p.Name,
+		InstalledVersion: p.InstalledVersion,
+		LatestVersion:    p.LatestVersion,
+		UpdateAvailable:  p.UpdateAvailJSON,
+		UpdateState:      p.UpdateState,
+		Status:           p.Status,
+		PluginType:       p.PluginType,
+		Source:           p.Source,
+		MarketplaceURL:   p.MarketplaceURL,
+		UpdateSeverity:   p.UpdateSeverity,
+		ReleasesBehind:   p.ReleasesBehind,
+		HomepageURL:      p.HomepageURL,
+		ReleaseNotesURL:  p.ReleaseNotesURL,
+		SettingsIssues:   p.SettingsIssues,
+		Settings:         p.Settings,
+	}
 }
 
 func formatJSON(w io.Writer, result *AuditResult) error {
 	plugins := make([]jsonPlugin, 0, len(result.Plugins))
 	for _, p := range result.Plugins {
-		jp := jsonPlugin{
-			PluginID:         p.PluginID,
-			Name:             p.Name,
-			InstalledVersion: p.InstalledVersion,
-			LatestVersion:    p.LatestVersion,
-			UpdateAvailable:  p.UpdateAvailJSON,
-			Status:           p.Status,
-			PluginType:       p.PluginType,
-			Source:           p.Source,
-			MarketplaceURL:   p.MarketplaceURL,
-		}
-		plugins = append(plugins, jp)
+		plugins = append(plugins, newJSONPlugin(p))
 	}
 
 	out := jsonOutput{
-		Plugins: plugins,
-		Summary: result.Summary,
+		Plugins:        plugins,
+		ServerSettings: result.ServerSettings,
+		Orphans:        jsonOrphans(result),
+		Summary:        result.Summary,
 	}
 
 	data, err := json.MarshalIndent(out, "", "  ")
@@ -212,6 +510,67 @@ func formatJSON(w io.Writer, result *AuditResult) error {
 	return err
 }
 
+// formatJSONColumns writes the JSON layout with each plugin object reduced to
+// the given columns, in order. Values keep their JSON types (e.g. a boolean
+// update_available), taken from PluginReport's own JSON encoding.
+func formatJSONColumns(w io.Writer, result *AuditResult, columns []reportField) error {
+	plugins := make([]json.RawMessage, 0, len(result.Plugins))
+	for _, p := range result.Plugins {
+		obj, err := jsonColumnsObject(p, columns)
+		if err != nil {
+			return err
+		}
+		plugins = append(plugins, obj)
+	}
+
+	out := struct {
+		Plugins        []json.RawMessage     `json:"plugins"`
+		ServerSettings *ServerSettingsReport `json:"server_plugin_settings,omitempty"`
+		Orphans        *[]Orphan             `json:"orphans,omitempty"`
+		Summary        AuditSummary          `json:"summary"`
+	}{plugins, result.ServerSettings, jsonOrphans(result), result.Summary}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+// jsonColumnsObject encodes p as a JSON object holding only the given columns, in order.
+func jsonColumnsObject(p PluginReport, columns []reportField) ([]byte, error) {
+	full, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(full, &values); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, col := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(col.Name)
+		value, ok := values[col.Name]
+		if !ok {
+			value, _ = json.Marshal(col.Value(p))
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
 func capitalizeStatus(s string) string {
 	if s == "enabled" {
 		return "Enabled"
@@ -20,6 +20,7 @@ func sampleResult() *AuditResult {
 				LatestVersion:    "1.4.0",
 				UpdateAvailable:  "true",
 				UpdateAvailJSON:  &trueVal,
+				UpdateState:      UpdateStateOutdated,
 				Status:           "enabled",
 				Source:           SourceMarketplace,
 				MarketplaceURL:   "https://github.com/mattermost/mattermost-plugin-confluence",
@@ -32,6 +33,7 @@ func sampleResult() *AuditResult {
 				LatestVersion:    "1.2.0",
 				UpdateAvailable:  "false",
 				UpdateAvailJSON:  &falseVal,
+				UpdateState:      UpdateStateUpToDate,
 				Status:           "enabled",
 				Source:           SourceMarketplace,
 				MarketplaceURL:   "https://github.com/mattermost/mattermost-plugin-welcomebot",
@@ -44,6 +46,7 @@ func sampleResult() *AuditResult {
 				LatestVersion:    "",
 				UpdateAvailable:  "unknown",
 				UpdateAvailJSON:  nil,
+				UpdateState:      UpdateStateUnknown,
 				Status:           "enabled",
 				Source:           SourceMattermost,
 				MarketplaceURL:   "",
@@ -56,6 +59,7 @@ func sampleResult() *AuditResult {
 				LatestVersion:    "",
 				UpdateAvailable:  "unknown",
 				UpdateAvailJSON:  nil,
+				UpdateState:      UpdateStateUnknown,
 				Status:           "enabled",
 				Source:           SourceBundled,
 				MarketplaceURL:   "",
@@ -68,6 +72,7 @@ func sampleResult() *AuditResult {
 				LatestVersion:    "",
 				UpdateAvailable:  "unknown",
 				UpdateAvailJSON:  nil,
+				UpdateState:      UpdateStateUnknown,
 				Status:           "disabled",
 				Source:           SourceThirdParty,
 				MarketplaceURL:   "",
@@ -179,7 +184,7 @@ func TestFormatCSV(t *testing.T) {
 
 	// Check header
 	expectedHeaders := []string{"plugin_id", "name", "installed_version", "latest_version",
-		"update_available", "status", "type", "source", "marketplace_url"}
+		"update_available", "status", "type", "source", "marketplace_url", "update_state"}
 	if len(records[0]) != len(expectedHeaders) {
 		t.Errorf("expected %d columns, got %d", len(expectedHeaders), len(records[0]))
 	}
@@ -196,6 +201,9 @@ func TestFormatCSV(t *testing.T) {
 	if records[1][4] != "true" {
 		t.Errorf("expected update_available true, got %s", records[1][4])
 	}
+	if records[1][9] != UpdateStateOutdated {
+		t.Errorf("expected update_state outdated, got %s", records[1][9])
+	}
 	if records[1][7] != "marketplace" {
 		t.Errorf("expected source marketplace, got %s", records[1][7])
 	}
@@ -405,8 +413,23 @@ func TestUpdateIndicator(t *testing.T) {
 		},
 		{
 			"installed newer than marketplace",
-			PluginReport{UpdateAvailable: "false", InstalledVersion: "1.11.0", LatestVersion: "1.10.0"},
-			"No",
+			PluginReport{UpdateAvailable: "false", UpdateState: UpdateStateAhead, InstalledVersion: "1.11.0", LatestVersion: "1.10.0"},
+			"AHEAD ▲",
+		},
+		{
+			"update with severity",
+			PluginReport{UpdateAvailable: "true", InstalledVersion: "1.0.0", LatestVersion: "1.1.0", UpdateSeverity: SeverityMinor},
+			"YES ⚠ (minor)",
+		},
+		{
+			"update with severity and history",
+			PluginReport{UpdateAvailable: "true", InstalledVersion: "1.0.0", LatestVersion: "2.0.0", UpdateSeverity: SeverityMajor, ReleasesBehind: intPtr(5)},
+			"YES ⚠ (major, 5 behind)",
+		},
+		{
+			"incomparable versions",
+			PluginReport{UpdateAvailable: "unknown", UpdateState: UpdateStateIncomparable, InstalledVersion: "custom-build", LatestVersion: "1.0.0"},
+			"? (incomparable)",
 		},
 	}
 
@@ -419,3 +442,142 @@ func TestUpdateIndicator(t *testing.T) {
 		})
 	}
 }
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestWriteOutput_Columns(t *testing.T) {
+	columns, err := ParseColumns("plugin_id,update_available,status")
+	if err != nil {
+		t.Fatalf("ParseColumns() returned error: %v", err)
+	}
+
+	t.Run("table", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteOutput(&buf, sampleResult(), OutputOptions{Format: "table", Columns: columns}); err != nil {
+			t.Fatalf("WriteOutput() returned error: %v", err)
+		}
+		output := buf.String()
+		if strings.Count(output, "PLUGIN_ID") != 4 {
+			t.Errorf("expected the selected header in all four sections:\n%s", output)
+		}
+		if !strings.Contains(output, "com.mattermost.confluence") || !strings.Contains(output, "YES ⚠") {
+			t.Errorf("expected selected values in table output:\n%s", output)
+		}
+		if strings.Contains(output, "INSTALLED") {
+			t.Errorf("expected unselected columns to be omitted:\n%s", output)
+		}
+		if !strings.Contains(output, "Summary: 5 plugin(s) total") {
+			t.Errorf("expected summary line:\n%s", output)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteOutput(&buf, sampleResult(), OutputOptions{Format: "csv", Columns: columns}); err != nil {
+			t.Fatalf("WriteOutput() returned error: %v", err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("failed to parse CSV: %v", err)
+		}
+		if strings.Join(records[0], ",") != "plugin_id,update_available,status" {
+			t.Errorf("unexpected header: %v", records[0])
+		}
+		if strings.Join(records[1], ",") != "com.mattermost.confluence,true,enabled" {
+			t.Errorf("unexpected first row: %v", records[1])
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteOutput(&buf, sampleResult(), OutputOptions{Format: "json", Columns: columns}); err != nil {
+			t.Fatalf("WriteOutput() returned error: %v", err)
+		}
+		if !strings.Contains(buf.String(), `"plugin_id": "com.mattermost.confluence",
+      "update_available": true,
+      "status": "enabled"`) {
+			t.Errorf("expected ordered, typed columns in JSON output:\n%s", buf.String())
+		}
+
+		var out struct {
+			Plugins []map[string]interface{} `json:"plugins"`
+			Summary AuditSummary             `json:"summary"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if len(out.Plugins) != 5 || len(out.Plugins[0]) != 3 || out.Summary.Total != 5 {
+			t.Errorf("unexpected JSON structure: %+v", out)
+		}
+		if out.Plugins[2]["update_available"] != nil {
+			t.Errorf("expected null update_available for non-Marketplace plugin, got %v", out.Plugins[2]["update_available"])
+		}
+	})
+}
+
+func TestFormatTable_Color(t *testing.T) {
+	var plain, colored bytes.Buffer
+	if err := WriteOutput(&plain, sampleResult(), OutputOptions{Format: "table"}); err != nil {
+		t.Fatalf("WriteOutput() returned error: %v", err)
+	}
+	if strings.Contains(plain.String(), "\x1b[") {
+		t.Errorf("expected no escape codes without colour:\n%q", plain.String())
+	}
+
+	result := sampleResult()
+	result.Plugins[0].UpdateState = UpdateStateOutdated
+	result.Plugins[1].UpdateState = UpdateStateUpToDate
+	if err := WriteOutput(&colored, result, OutputOptions{Format: "table", Color: true}); err != nil {
+		t.Fatalf("WriteOutput() returned error: %v", err)
+	}
+	output := colored.String()
+
+	for _, want := range []string{
+		"\x1b[1mNAME        INSTALLED  LATEST  UPDATE?  STATUS\x1b[0m\n",
+		"\x1b[31mConfluence  1.3.0      1.4.0   YES ⚠    Enabled\x1b[0m\n",
+		"\x1b[32mWelcomeBot  1.2.0      1.2.0   No       Enabled\x1b[0m\n",
+		"\x1b[90mCalls  1.10.0     Enabled\x1b[0m\n",
+		"\x1b[33mPexip  1.3.0      Disabled\x1b[0m\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected coloured row %q in:\n%s", want, output)
+		}
+	}
+
+	// Stripping the escapes must give the uncoloured layout
+	stripped := strings.NewReplacer("\x1b[1m", "", "\x1b[31m", "", "\x1b[32m", "", "\x1b[33m", "", "\x1b[90m", "", "\x1b[0m", "").Replace(output)
+	if stripped != plain.String() {
+		t.Errorf("coloured output differs from plain output once escapes are removed:\n%s\nvs\n%s", stripped, plain.String())
+	}
+}
+
+func TestFormatTable_Width(t *testing.T) {
+	result := sampleResult()
+	result.Plugins[0].Name = "Confluence Cloud and Server Integration"
+
+	var buf bytes.Buffer
+	if err := WriteOutput(&buf, result, OutputOptions{Format: "table", Width: 50}); err != nil {
+		t.Fatalf("WriteOutput() returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Confluence C…  1.3.0") {
+		t.Errorf("expected truncated name in:\n%s", buf.String())
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "Summary:") {
+			continue
+		}
+		if n := len([]rune(line)); n > 50 {
+			t.Errorf("line is %d characters, wider than 50: %q", n, line)
+		}
+	}
+
+	buf.Reset()
+	if err := WriteOutput(&buf, result, OutputOptions{Format: "table"}); err != nil {
+		t.Fatalf("WriteOutput() returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Confluence Cloud and Server Integration") {
+		t.Errorf("expected full name without a width limit:\n%s", buf.String())
+	}
+}
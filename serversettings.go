@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Server setting check results.
+const (
+	ServerSettingOK   = "ok"
+	ServerSettingWarn = "warn"
+)
+
+// ServerSettingCheck compares one server plugin setting with the hardening
+// profile.
+type ServerSettingCheck struct {
+	Setting     string `json:"setting"`
+	Value       bool   `json:"value"`
+	Default     bool   `json:"-"` // Value is the server default because the setting is unset
+	Recommended bool   `json:"recommended"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason"` // The risk when Value differs from Recommended
+}
+
+// ServerSettingsReport is the server's plugin-related configuration checked
+// against the hardening profile.
+type ServerSettingsReport struct {
+	Checks   []ServerSettingCheck `json:"checks"`
+	Warnings int                  `json:"warnings"`
+}
+
+// hardeningProfile lists the recommended values of the server's plugin
+// settings, the default used when a setting is unset, and the risk of
+// departing from the recommendation.
+var hardeningProfile = []struct {
+	setting     string
+	value       func(*model.PluginSettings) *bool
+	fallback    bool
+	recommended bool
+	reason      string
+}{
+	{"PluginSettings.EnableUploads", func(s *model.PluginSettings) *bool { return s.EnableUploads }, false, false,
+		"plugin bundles from any source can be uploaded"},
+	{"PluginSettings.RequirePluginSignature", func(s *model.PluginSettings) *bool { return s.RequirePluginSignature }, false, true,
+		"plugins not signed by Mattermost or a trusted key can be installed"},
+	{"PluginSettings.AutomaticPrepackagedPlugins", func(s *model.PluginSettings) *bool { return s.AutomaticPrepackagedPlugins }, true, false,
+		"plugins shipped with the server are installed without an admin choosing the version"},
+	{"PluginSettings.EnableMarketplace", func(s *model.PluginSettings) *bool { return s.EnableMarketplace }, true, false,
+		"plugins can be installed from the System Console Marketplace"},
+	{"PluginSettings.EnableRemoteMarketplace", func(s *model.PluginSettings) *bool { return s.EnableRemoteMarketplace }, true, false,
+		"the server fetches and installs plugins from the internet"},
+	{"PluginSettings.AllowInsecureDownloadURL", func(s *model.PluginSettings) *bool { return s.AllowInsecureDownloadURL }, false, false,
+		"plugins can be downloaded over plain HTTP"},
+}
+
+// EvaluateServerSettings checks cfg's plugin settings against the hardening
+// profile.
+func EvaluateServerSettings(cfg *model.Config) *ServerSettingsReport {
+	report := &ServerSettingsReport{Checks: []ServerSettingCheck{}}
+	for _, rule := range hardeningProfile {
+		check := ServerSettingCheck{Setting: rule.setting, Recommended: rule.recommended, Status: ServerSettingOK, Reason: rule.reason}
+		if v := rule.value(&cfg.PluginSettings); v != nil {
+			check.Value = *v
+		} else {
+			check.Value, check.Default = rule.fallback, true
+		}
+		if check.Value != check.Recommended {
+			check.Status = ServerSettingWarn
+			report.Warnings++
+		}
+		report.Checks = append(report.Checks, check)
+	}
+	return report
+}
+
+// DisplayValue renders the check's value, noting when it is the default.
+func (c ServerSettingCheck) DisplayValue() string {
+	v := strconv.FormatBool(c.Value)
+	if c.Default {
+		v += " (default)"
+	}
+	return v
+}
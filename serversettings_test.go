@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+func TestEvaluateServerSettings(t *testing.T) {
+	hardened := &model.Config{}
+	hardened.PluginSettings = model.PluginSettings{
+		EnableUploads:               model.NewPointer(false),
+		RequirePluginSignature:      model.NewPointer(true),
+		AutomaticPrepackagedPlugins: model.NewPointer(false),
+		EnableMarketplace:           model.NewPointer(false),
+		EnableRemoteMarketplace:     model.NewPointer(false),
+		AllowInsecureDownloadURL:    model.NewPointer(false),
+	}
+	permissive := &model.Config{}
+	permissive.PluginSettings = model.PluginSettings{
+		EnableUploads:            model.NewPointer(true),
+		RequirePluginSignature:   model.NewPointer(false),
+		AllowInsecureDownloadURL: model.NewPointer(true),
+	}
+
+	tests := []struct {
+		name string
+		cfg  *model.Config
+		want []string // settings with warnings
+	}{
+		{"hardened", hardened, nil},
+		{"unset settings use server defaults", &model.Config{}, []string{
+			"PluginSettings.RequirePluginSignature",
+			"PluginSettings.AutomaticPrepackagedPlugins",
+			"PluginSettings.EnableMarketplace",
+			"PluginSettings.EnableRemoteMarketplace",
+		}},
+		{"permissive", permissive, []string{
+			"PluginSettings.EnableUploads",
+			"PluginSettings.RequirePluginSignature",
+			"PluginSettings.AutomaticPrepackagedPlugins",
+			"PluginSettings.EnableMarketplace",
+			"PluginSettings.EnableRemoteMarketplace",
+			"PluginSettings.AllowInsecureDownloadURL",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := EvaluateServerSettings(tt.cfg)
+			if len(report.Checks) != len(hardeningProfile) {
+				t.Fatalf("expected %d checks, got %d", len(hardeningProfile), len(report.Checks))
+			}
+			var got []string
+			for _, c := range report.Checks {
+				if c.Status == ServerSettingWarn {
+					got = append(got, c.Setting)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") || report.Warnings != len(tt.want) {
+				t.Errorf("warnings = %v (%d), want %v", got, report.Warnings, tt.want)
+			}
+		})
+	}
+
+	if got := EvaluateServerSettings(&model.Config{}).Checks[0].DisplayValue(); got != "false (default)" {
+		t.Errorf("DisplayValue() of an unset setting = %q, want \"false (default)\"", got)
+	}
+}
+
+func TestRunAudit_AuditServerSettings(t *testing.T) {
+	cfg := &model.Config{}
+	cfg.PluginSettings.EnableUploads = model.NewPointer(true)
+	mm := &mockConfigClient{
+		mockMMClient: mockMMClient{plugins: []InstalledPlugin{{ID: "com.example.a", Name: "A", Version: "1.0.0", Status: "enabled"}}},
+		cfg:          cfg,
+	}
+
+	result, err := RunAudit(context.Background(), mm, AuditOptions{AuditServerSettings: true}, noopLogger)
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+	if result.ServerSettings == nil || result.Summary.ServerSettingsWarnings != 5 {
+		t.Fatalf("expected 5 server settings warnings, got %+v", result.ServerSettings)
+	}
+	if result.SettingsAudited || result.Plugins[0].SettingsIssues != nil {
+		t.Error("per-plugin settings should not be audited without AuditSettings")
+	}
+
+	var buf bytes.Buffer
+	if err := FormatOutput(&buf, result, "table"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "=== Server Plugin Settings (5 warning(s)) ===") ||
+		!strings.Contains(buf.String(), "plugin bundles from any source can be uploaded") {
+		t.Errorf("table output missing server settings section:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := FormatOutput(&buf, result, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		ServerSettings *ServerSettingsReport `json:"server_plugin_settings"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ServerSettings == nil || out.ServerSettings.Warnings != 5 || out.ServerSettings.Checks[0].Setting != "PluginSettings.EnableUploads" {
+		t.Errorf("JSON server_plugin_settings = %+v", out.ServerSettings)
+	}
+
+	buf.Reset()
+	if err := FormatOutput(&buf, result, "ndjson"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], `"record_type":"server_plugin_settings"`) {
+		t.Errorf("expected plugin, server_plugin_settings and summary records, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := FormatOutput(&buf, result, "xlsx"); err != nil {
+		t.Fatal(err)
+	}
+	parts := readXLSX(t, buf.Bytes())
+	if names := sheetNames(t, parts["xl/workbook.xml"]); names[len(names)-1] != "Server Settings" {
+		t.Errorf("expected a Server Settings sheet, got %v", names)
+	}
+
+	// Without the option, JSON has no server_plugin_settings object
+	result, _ = RunAudit(context.Background(), mm, AuditOptions{}, noopLogger)
+	buf.Reset()
+	FormatOutput(&buf, result, "json")
+	if strings.Contains(buf.String(), "server_plugin_settings") {
+		t.Error("server_plugin_settings present without AuditServerSettings")
+	}
+}
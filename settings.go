@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Plugin setting issues reported by --audit-settings.
+const (
+	SettingIssueStateMismatch = "state-mismatch" // PluginSettings.PluginStates disagrees with the plugin's status
+	SettingIssueRequiredEmpty = "required-empty" // A setting the plugin needs has no value
+	SettingIssuePlainSecret   = "plain-secret"   // A secret is stored in a setting not marked secret
+	SettingIssueNonDefault    = "non-default"    // A value differs from the manifest's default
+)
+
+// redactedValue replaces secret values in every output format.
+const redactedValue = "********"
+
+// SettingFinding is one issue with a plugin's configuration.
+type SettingFinding struct {
+	Issue   string `json:"issue"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`   // Redacted for secrets
+	Default string `json:"default"` // From the manifest's settings_schema
+	Message string `json:"message"`
+}
+
+// ConfigSource provides the server configuration for --audit-settings.
+type ConfigSource interface {
+	GetConfig(ctx context.Context) (*model.Config, error)
+}
+
+// errNoConfig reports that an option needing the server configuration was
+// used with a source that cannot provide it.
+func errNoConfig() error {
+	return configError("error: --audit-settings, --audit-server-settings and --orphans need the server configuration, which this source cannot provide.", nil)
+}
+
+// secretNameHints are fragments of setting keys and display names that
+// suggest the value is a credential.
+var secretNameHints = []string{
+	"password", "passwd", "secret", "token", "apikey", "privatekey", "encryptionkey",
+	"accesskey", "signingkey", "credential",
+}
+
+// manifestSettings returns the settings declared in a manifest's schema,
+// including those inside sections.
+func manifestSettings(m *model.Manifest) []*model.PluginSetting {
+	if m == nil || m.SettingsSchema == nil {
+		return nil
+	}
+	settings := append([]*model.PluginSetting(nil), m.SettingsSchema.Settings...)
+	for _, section := range m.SettingsSchema.Sections {
+		settings = append(settings, section.Settings...)
+	}
+	return settings
+}
+
+// auditSettings checks p's configuration in cfg against its settings schema.
+// Secret values never leave this function unredacted.
+func auditSettings(p InstalledPlugin, cfg *model.Config) []SettingFinding {
+	findings := []SettingFinding{}
+
+	state, hasState := cfg.PluginSettings.PluginStates[p.ID]
+	configEnabled := hasState && state != nil && state.Enable
+	switch {
+	case configEnabled && p.Status == "disabled":
+		findings = append(findings, SettingFinding{
+			Issue:   SettingIssueStateMismatch,
+			Key:     "PluginStates",
+			Value:   "enabled",
+			Message: "enabled in PluginSettings.PluginStates but not running",
+		})
+	case !configEnabled && p.Status == "enabled":
+		findings = append(findings, SettingFinding{
+			Issue:   SettingIssueStateMismatch,
+			Key:     "PluginStates",
+			Value:   "disabled",
+			Message: "running but not enabled in PluginSettings.PluginStates",
+		})
+	}
+
+	// Saved keys are lower-cased by the server's config loader
+	values := make(map[string]interface{})
+	for k, v := range cfg.PluginSettings.Plugins[p.ID] {
+		values[strings.ToLower(k)] = v
+	}
+
+	declared := make(map[string]bool)
+	for _, s := range p.Settings {
+		if s == nil || s.Key == "" {
+			continue
+		}
+		key := strings.ToLower(s.Key)
+		declared[key] = true
+
+		raw, saved := values[key]
+		value := settingString(raw)
+		effective := value
+		if !saved {
+			effective = settingString(s.Default)
+		}
+		secret := s.Secret || s.Type == "generated"
+		plainSecret := !secret && saved && isPlainSecret(raw, s.Type) && value != settingString(s.Default) &&
+			looksSecret(s.Key, s.DisplayName, value)
+		shown := value
+		if secret || plainSecret {
+			shown = redactIfSet(value)
+		}
+
+		switch {
+		case effective == "" && p.Status == "enabled" && settingRequired(s):
+			findings = append(findings, SettingFinding{
+				Issue:   SettingIssueRequiredEmpty,
+				Key:     s.Key,
+				Default: settingString(s.Default),
+				Message: "has no value",
+			})
+		case plainSecret:
+			findings = append(findings, SettingFinding{
+				Issue:   SettingIssuePlainSecret,
+				Key:     s.Key,
+				Value:   shown,
+				Default: settingString(s.Default),
+				Message: "looks like a secret but is not marked secret, so it is shown in the System Console and exported unredacted",
+			})
+		case !secret && saved && s.Default != nil && value != settingString(s.Default):
+			findings = append(findings, SettingFinding{
+				Issue:   SettingIssueNonDefault,
+				Key:     s.Key,
+				Value:   truncate(80, strings.Join(strings.Fields(shown), " ")),
+				Default: settingString(s.Default),
+				Message: "differs from the default",
+			})
+		}
+	}
+
+	// Saved settings the schema doesn't declare can still hold credentials
+	var undeclared []string
+	for key := range values {
+		if !declared[key] {
+			undeclared = append(undeclared, key)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, key := range undeclared {
+		if raw := values[key]; isPlainSecret(raw, "") && looksSecret(key, "", raw.(string)) {
+			findings = append(findings, SettingFinding{
+				Issue:   SettingIssuePlainSecret,
+				Key:     key,
+				Value:   redactedValue,
+				Message: "looks like a secret in a setting the manifest does not declare",
+			})
+		}
+	}
+	return findings
+}
+
+// settingRequired reports whether a plugin can't work without a value for s.
+// Manifests have no "required" flag, so this covers the settings that must be
+// filled in: generated keys and option lists with nothing selected.
+func settingRequired(s *model.PluginSetting) bool {
+	switch s.Type {
+	case "generated":
+		return true
+	case "dropdown", "radio":
+		return len(s.Options) > 0
+	}
+	return false
+}
+
+// isPlainSecret reports whether raw is a free-text value that could hold a
+// credential: a non-empty string, not the server's redaction placeholder, in
+// a text setting.
+func isPlainSecret(raw interface{}, settingType string) bool {
+	value, ok := raw.(string)
+	if !ok || value == "" || value == model.FakeSetting {
+		return false
+	}
+	return settingType == "" || settingType == "text" || settingType == "longtext"
+}
+
+// looksSecret reports whether a setting's name or value suggests a credential.
+func looksSecret(key, displayName, value string) bool {
+	name := strings.NewReplacer("_", "", "-", "", " ", "", ".", "").Replace(strings.ToLower(key + " " + displayName))
+	for _, hint := range secretNameHints {
+		if strings.Contains(name, hint) {
+			return true
+		}
+	}
+	return strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN ")
+}
+
+func redactIfSet(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// settingString renders a setting value from JSON or YAML for comparison and
+// display; nil is "".
+func settingString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// configWith returns a config holding one plugin's state and saved settings.
+func configWith(id string, enabled *bool, values map[string]interface{}) *model.Config {
+	cfg := &model.Config{}
+	cfg.PluginSettings.PluginStates = map[string]*model.PluginState{}
+	if enabled != nil {
+		cfg.PluginSettings.PluginStates[id] = &model.PluginState{Enable: *enabled}
+	}
+	cfg.PluginSettings.Plugins = map[string]map[string]interface{}{id: values}
+	return cfg
+}
+
+func TestAuditSettings(t *testing.T) {
+	on, off := true, false
+	settings := []*model.PluginSetting{
+		{Key: "Mode", Type: "dropdown", Options: []*model.PluginOption{{Value: "a"}, {Value: "b"}}},
+		{Key: "EncryptionKey", Type: "generated", Secret: true},
+		{Key: "WebhookToken", Type: "text"},
+		{Key: "EnableTokenAuth", Type: "bool", Default: false},
+		{Key: "MaxResults", Type: "number", Default: float64(10)},
+		{Key: "ClientSecret", Type: "text", Secret: true, Default: ""},
+		{Key: "Banner", Type: "longtext", Default: "hello"},
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		state  *bool
+		values map[string]interface{}
+		want   []string // issue:key:value
+	}{
+		{
+			name:   "clean configuration",
+			status: "enabled",
+			state:  &on,
+			values: map[string]interface{}{"mode": "a", "encryptionkey": "abc123", "maxresults": float64(10)},
+			want:   nil,
+		},
+		{
+			name:   "required settings empty",
+			status: "enabled",
+			state:  &on,
+			values: map[string]interface{}{},
+			want:   []string{"required-empty:Mode:", "required-empty:EncryptionKey:"},
+		},
+		{
+			name:   "required settings ignored while disabled",
+			status: "disabled",
+			state:  &off,
+			values: map[string]interface{}{},
+			want:   nil,
+		},
+		{
+			name:   "plain secret is redacted",
+			status: "enabled",
+			state:  &on,
+			values: map[string]interface{}{"mode": "a", "encryptionkey": "abc123", "webhooktoken": "s3cr3t-value"},
+			want:   []string{"plain-secret:WebhookToken:********"},
+		},
+		{
+			name:   "non-default values, secrets never shown",
+			status: "enabled",
+			state:  &on,
+			values: map[string]interface{}{"Mode": "b", "EncryptionKey": "abc123", "EnableTokenAuth": true, "MaxResults": float64(25), "ClientSecret": "hunter2", "Banner": "line one\nline two"},
+			want:   []string{"non-default:EnableTokenAuth:true", "non-default:MaxResults:25", "non-default:Banner:line one line two"},
+		},
+		{
+			name:   "undeclared secret",
+			status: "enabled",
+			state:  &on,
+			values: map[string]interface{}{"mode": "a", "encryptionkey": "abc123", "legacy_api_key": "xyz", "legacypassword": model.FakeSetting},
+			want:   []string{"plain-secret:legacy_api_key:********"},
+		},
+		{
+			name:   "running but not enabled in config",
+			status: "enabled",
+			values: map[string]interface{}{"mode": "a", "encryptionkey": "abc123"},
+			want:   []string{"state-mismatch:PluginStates:disabled"},
+		},
+		{
+			name:   "enabled in config but not running",
+			status: "disabled",
+			state:  &on,
+			values: map[string]interface{}{},
+			want:   []string{"state-mismatch:PluginStates:enabled"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := InstalledPlugin{ID: "com.example.plugin", Status: tt.status, Settings: settings}
+			var got []string
+			for _, f := range auditSettings(p, configWith(p.ID, tt.state, tt.values)) {
+				got = append(got, f.Issue+":"+f.Key+":"+f.Value)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("auditSettings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestSettings(t *testing.T) {
+	m := &model.Manifest{SettingsSchema: &model.PluginSettingsSchema{
+		Settings: []*model.PluginSetting{{Key: "A"}},
+		Sections: []*model.PluginSettingsSection{{Key: "s", Settings: []*model.PluginSetting{{Key: "B"}, {Key: "C"}}}},
+	}}
+	var keys []string
+	for _, s := range manifestSettings(m) {
+		keys = append(keys, s.Key)
+	}
+	if strings.Join(keys, ",") != "A,B,C" {
+		t.Errorf("manifestSettings() keys = %v, want A,B,C", keys)
+	}
+	if manifestSettings(&model.Manifest{}) != nil {
+		t.Error("expected no settings without a schema")
+	}
+}
+
+type mockConfigClient struct {
+	mockMMClient
+	cfg *model.Config
+}
+
+func (m *mockConfigClient) GetConfig(ctx context.Context) (*model.Config, error) {
+	return m.cfg, nil
+}
+
+func TestRunAudit_AuditSettings(t *testing.T) {
+	on := true
+	mm := &mockConfigClient{
+		mockMMClient: mockMMClient{plugins: []InstalledPlugin{
+			{ID: "com.example.a", Name: "A", Version: "1.0.0", Status: "enabled",
+				Settings: []*model.PluginSetting{{Key: "APIToken", Type: "text"}}},
+			{ID: "com.example.b", Name: "B", Version: "1.0.0", Status: "enabled"},
+		}},
+		cfg: configWith("com.example.a", &on, map[string]interface{}{"apitoken": "abcdef"}),
+	}
+	mm.cfg.PluginSettings.PluginStates["com.example.b"] = &model.PluginState{Enable: true}
+
+	result, err := RunAudit(context.Background(), mm, AuditOptions{AuditSettings: true}, noopLogger)
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+	if !result.SettingsAudited || result.Summary.SettingsIssues != 1 {
+		t.Fatalf("expected 1 settings issue, got audited=%v issues=%d", result.SettingsAudited, result.Summary.SettingsIssues)
+	}
+	for _, p := range result.Plugins {
+		if p.SettingsIssues == nil {
+			t.Errorf("%s: settings_issues not set", p.PluginID)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, format := range []string{"table", "json", "xlsx"} {
+		buf.Reset()
+		if err := FormatOutput(&buf, result, format); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if strings.Contains(buf.String(), "abcdef") {
+			t.Errorf("%s output leaks a secret value", format)
+		}
+	}
+	buf.Reset()
+	FormatOutput(&buf, result, "table")
+	if !strings.Contains(buf.String(), "=== Plugin Settings (1) ===") || !strings.Contains(buf.String(), "plain-secret") {
+		t.Errorf("table output missing settings section:\n%s", buf.String())
+	}
+	buf.Reset()
+	FormatOutput(&buf, result, "json")
+	var out struct {
+		Plugins []struct {
+			PluginID string           `json:"plugin_id"`
+			Settings []SettingFinding `json:"settings"`
+		} `json:"plugins"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Plugins[0].Settings) != 1 || out.Plugins[0].Settings[0].Value != redactedValue {
+		t.Errorf("JSON settings = %+v, want one redacted finding", out.Plugins[0].Settings)
+	}
+
+	// A client without configuration access is a configuration error
+	_, err = RunAudit(context.Background(), &mm.mockMMClient, AuditOptions{AuditSettings: true}, noopLogger)
+	if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitConfigError {
+		t.Errorf("expected a config error without a ConfigSource, got %v", err)
+	}
+}
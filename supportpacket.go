@@ -0,0 +1,215 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"gopkg.in/yaml.v3"
+)
+
+// supportPacketMaxFile bounds how much of any one file in a support packet is
+// read, so a corrupt or hostile zip cannot exhaust memory.
+const supportPacketMaxFile = 32 << 20
+
+// SupportPacket is a MattermostClient backed by a support packet zip generated
+// from System Console > Reporting > Support Packet (or mmctl system
+// supportpacket). It never contacts the server; Marketplace data must come
+// from a Marketplace queried directly.
+type SupportPacket struct {
+	path          string
+	plugins       []InstalledPlugin
+	serverVersion string
+	platform      string
+	config        *model.Config
+}
+
+// supportPacketPlugins is plugins.json, which lists enabled and disabled
+// manifests; older packets use the active/inactive keys of the plugins API.
+type supportPacketPlugins struct {
+	Enabled  []model.Manifest `json:"enabled"`
+	Disabled []model.Manifest `json:"disabled"`
+	Active   []model.Manifest `json:"active"`
+	Inactive []model.Manifest `json:"inactive"`
+}
+
+// supportPacketLegacy is support_packet.yaml, which diagnostics.yaml replaced
+// in newer releases.
+type supportPacketLegacy struct {
+	ServerOS           string `yaml:"server_os"`
+	ServerArchitecture string `yaml:"server_architecture"`
+	ServerVersion      string `yaml:"server_version"`
+}
+
+// OpenSupportPacket reads the plugin list, server version and configuration
+// from the support packet zip at path. The plugin list is required; the
+// version and configuration are used when present.
+func OpenSupportPacket(path string) (*SupportPacket, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, configError(fmt.Sprintf("error: unable to read support packet %s: %v", path, err), err)
+	}
+	defer zr.Close()
+
+	p := &SupportPacket{path: path}
+	invalid := func(name string, err error) error {
+		return configError(fmt.Sprintf("error: support packet %s has an invalid %s: %v", path, name, err), err)
+	}
+
+	data, err := readSupportPacketFile(&zr.Reader, "plugins.json")
+	if err != nil {
+		return nil, invalid("plugins.json", err)
+	}
+	if data == nil {
+		return nil, configError(fmt.Sprintf("error: support packet %s has no plugins.json. Generate a new packet from an up-to-date Mattermost server.", path), nil)
+	}
+	var list supportPacketPlugins
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, invalid("plugins.json", err)
+	}
+	for _, m := range append(list.Enabled, list.Active...) {
+		p.plugins = append(p.plugins, installedFromManifest(m, "enabled"))
+	}
+	for _, m := range append(list.Disabled, list.Inactive...) {
+		p.plugins = append(p.plugins, installedFromManifest(m, "disabled"))
+	}
+
+	if data, err := readSupportPacketFile(&zr.Reader, "diagnostics.yaml"); err != nil {
+		return nil, invalid("diagnostics.yaml", err)
+	} else if data != nil {
+		var diag model.SupportPacketDiagnostics
+		if err := yaml.Unmarshal(data, &diag); err != nil {
+			return nil, invalid("diagnostics.yaml", err)
+		}
+		p.serverVersion = diag.Server.Version
+		p.platform = supportPacketPlatform(diag.Server.OS, diag.Server.Architecture)
+	} else if data, err := readSupportPacketFile(&zr.Reader, "support_packet.yaml"); err != nil {
+		return nil, invalid("support_packet.yaml", err)
+	} else if data != nil {
+		var legacy supportPacketLegacy
+		if err := yaml.Unmarshal(data, &legacy); err != nil {
+			return nil, invalid("support_packet.yaml", err)
+		}
+		p.serverVersion = legacy.ServerVersion
+		p.platform = supportPacketPlatform(legacy.ServerOS, legacy.ServerArchitecture)
+	}
+
+	if data, err := readSupportPacketFile(&zr.Reader, "sanitized_config.json"); err != nil {
+		return nil, invalid("sanitized_config.json", err)
+	} else if data != nil {
+		var cfg model.Config
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, invalid("sanitized_config.json", err)
+		}
+		p.config = &cfg
+	}
+
+	return p, nil
+}
+
+// readSupportPacketFile returns the contents of the file called name, or nil
+// if the packet has none. Cluster packets hold a copy per node in
+// subdirectories, so the shallowest match wins, then the first by path.
+func readSupportPacketFile(zr *zip.Reader, name string) ([]byte, error) {
+	var matches []*zip.File
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() && path.Base(f.Name) == name {
+			matches = append(matches, f)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		di, dj := strings.Count(matches[i].Name, "/"), strings.Count(matches[j].Name, "/")
+		if di != dj {
+			return di < dj
+		}
+		return matches[i].Name < matches[j].Name
+	})
+
+	rc, err := matches[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, supportPacketMaxFile+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > supportPacketMaxFile {
+		return nil, fmt.Errorf("file is larger than %d MiB", supportPacketMaxFile>>20)
+	}
+	return data, nil
+}
+
+// installedFromManifest converts a plugin manifest to an InstalledPlugin.
+func installedFromManifest(m model.Manifest, status string) InstalledPlugin {
+	return InstalledPlugin{
+		ID:              m.Id,
+		Name:            m.Name,
+		Version:         m.Version,
+		HomepageURL:     m.HomepageURL,
+		ReleaseNotesURL: m.ReleaseNotesURL,
+		Status:          status,
+		HasServer:       m.Server != nil,
+		HasWebapp:       m.Webapp != nil,
+		Settings:        manifestSettings(&m),
+	}
+}
+
+// supportPacketPlatform returns the Marketplace platform name (e.g.
+// "linux-amd64") for a server's OS and architecture, or "" if either is unknown.
+func supportPacketPlatform(os, arch string) string {
+	if os == "" || arch == "" {
+		return ""
+	}
+	return strings.ToLower(os) + "-" + strings.ToLower(arch)
+}
+
+// GetPlugins returns the plugins listed in the packet.
+func (p *SupportPacket) GetPlugins(ctx context.Context) ([]InstalledPlugin, error) {
+	return p.plugins, nil
+}
+
+// GetServerVersion returns the server version recorded in the packet.
+func (p *SupportPacket) GetServerVersion(ctx context.Context) (string, error) {
+	if p.serverVersion == "" {
+		return "", fmt.Errorf("support packet %s does not record the server version", p.path)
+	}
+	return p.serverVersion, nil
+}
+
+// GetMarketplacePlugins always fails: a packet has no Marketplace proxy, so
+// callers query a Marketplace directly instead.
+func (p *SupportPacket) GetMarketplacePlugins(ctx context.Context) (map[string]*MarketplacePlugin, error) {
+	return nil, configError("error: a support packet has no Marketplace data. Use --marketplace-url to query a Marketplace directly.", nil)
+}
+
+// GetConfig returns the packet's sanitized server configuration, with secrets
+// already redacted by the server.
+func (p *SupportPacket) GetConfig(ctx context.Context) (*model.Config, error) {
+	if p.config == nil {
+		return nil, configError(fmt.Sprintf("error: support packet %s has no sanitized_config.json.", p.path), nil)
+	}
+	return p.config, nil
+}
+
+// SiteURL returns the server's configured Site URL, or "" if unknown.
+func (p *SupportPacket) SiteURL() string {
+	if p.config == nil || p.config.ServiceSettings.SiteURL == nil {
+		return ""
+	}
+	return strings.TrimRight(*p.config.ServiceSettings.SiteURL, "/")
+}
+
+// Platform returns the server's Marketplace platform, or "" if unknown.
+func (p *SupportPacket) Platform() string {
+	return p.platform
+}
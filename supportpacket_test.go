@@ -0,0 +1,156 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSupportPacket creates a zip in a temporary directory holding files.
+func writeSupportPacket(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "packet.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return path
+}
+
+const testPacketPlugins = `{
+  "enabled": [
+    {"id": "com.mattermost.confluence", "name": "Confluence", "version": "1.3.0", "server": {"executable": "server/dist/plugin"}, "webapp": {"bundle_path": "webapp/dist/main.js"}},
+    {"id": "playbooks", "name": "Playbooks", "version": "2.1.0", "homepage_url": "https://github.com/mattermost/mattermost-plugin-playbooks", "server": {"executable": "server/dist/plugin"}}
+  ],
+  "disabled": [
+    {"id": "com.example.internal", "name": "Internal", "version": "0.4.0", "release_notes_url": "https://example.com/notes"}
+  ]
+}`
+
+func TestOpenSupportPacket(t *testing.T) {
+	path := writeSupportPacket(t, map[string]string{
+		"mattermost_support_packet/plugins.json":          testPacketPlugins,
+		"mattermost_support_packet/diagnostics.yaml":      "version: 2\nserver:\n  os: Linux\n  architecture: arm64\n  version: 10.5.1\n",
+		"mattermost_support_packet/sanitized_config.json": `{"ServiceSettings": {"SiteURL": "https://chat.example.com/"}, "SqlSettings": {"DataSource": "********************************"}}`,
+		// A second cluster node's copy is ignored in favour of the shallower file
+		"mattermost_support_packet/node2/diagnostics.yaml": "server:\n  version: 9.0.0\n",
+	})
+
+	packet, err := OpenSupportPacket(path)
+	if err != nil {
+		t.Fatalf("OpenSupportPacket() returned error: %v", err)
+	}
+
+	plugins, _ := packet.GetPlugins(context.Background())
+	if len(plugins) != 3 {
+		t.Fatalf("expected 3 plugins, got %d", len(plugins))
+	}
+	want := []InstalledPlugin{
+		{ID: "com.mattermost.confluence", Name: "Confluence", Version: "1.3.0", Status: "enabled", HasServer: true, HasWebapp: true},
+		{ID: "playbooks", Name: "Playbooks", Version: "2.1.0", HomepageURL: "https://github.com/mattermost/mattermost-plugin-playbooks", Status: "enabled", HasServer: true},
+		{ID: "com.example.internal", Name: "Internal", Version: "0.4.0", ReleaseNotesURL: "https://example.com/notes", Status: "disabled"},
+	}
+	for i := range want {
+		if !reflect.DeepEqual(plugins[i], want[i]) {
+			t.Errorf("plugin %d = %+v, want %+v", i, plugins[i], want[i])
+		}
+	}
+
+	if v, err := packet.GetServerVersion(context.Background()); err != nil || v != "10.5.1" {
+		t.Errorf("GetServerVersion() = %q, %v; want 10.5.1", v, err)
+	}
+	if got := packet.Platform(); got != "linux-arm64" {
+		t.Errorf("Platform() = %q, want linux-arm64", got)
+	}
+	if got := packet.SiteURL(); got != "https://chat.example.com" {
+		t.Errorf("SiteURL() = %q, want https://chat.example.com", got)
+	}
+	if cfg, err := packet.GetConfig(context.Background()); err != nil || *cfg.SqlSettings.DataSource != "********************************" {
+		t.Errorf("GetConfig() did not return the sanitized config: %v", err)
+	}
+	if _, err := packet.GetMarketplacePlugins(context.Background()); err == nil {
+		t.Error("expected GetMarketplacePlugins() to fail for a support packet")
+	}
+}
+
+func TestOpenSupportPacket_Legacy(t *testing.T) {
+	path := writeSupportPacket(t, map[string]string{
+		"plugins.json":        `{"active": [{"id": "com.mattermost.calls", "name": "Calls", "version": "0.29.0"}], "inactive": []}`,
+		"support_packet.yaml": "server_os: linux\nserver_architecture: amd64\nserver_version: 9.5.2\n",
+	})
+
+	packet, err := OpenSupportPacket(path)
+	if err != nil {
+		t.Fatalf("OpenSupportPacket() returned error: %v", err)
+	}
+	plugins, _ := packet.GetPlugins(context.Background())
+	if len(plugins) != 1 || plugins[0].ID != "com.mattermost.calls" || plugins[0].Status != "enabled" {
+		t.Errorf("unexpected plugins: %+v", plugins)
+	}
+	if v, _ := packet.GetServerVersion(context.Background()); v != "9.5.2" {
+		t.Errorf("GetServerVersion() = %q, want 9.5.2", v)
+	}
+	if packet.SiteURL() != "" {
+		t.Errorf("expected no Site URL without a config, got %q", packet.SiteURL())
+	}
+	if _, err := packet.GetConfig(context.Background()); err == nil {
+		t.Error("expected GetConfig() to fail without sanitized_config.json")
+	}
+}
+
+func TestOpenSupportPacket_Errors(t *testing.T) {
+	notZip := filepath.Join(t.TempDir(), "packet.zip")
+	os.WriteFile(notZip, []byte("not a zip"), 0o644)
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing.zip")},
+		{"not a zip", notZip},
+		{"no plugins.json", writeSupportPacket(t, map[string]string{"diagnostics.yaml": "server:\n  version: 10.5.0\n"})},
+		{"invalid plugins.json", writeSupportPacket(t, map[string]string{"plugins.json": "{"})},
+		{"invalid diagnostics.yaml", writeSupportPacket(t, map[string]string{"plugins.json": "{}", "diagnostics.yaml": "server: [\n"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := OpenSupportPacket(tt.path)
+			if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitConfigError {
+				t.Errorf("expected a config error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunAudit_SupportPacket(t *testing.T) {
+	packet, err := OpenSupportPacket(writeSupportPacket(t, map[string]string{"plugins.json": testPacketPlugins}))
+	if err != nil {
+		t.Fatalf("OpenSupportPacket() returned error: %v", err)
+	}
+	mp := &mockMMClient{mpPlugins: map[string]*MarketplacePlugin{
+		"com.mattermost.confluence": {Version: "1.4.0"},
+	}}
+
+	result, err := RunAudit(context.Background(), withMarketplace(packet, mp), AuditOptions{}, noopLogger)
+	if err != nil {
+		t.Fatalf("RunAudit() returned error: %v", err)
+	}
+	if result.Summary.Total != 3 || result.Summary.Outdated != 1 || result.Summary.Disabled != 1 {
+		t.Errorf("unexpected summary: %+v", result.Summary)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+//go:embed templates/*.tmpl
+var builtinTemplateFS embed.FS
+
+// BuiltinTemplates lists the names accepted by --template, sorted.
+func BuiltinTemplates() []string {
+	entries, _ := builtinTemplateFS.ReadDir("templates")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".tmpl"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Template is a parsed output template. The built-in html template is an
+// html/template, so the values it prints are escaped for HTML; the rest are
+// text/templates.
+type Template interface {
+	Execute(w io.Writer, data any) error
+}
+
+// LoadTemplate parses a template from file if given, otherwise the built-in
+// template called name.
+func LoadTemplate(name, file string) (Template, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, configError(fmt.Sprintf("error: unable to read template file %s: %v", file, err), err)
+		}
+		tmpl, err := template.New(path.Base(file)).Funcs(templateFuncs).Parse(string(data))
+		if err != nil {
+			return nil, configError(fmt.Sprintf("error: invalid template %s: %v", file, err), err)
+		}
+		return tmpl, nil
+	}
+
+	data, err := builtinTemplateFS.ReadFile("templates/" + name + ".tmpl")
+	if name == "" || err != nil {
+		return nil, configError(fmt.Sprintf("error: unknown template %q. Use --template-file, or --template with one of: %s.",
+			name, strings.Join(BuiltinTemplates(), ", ")), nil)
+	}
+	if name == "html" {
+		return htmltemplate.Must(htmltemplate.New(name).Funcs(templateFuncs).Parse(string(data))), nil
+	}
+	return template.Must(template.New(name).Funcs(templateFuncs).Parse(string(data))), nil
+}
+
+// formatTemplate executes tmpl against result. Without color, the color helper
+// returns its text unchanged.
+func formatTemplate(w io.Writer, result *AuditResult, tmpl Template, color bool) error {
+	if tmpl == nil {
+		return fmt.Errorf("template format requires a template")
+	}
+	if !color {
+		plain := template.FuncMap{
+			"color": func(_, s string) string { return s },
+		}
+		switch t := tmpl.(type) {
+		case *template.Template:
+			tmpl = template.Must(t.Clone()).Funcs(plain)
+		case *htmltemplate.Template:
+			tmpl = htmltemplate.Must(t.Clone()).Funcs(plain)
+		}
+	}
+	return tmpl.Execute(w, result)
+}
+
+// templateFuncs are the helpers available to output templates, in addition to
+// the text/template built-ins.
+var templateFuncs = template.FuncMap{
+	// Text
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"join":     strings.Join,
+	"replace":  strings.ReplaceAll,
+	"contains": strings.Contains,
+	"repeat":   strings.Repeat,
+	"padRight": func(width int, s string) string {
+		return s + strings.Repeat(" ", max(0, width-utf8.RuneCountInString(s)))
+	},
+	"padLeft": func(width int, s string) string {
+		return strings.Repeat(" ", max(0, width-utf8.RuneCountInString(s))) + s
+	},
+	"truncate": truncate,
+	"default": func(def string, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+	"color":      colorize,
+	"capitalize": capitalizeStatus,
+
+	// Versions
+	"compareVersions": func(a, b string) int {
+		c, _ := CompareVersions(a, b)
+		return c
+	},
+	"versionNewer": func(a, b string) bool {
+		c, ok := CompareVersions(a, b)
+		return ok && c > 0
+	},
+
+	// Plugins
+	"updateIndicator": updateIndicator,
+	"bySource": func(source string, plugins []PluginReport) []PluginReport {
+		return selectPlugins(plugins, func(p PluginReport) bool { return p.Source == source })
+	},
+	"byState": func(state string, plugins []PluginReport) []PluginReport {
+		return selectPlugins(plugins, func(p PluginReport) bool { return p.UpdateState == state })
+	},
+	"where": func(expr string, plugins []PluginReport) ([]PluginReport, error) {
+		w, err := ParseWhere(expr)
+		if err != nil {
+			return nil, err
+		}
+		return selectPlugins(plugins, w.Match), nil
+	},
+	"deref": func(i *int) string {
+		if i == nil {
+			return ""
+		}
+		return fmt.Sprint(*i)
+	},
+
+	// Time and data
+	"now": time.Now,
+	"formatTime": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"json": func(v interface{}) (string, error) {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return string(data), err
+	},
+}
+
+func selectPlugins(plugins []PluginReport, match func(PluginReport) bool) []PluginReport {
+	var selected []PluginReport
+	for _, p := range plugins {
+		if match(p) {
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
+
+// truncate shortens s to at most width runes, ending with "…" if cut.
+func truncate(width int, s string) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	if width == 1 {
+		return "…"
+	}
+	return string(runes[:width-1]) + "…"
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleResultWithServer() *AuditResult {
+	result := sampleResult()
+	result.Plugins[0].UpdateState = UpdateStateOutdated
+	result.Plugins[0].UpdateSeverity = SeverityMinor
+	result.Server = &ServerInfo{
+		URL:       "https://mattermost.example.com",
+		Version:   "10.5.0",
+		AuditedAt: time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC),
+	}
+	return result
+}
+
+func TestBuiltinTemplates(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect []string
+	}{
+		{"email", []string{
+			"Subject: Mattermost plugin audit for https://mattermost.example.com: 1 update(s) available",
+			"(Mattermost 10.5.0), run 14 March 2025 09:30 UTC",
+			"  - Confluence: 1.3.0 -> 1.4.0 (minor update)",
+			"  - Pexip 1.3.0 (disabled)",
+		}},
+		{"ticket", []string{
+			"Update 1 Mattermost plugin(s) on https://mattermost.example.com",
+			"|Confluence (com.mattermost.confluence)|1.3.0|1.4.0|minor|Enabled|",
+			"* Marketplace plugins outdated: 1 of 2",
+		}},
+		{"markdown", []string{
+			"# Mattermost Plugin Audit: https://mattermost.example.com",
+			"| Confluence | `com.mattermost.confluence` | 1.3.0 | 1.4.0 | YES ⚠ (minor) | Enabled | marketplace |",
+			"| Calls | `com.mattermost.calls` | 1.10.0 | - | No | Enabled | bundled |",
+			"**Summary:** 5 plugin(s)",
+		}},
+		{"html", []string{
+			"<h1>Mattermost Plugin Audit: https://mattermost.example.com</h1>",
+			`<tr class="outdated"><td>Confluence</td><td><code>com.mattermost.confluence</code></td><td>1.3.0</td><td>1.4.0</td><td>YES ⚠ (minor)</td><td>Enabled</td><td>marketplace</td></tr>`,
+			"<p><strong>Summary:</strong> 5 plugin(s)",
+		}},
+	}
+
+	if got := strings.Join(BuiltinTemplates(), ","); got != "email,html,markdown,ticket" {
+		t.Errorf("unexpected built-in templates: %s", got)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := LoadTemplate(tt.name, "")
+			if err != nil {
+				t.Fatalf("LoadTemplate() returned error: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := WriteOutput(&buf, sampleResultWithServer(), OutputOptions{Format: "template", Template: tmpl}); err != nil {
+				t.Fatalf("WriteOutput() returned error: %v", err)
+			}
+			for _, want := range tt.expect {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected output to contain %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestBuiltinTemplates_WithoutServer(t *testing.T) {
+	for _, name := range BuiltinTemplates() {
+		tmpl, err := LoadTemplate(name, "")
+		if err != nil {
+			t.Fatalf("LoadTemplate(%q) returned error: %v", name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, &AuditResult{}); err != nil {
+			t.Errorf("template %q failed on an empty result: %v", name, err)
+		}
+	}
+}
+
+func TestBuiltinTemplates_HTMLEscapes(t *testing.T) {
+	tmpl, err := LoadTemplate("html", "")
+	if err != nil {
+		t.Fatalf("LoadTemplate() returned error: %v", err)
+	}
+	result := sampleResultWithServer()
+	result.Server.URL = "https://chat.example.com/?a=1&b=<2>"
+	result.Plugins[0].Source = "<i>custom</i>"
+	result.Plugins[0].Status = "<b>enabled</b>"
+	var buf bytes.Buffer
+	if err := formatTemplate(&buf, result, tmpl, false); err != nil {
+		t.Fatalf("formatTemplate() returned error: %v", err)
+	}
+	for _, want := range []string{"?a=1&amp;b=&lt;2&gt;", "<td>&lt;i&gt;custom&lt;/i&gt;</td>", "&lt;b&gt;"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "<i>") || strings.Contains(buf.String(), "<b>") {
+		t.Errorf("plugin fields were not escaped:\n%s", buf.String())
+	}
+}
+
+func TestLoadTemplate_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.tmpl")
+	content := `{{ range where "update_available == true" .Plugins }}{{ padRight 12 .Name }}|{{ padLeft 7 .InstalledVersion }}|{{ truncate 6 .MarketplaceURL }}|{{ compareVersions .InstalledVersion .LatestVersion }}|{{ color "red" (upper .Status) }}{{ end }}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := LoadTemplate("", path)
+	if err != nil {
+		t.Fatalf("LoadTemplate() returned error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, sampleResult()); err != nil {
+		t.Fatalf("Execute() returned error: %v", err)
+	}
+	want := "Confluence  |  1.3.0|https…|-1|\x1b[31mENABLED\x1b[0m"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestLoadTemplate_Errors(t *testing.T) {
+	badPath := filepath.Join(t.TempDir(), "bad.tmpl")
+	if err := os.WriteFile(badPath, []byte("{{ range .Plugins }}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		file     string
+	}{
+		{"unknown built-in", "invoice", ""},
+		{"no template", "", ""},
+		{"missing file", "", filepath.Join(t.TempDir(), "missing.tmpl")},
+		{"parse error", "", badPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadTemplate(tt.template, tt.file)
+			if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitConfigError {
+				t.Errorf("expected config error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Issue tracker backends for --tracker.
+const (
+	TrackerJira   = "jira"
+	TrackerGitHub = "github"
+	TrackerREST   = "rest"
+)
+
+// DefaultTrackerLabel marks the issues this tool manages.
+const DefaultTrackerLabel = "mm-plugin-audit"
+
+// TrackerConfig holds the --tracker flags.
+type TrackerConfig struct {
+	Kind            string // TrackerJira, TrackerGitHub or TrackerREST
+	URL             string
+	Project         string // Jira project key, or GitHub owner/name
+	Username        string // Jira only
+	Token           string
+	IssueType       string // Jira only
+	CloseTransition string // Jira only
+	Label           string
+	ServerName      string // Identifies the audited server in issues in place of its URL's host
+}
+
+// Validate checks that the flags needed by the backend are set.
+func (c *TrackerConfig) Validate() error {
+	c.Kind = strings.ToLower(c.Kind)
+	if c.Label == "" {
+		c.Label = DefaultTrackerLabel
+	}
+	if strings.ContainsAny(c.Label, " ,") {
+		return configError(fmt.Sprintf("error: invalid --tracker-label %q. Labels cannot contain spaces or commas.", c.Label), nil)
+	}
+	if strings.ContainsAny(c.ServerName, " \t\r\n}") {
+		return configError(fmt.Sprintf("error: invalid --tracker-server-name %q. Names cannot contain spaces or braces.", c.ServerName), nil)
+	}
+	if c.URL != "" {
+		if _, err := ParseWebhookURL(c.URL); err != nil {
+			return configError(fmt.Sprintf("error: invalid --tracker-url %q. Use an http:// or https:// URL.", c.URL), err)
+		}
+	}
+	switch c.Kind {
+	case TrackerJira:
+		if c.URL == "" || c.Project == "" {
+			return configError("error: --tracker jira requires --tracker-url and --tracker-project (the project key).", nil)
+		}
+		if c.Token == "" {
+			return configError("error: --tracker jira requires an API token. Use --tracker-token or set MM_TRACKER_TOKEN.", nil)
+		}
+	case TrackerGitHub:
+		if _, err := ParseGitHubRepo(c.Project); err != nil {
+			return err
+		}
+		if c.Token == "" {
+			return configError("error: --tracker github requires a token. Use --tracker-token or set MM_TRACKER_TOKEN.", nil)
+		}
+	case TrackerREST:
+		if c.URL == "" {
+			return configError("error: --tracker rest requires --tracker-url.", nil)
+		}
+	default:
+		return configError(fmt.Sprintf("error: invalid --tracker %q. Use jira, github, or rest.", c.Kind), nil)
+	}
+	if c.Kind != TrackerJira && (c.Username != "" || c.IssueType != "" || c.CloseTransition != "") {
+		return configError("error: --tracker-username, --tracker-issue-type and --tracker-close-transition only apply to --tracker jira.", nil)
+	}
+	return nil
+}
+
+// NewIssueTracker returns the backend for a validated config.
+func NewIssueTracker(c TrackerConfig, client *http.Client) IssueTracker {
+	switch c.Kind {
+	case TrackerJira:
+		return &JiraTracker{URL: c.URL, Project: c.Project, IssueType: c.IssueType, Username: c.Username, Token: c.Token,
+			Label: c.Label, CloseTransition: c.CloseTransition, Client: client}
+	case TrackerGitHub:
+		return &GitHubTracker{URL: c.URL, Repo: c.Project, Token: c.Token, Label: c.Label, Client: client}
+	default:
+		return &RESTTracker{URL: c.URL, Token: c.Token, Label: c.Label, Client: client}
+	}
+}
+
+// IssueTracker opens and closes issues in an external tracker. Implementations
+// only see issues carrying their label.
+type IssueTracker interface {
+	// Name identifies the tracker in logs and errors, without secrets.
+	Name() string
+	// OpenIssues returns the open issues carrying the tracker's label.
+	OpenIssues(ctx context.Context) ([]Issue, error)
+	Create(ctx context.Context, spec IssueSpec) (Issue, error)
+	Update(ctx context.Context, issue Issue, spec IssueSpec) error
+	// Close adds comment to the issue and closes it.
+	Close(ctx context.Context, issue Issue, comment string) error
+}
+
+// Issue is an open issue read back from a tracker.
+type Issue struct {
+	Key   string // PROJ-123, #42, or the REST API's id
+	URL   string
+	Title string
+	Body  string
+
+	// From the issue's marker; empty for issues this tool didn't open
+	Fingerprint string
+	Server      string
+	PluginID    string
+	Target      string
+}
+
+// IssueSpec is the issue wanted for one outdated plugin.
+type IssueSpec struct {
+	Fingerprint string
+	Server      string // Host of the audited server, scoping the fingerprint
+	ServerURL   string
+	Plugin      PluginReport
+}
+
+// issueMarker is embedded in every issue body so that later runs can match
+// issues to plugins without keeping any state of their own.
+var issueMarker = regexp.MustCompile(`mm-plugin-audit: fingerprint=([0-9a-f]+) server=(\S*) plugin=(\S+) target=([^\s}]+)`)
+
+// issueFingerprint identifies the issue for updating pluginID to target on
+// server, so that each plugin release is ticketed once per server.
+func issueFingerprint(server, pluginID, target string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(server) + "\n" + strings.ToLower(pluginID) + "\n" + target))
+	return hex.EncodeToString(sum[:8])
+}
+
+// trackerServer returns the name identifying the audited server in issues:
+// name if set, otherwise the host of the server's URL. It is empty only if
+// neither is known.
+func trackerServer(result *AuditResult, name string) (server, serverURL string) {
+	if result.Server != nil {
+		serverURL = result.Server.URL
+	}
+	switch {
+	case name != "":
+		return strings.ToLower(name), serverURL
+	case serverURL == "":
+		return "", ""
+	}
+	if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
+		return strings.ToLower(u.Host), serverURL
+	}
+	return strings.ToLower(serverURL), serverURL
+}
+
+// newIssueSpec returns the issue wanted for the outdated plugin p, naming the
+// server as trackerServer does.
+func newIssueSpec(result *AuditResult, serverName string, p PluginReport) IssueSpec {
+	server, serverURL := trackerServer(result, serverName)
+	return IssueSpec{
+		Fingerprint: issueFingerprint(server, p.PluginID, p.LatestVersion),
+		Server:      server,
+		ServerURL:   serverURL,
+		Plugin:      p,
+	}
+}
+
+// Title names the plugin, target version and server.
+func (s IssueSpec) Title() string {
+	title := fmt.Sprintf("Update %s plugin to %s", s.Plugin.Name, s.Plugin.LatestVersion)
+	if s.Server != "" {
+		title += " on " + s.Server
+	}
+	return title
+}
+
+// Body describes the update in Markdown, or in Jira wiki markup when wiki is
+// set, ending with the issue marker.
+func (s IssueSpec) Body(wiki bool) string {
+	p := s.Plugin
+	code := func(v string) string {
+		if wiki {
+			return "{{" + v + "}}"
+		}
+		return "`" + v + "`"
+	}
+	bold, bullet := "**", "-"
+	if wiki {
+		bold, bullet = "*", "*"
+	}
+
+	var b strings.Builder
+	where := "The plugin audit"
+	if s.ServerURL != "" {
+		where += " of " + s.ServerURL
+	}
+	fmt.Fprintf(&b, "%s found an update for %s%s%s (%s).\n\n", where, bold, p.Name, bold, code(p.PluginID))
+	fmt.Fprintf(&b, "%s Installed version: %s\n", bullet, p.InstalledVersion)
+	latest := p.LatestVersion
+	var detail []string
+	if p.UpdateSeverity != "" {
+		detail = append(detail, p.UpdateSeverity+" update")
+	}
+	if p.ReleasesBehind != nil {
+		detail = append(detail, fmt.Sprintf("%d release(s) behind", *p.ReleasesBehind))
+	}
+	if len(detail) > 0 {
+		latest += " (" + strings.Join(detail, ", ") + ")"
+	}
+	fmt.Fprintf(&b, "%s Latest version: %s\n", bullet, latest)
+	fmt.Fprintf(&b, "%s Status: %s\n", bullet, p.Status)
+	if p.MarketplaceURL != "" {
+		fmt.Fprintf(&b, "%s Marketplace: %s\n", bullet, p.MarketplaceURL)
+	}
+	if p.ReleaseNotesURL != "" {
+		fmt.Fprintf(&b, "%s Release notes: %s\n", bullet, p.ReleaseNotesURL)
+	}
+	b.WriteString("\nThis issue is managed by mm-plugin-audit and is closed automatically once the plugin is updated.\n\n")
+
+	marker := fmt.Sprintf("mm-plugin-audit: fingerprint=%s server=%s plugin=%s target=%s", s.Fingerprint, s.Server, p.PluginID, p.LatestVersion)
+	if wiki {
+		b.WriteString("{{" + marker + "}}")
+	} else {
+		b.WriteString("<!-- " + marker + " -->")
+	}
+	return b.String()
+}
+
+// parseIssueMarker fills the marker fields of issue from its body.
+func parseIssueMarker(issue *Issue) {
+	if m := issueMarker.FindStringSubmatch(issue.Body); m != nil {
+		issue.Fingerprint, issue.Server, issue.PluginID, issue.Target = m[1], m[2], m[3], m[4]
+	}
+}
+
+// sameIssueText reports whether an issue already has the wanted text,
+// ignoring the line-ending and trailing-space changes trackers make.
+func sameIssueText(a, b string) bool {
+	normalize := func(s string) string {
+		return strings.TrimSpace(strings.ReplaceAll(s, "\r\n", "\n"))
+	}
+	return normalize(a) == normalize(b)
+}
+
+// TrackerSync reconciles a tracker with an audit: one open issue per
+// outdated plugin, closed once a later audit shows it updated. The audit has
+// no vulnerability data, so only outdated plugins are ticketed.
+type TrackerSync struct {
+	Tracker    IssueTracker
+	ServerName string // Identifies the server in issues; defaults to the host of its URL
+	Wiki       bool   // Write issue bodies in Jira wiki markup rather than Markdown
+	DryRun     bool   // Log the changes without making them
+	Logf       func(string, ...interface{})
+}
+
+// Run opens an issue for each outdated plugin in result.Plugins that has none,
+// refreshes the text of those that do, and closes the audited server's issues
+// whose plugins, among every installed plugin, are no longer behind the
+// issue's target. Issues for plugins that are still behind are left open
+// even if filters hide them. Duplicates of an issue, say from an earlier run
+// that timed out after the tracker filed it, are closed along with it. Every
+// change is attempted even if some fail. Issues are matched to the server by
+// name, so a server with neither a URL nor a ServerName is refused rather
+// than claiming every other unnamed server's issues.
+func (s *TrackerSync) Run(ctx context.Context, result *AuditResult) error {
+	server, _ := trackerServer(result, s.ServerName)
+	if server == "" {
+		return errNoTrackerServer()
+	}
+	s.Logf("Fetching open issues from %s...", s.Tracker.Name())
+	issues, err := s.Tracker.OpenIssues(ctx)
+	if err != nil {
+		return notifyError(fmt.Sprintf("error: unable to list issues in %s: %v", s.Tracker.Name(), err), err)
+	}
+	open := make(map[string][]Issue) // The first of each is updated, the rest are duplicates
+	for _, issue := range issues {
+		if issue.Fingerprint == "" || issue.Server != server {
+			continue
+		}
+		open[issue.Fingerprint] = append(open[issue.Fingerprint], issue)
+	}
+
+	var failed []string
+	var errs []error
+	fail := func(action string, err error) {
+		err = fmt.Errorf("%s: %w", action, err)
+		failed = append(failed, err.Error())
+		errs = append(errs, err)
+	}
+	var opened, updated, closed int
+
+	wanted := make(map[string]bool)
+	for _, p := range result.Plugins {
+		if p.UpdateState != UpdateStateOutdated {
+			continue
+		}
+		spec := newIssueSpec(result, s.ServerName, p)
+		if wanted[spec.Fingerprint] {
+			continue
+		}
+		wanted[spec.Fingerprint] = true
+
+		var issue Issue
+		existing := open[spec.Fingerprint]
+		if len(existing) > 0 {
+			issue = existing[0]
+		}
+		switch {
+		case len(existing) == 0:
+			s.Logf("%sOpening issue: %s", s.dryRunPrefix(), spec.Title())
+			if s.DryRun {
+				opened++
+				continue
+			}
+			created, err := s.Tracker.Create(ctx, spec)
+			if err != nil {
+				fail("opening issue for "+p.PluginID, err)
+				continue
+			}
+			s.Logf("Opened %s %s", created.Key, created.URL)
+			opened++
+		case !sameIssueText(issue.Title, spec.Title()) || !sameIssueText(issue.Body, spec.Body(s.Wiki)):
+			s.Logf("%sUpdating issue %s: %s", s.dryRunPrefix(), issue.Key, spec.Title())
+			if !s.DryRun {
+				if err := s.Tracker.Update(ctx, issue, spec); err != nil {
+					fail("updating issue "+issue.Key, err)
+					continue
+				}
+			}
+			updated++
+		}
+	}
+
+	installed := result.Installed
+	if installed == nil {
+		installed = result.Plugins
+	}
+	byID := make(map[string]PluginReport)
+	for _, p := range installed {
+		byID[strings.ToLower(p.PluginID)] = p
+	}
+	for fingerprint, existing := range open {
+		if wanted[fingerprint] {
+			continue
+		}
+		comment := closeComment(existing[0], byID, result)
+		if comment == "" {
+			continue
+		}
+		for _, issue := range existing {
+			s.Logf("%sClosing issue %s: %s", s.dryRunPrefix(), issue.Key, comment)
+			if !s.DryRun {
+				if err := s.Tracker.Close(ctx, issue, comment); err != nil {
+					fail("closing issue "+issue.Key, err)
+					continue
+				}
+			}
+			closed++
+		}
+	}
+
+	s.Logf("%s%s: %d opened, %d updated, %d closed", s.dryRunPrefix(), s.Tracker.Name(), opened, updated, closed)
+	if len(errs) > 0 {
+		return notifyError(fmt.Sprintf("error: issue tracker sync with %s failed: %s", s.Tracker.Name(), strings.Join(failed, "; ")), errors.Join(errs...))
+	}
+	return nil
+}
+
+// errNoTrackerServer reports that issues can't be matched to an unnamed server.
+func errNoTrackerServer() error {
+	return configError("error: --tracker needs a name for the audited server, and it has no URL. Set --url, the server's Site URL, or --tracker-server-name.", nil)
+}
+
+func (s *TrackerSync) dryRunPrefix() string {
+	if s.DryRun {
+		return "[dry run] "
+	}
+	return ""
+}
+
+// closeComment explains why issue can be closed, or returns "" if its plugin
+// is still behind the issue's target or can't be compared.
+func closeComment(issue Issue, installed map[string]PluginReport, result *AuditResult) string {
+	p, ok := installed[strings.ToLower(issue.PluginID)]
+	if !ok {
+		return fmt.Sprintf("%s is no longer installed, so this update is no longer needed.", issue.PluginID)
+	}
+	if cmp, ok := CompareVersions(p.InstalledVersion, issue.Target); ok && cmp >= 0 {
+		return fmt.Sprintf("%s is now at version %s.", p.Name, p.InstalledVersion)
+	}
+	if p.UpdateState == UpdateStateOutdated && p.LatestVersion != issue.Target {
+		if _, tracked := findPlugin(result.Plugins, p.PluginID); tracked {
+			return fmt.Sprintf("Superseded by the newer release %s, which has its own issue.", p.LatestVersion)
+		}
+		return fmt.Sprintf("Superseded by the newer release %s.", p.LatestVersion)
+	}
+	return ""
+}
+
+func findPlugin(plugins []PluginReport, id string) (PluginReport, bool) {
+	for _, p := range plugins {
+		if strings.EqualFold(p.PluginID, id) {
+			return p, true
+		}
+	}
+	return PluginReport{}, false
+}
+
+// apiHTTPError is a non-2xx response from a JSON API.
+type apiHTTPError struct {
+	Status int
+	Detail string
+}
+
+func (e *apiHTTPError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("HTTP %d: %s", e.Status, e.Detail)
+	}
+	return fmt.Sprintf("HTTP %d", e.Status)
+}
+
+// jsonRequest sends in as JSON (if non-nil) and decodes the JSON response
+// into out (if non-nil), leaving out unchanged if the response is empty.
+// auth, if set, adds credentials to the request.
+func jsonRequest(ctx context.Context, client *http.Client, method, u string, auth func(*http.Request), in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "mm-plugin-audit/"+version)
+	if auth != nil {
+		auth(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return &apiHTTPError{Status: resp.StatusCode, Detail: strings.TrimSpace(string(detail))}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("unexpected response: %w", err)
+	}
+	return nil
+}
+
+// bearerAuth authenticates with token, if set.
+func bearerAuth(token string) func(*http.Request) {
+	return func(req *http.Request) {
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+}
+
+// RESTTracker manages issues through a generic JSON API:
+//
+//	GET  {URL}/issues?state=open&label=L   list open issues with label L
+//	POST {URL}/issues                      open an issue
+//	PUT  {URL}/issues/{id}                 update an issue
+//	POST {URL}/issues/{id}/close           comment on and close an issue
+//
+// Issues are objects with id, url, title and body, plus the fingerprint,
+// server, plugin_id and target_version that identify them.
+type RESTTracker struct {
+	URL    string
+	Token  string // Sent as a bearer token when set
+	Label  string
+	Client *http.Client
+}
+
+// restIssue is an issue as the generic API exchanges it.
+type restIssue struct {
+	ID               restID   `json:"id,omitempty"`
+	URL              string   `json:"url,omitempty"`
+	Title            string   `json:"title"`
+	Body             string   `json:"body"`
+	Labels           []string `json:"labels,omitempty"`
+	Fingerprint      string   `json:"fingerprint"`
+	Server           string   `json:"server"`
+	PluginID         string   `json:"plugin_id"`
+	TargetVersion    string   `json:"target_version"`
+	InstalledVersion string   `json:"installed_version,omitempty"`
+	UpdateSeverity   string   `json:"update_severity,omitempty"`
+}
+
+// restID accepts an id sent as either a string or a number.
+type restID string
+
+func (id *restID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = restID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("id must be a string or number: %w", err)
+	}
+	*id = restID(n.String())
+	return nil
+}
+
+// Name returns the API's scheme and host.
+func (t *RESTTracker) Name() string {
+	if u, err := url.Parse(t.URL); err == nil && u.Host != "" {
+		return "issue API " + u.Scheme + "://" + u.Host
+	}
+	return "issue API"
+}
+
+func (t *RESTTracker) endpoint(parts ...string) string {
+	u := strings.TrimRight(t.URL, "/") + "/issues"
+	for _, p := range parts {
+		u += "/" + url.PathEscape(p)
+	}
+	return u
+}
+
+func (t *RESTTracker) OpenIssues(ctx context.Context) ([]Issue, error) {
+	var list []restIssue
+	q := url.Values{"state": {"open"}, "label": {t.Label}}
+	if err := jsonRequest(ctx, t.Client, http.MethodGet, t.endpoint()+"?"+q.Encode(), bearerAuth(t.Token), nil, &list); err != nil {
+		return nil, err
+	}
+	issues := make([]Issue, 0, len(list))
+	for _, ri := range list {
+		issue := Issue{
+			Key: string(ri.ID), URL: ri.URL, Title: ri.Title, Body: ri.Body,
+			Fingerprint: ri.Fingerprint, Server: ri.Server, PluginID: ri.PluginID, Target: ri.TargetVersion,
+		}
+		if issue.Fingerprint == "" {
+			parseIssueMarker(&issue)
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func (t *RESTTracker) payload(spec IssueSpec) restIssue {
+	return restIssue{
+		Title:            spec.Title(),
+		Body:             spec.Body(false),
+		Labels:           []string{t.Label},
+		Fingerprint:      spec.Fingerprint,
+		Server:           spec.Server,
+		PluginID:         spec.Plugin.PluginID,
+		TargetVersion:    spec.Plugin.LatestVersion,
+		InstalledVersion: spec.Plugin.InstalledVersion,
+		UpdateSeverity:   spec.Plugin.UpdateSeverity,
+	}
+}
+
+func (t *RESTTracker) Create(ctx context.Context, spec IssueSpec) (Issue, error) {
+	var created restIssue
+	if err := jsonRequest(ctx, t.Client, http.MethodPost, t.endpoint(), bearerAuth(t.Token), t.payload(spec), &created); err != nil {
+		return Issue{}, err
+	}
+	return Issue{Key: string(created.ID), URL: created.URL}, nil
+}
+
+func (t *RESTTracker) Update(ctx context.Context, issue Issue, spec IssueSpec) error {
+	return jsonRequest(ctx, t.Client, http.MethodPut, t.endpoint(issue.Key), bearerAuth(t.Token), t.payload(spec), nil)
+}
+
+func (t *RESTTracker) Close(ctx context.Context, issue Issue, comment string) error {
+	body := map[string]string{"comment": comment}
+	return jsonRequest(ctx, t.Client, http.MethodPost, t.endpoint(issue.Key, "close"), bearerAuth(t.Token), body, nil)
+}
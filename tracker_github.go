@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultGitHubAPIURL is the GitHub REST API; GitHub Enterprise Server uses
+// https://HOST/api/v3.
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// githubPageSize is the number of issues requested per page.
+const githubPageSize = 100
+
+// GitHubTracker manages issues in a GitHub repository.
+type GitHubTracker struct {
+	URL    string // API base URL; empty for DefaultGitHubAPIURL
+	Repo   string // owner/name
+	Token  string
+	Label  string
+	Client *http.Client
+}
+
+// githubIssue is the part of a GitHub issue this tool reads.
+type githubIssue struct {
+	Number      int         `json:"number"`
+	HTMLURL     string      `json:"html_url"`
+	Title       string      `json:"title"`
+	Body        string      `json:"body"`
+	PullRequest interface{} `json:"pull_request,omitempty"`
+}
+
+// ParseGitHubRepo validates an owner/name repository.
+func ParseGitHubRepo(s string) (string, error) {
+	owner, name, ok := strings.Cut(s, "/")
+	if !ok || owner == "" || name == "" || strings.ContainsAny(name, "/ ") {
+		return "", configError(fmt.Sprintf("error: invalid GitHub repository %q. Use --tracker-project owner/name.", s), nil)
+	}
+	return s, nil
+}
+
+// Name returns the repository.
+func (t *GitHubTracker) Name() string {
+	return "GitHub repository " + t.Repo
+}
+
+func (t *GitHubTracker) auth(req *http.Request) {
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+}
+
+func (t *GitHubTracker) api(path string) string {
+	base := t.URL
+	if base == "" {
+		base = DefaultGitHubAPIURL
+	}
+	owner, name, _ := strings.Cut(t.Repo, "/")
+	return strings.TrimRight(base, "/") + "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name) + "/issues" + path
+}
+
+// OpenIssues lists the open issues with the label, skipping pull requests,
+// which the issues API also returns.
+func (t *GitHubTracker) OpenIssues(ctx context.Context) ([]Issue, error) {
+	var issues []Issue
+	for page := 1; ; page++ {
+		q := url.Values{"state": {"open"}, "labels": {t.Label}, "per_page": {strconv.Itoa(githubPageSize)}, "page": {strconv.Itoa(page)}}
+		var list []githubIssue
+		if err := jsonRequest(ctx, t.Client, http.MethodGet, t.api("")+"?"+q.Encode(), t.auth, nil, &list); err != nil {
+			return nil, err
+		}
+		for _, gi := range list {
+			if gi.PullRequest != nil {
+				continue
+			}
+			issue := Issue{Key: "#" + strconv.Itoa(gi.Number), URL: gi.HTMLURL, Title: gi.Title, Body: gi.Body}
+			parseIssueMarker(&issue)
+			issues = append(issues, issue)
+		}
+		if len(list) < githubPageSize {
+			return issues, nil
+		}
+	}
+}
+
+func (t *GitHubTracker) Create(ctx context.Context, spec IssueSpec) (Issue, error) {
+	body := map[string]interface{}{"title": spec.Title(), "body": spec.Body(false), "labels": []string{t.Label}}
+	var created githubIssue
+	if err := jsonRequest(ctx, t.Client, http.MethodPost, t.api(""), t.auth, body, &created); err != nil {
+		return Issue{}, err
+	}
+	return Issue{Key: "#" + strconv.Itoa(created.Number), URL: created.HTMLURL}, nil
+}
+
+func (t *GitHubTracker) Update(ctx context.Context, issue Issue, spec IssueSpec) error {
+	body := map[string]string{"title": spec.Title(), "body": spec.Body(false)}
+	return jsonRequest(ctx, t.Client, http.MethodPatch, t.api("/"+strings.TrimPrefix(issue.Key, "#")), t.auth, body, nil)
+}
+
+func (t *GitHubTracker) Close(ctx context.Context, issue Issue, comment string) error {
+	path := "/" + strings.TrimPrefix(issue.Key, "#")
+	if err := jsonRequest(ctx, t.Client, http.MethodPost, t.api(path+"/comments"), t.auth, map[string]string{"body": comment}, nil); err != nil {
+		return err
+	}
+	body := map[string]string{"state": "closed", "state_reason": "completed"}
+	return jsonRequest(ctx, t.Client, http.MethodPatch, t.api(path), t.auth, body, nil)
+}
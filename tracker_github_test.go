@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// githubStandIn serves the parts of the GitHub issues API that GitHubTracker
+// uses, for the repository acme/ops.
+type githubStandIn struct {
+	mu       sync.Mutex
+	pages    [][]map[string]interface{}
+	queries  []string
+	created  map[string]interface{}
+	patches  map[string][]map[string]string
+	comments map[string]string
+	headers  []http.Header
+}
+
+func (g *githubStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.headers = append(g.headers, r.Header.Clone())
+	path, ok := strings.CutPrefix(r.URL.Path, "/api/v3/repos/acme/ops/issues")
+	switch {
+	case !ok:
+		http.NotFound(w, r)
+	case r.Method == http.MethodGet && path == "":
+		g.queries = append(g.queries, r.URL.RawQuery)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		list := []map[string]interface{}{}
+		if page >= 1 && page <= len(g.pages) {
+			list = g.pages[page-1]
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPost && path == "":
+		json.NewDecoder(r.Body).Decode(&g.created)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"number": 7, "html_url": "https://github.example.com/acme/ops/issues/7"}`))
+	case r.Method == http.MethodPatch:
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		g.patches[path] = append(g.patches[path], body)
+		w.Write([]byte(`{}`))
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/comments"):
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		g.comments[strings.TrimSuffix(path, "/comments")] = body["body"]
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestGitHubTracker(t *testing.T) {
+	result := trackerTestResult(outdatedPlugin("jira", "4.0.5", "4.1.0"), upToDatePlugin("zoom", "1.2.0"), outdatedPlugin("calls", "1.0.0", "1.1.0"))
+	// A full first page forces a second request
+	first := make([]map[string]interface{}, githubPageSize)
+	for i := range first {
+		first[i] = map[string]interface{}{"number": 100 + i, "title": "Pull request", "body": "", "pull_request": map[string]string{"url": "x"}}
+	}
+	first[0] = map[string]interface{}{"number": 1, "title": "old", "body": newIssueSpec(result, "", outdatedPlugin("jira", "4.0.0", "4.1.0")).Body(false)}
+	gh := &githubStandIn{
+		pages: [][]map[string]interface{}{
+			first,
+			{{"number": 2, "title": "zoom", "body": newIssueSpec(result, "", outdatedPlugin("zoom", "1.0.0", "1.2.0")).Body(false)}},
+		},
+		patches:  make(map[string][]map[string]string),
+		comments: make(map[string]string),
+	}
+	srv := httptest.NewServer(gh)
+	defer srv.Close()
+
+	tracker := NewIssueTracker(TrackerConfig{Kind: TrackerGitHub, URL: srv.URL + "/api/v3/", Project: "acme/ops", Token: "ghp_x", Label: DefaultTrackerLabel}, testHTTPClient(t, 0))
+	if err := (&TrackerSync{Tracker: tracker, Logf: noopLogger}).Run(context.Background(), result); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	if len(gh.queries) != 2 || gh.queries[0] != "labels=mm-plugin-audit&page=1&per_page=100&state=open" {
+		t.Errorf("queries = %q", gh.queries)
+	}
+	if gh.created["title"] != "Update calls plugin to 1.1.0 on mattermost.example.com" || !strings.Contains(gh.created["body"].(string), "<!-- mm-plugin-audit: fingerprint=") {
+		t.Errorf("created = %v", gh.created)
+	}
+	if labels, _ := gh.created["labels"].([]interface{}); len(labels) != 1 || labels[0] != DefaultTrackerLabel {
+		t.Errorf("labels = %v", gh.created["labels"])
+	}
+	// #1 has a stale installed version, so its text is refreshed
+	if p := gh.patches["/1"]; len(p) != 1 || !strings.Contains(p[0]["body"], "Installed version: 4.0.5") {
+		t.Errorf("patches to #1 = %v", p)
+	}
+	if !strings.Contains(gh.comments["/2"], "zoom is now at version 1.2.0") {
+		t.Errorf("comments = %v", gh.comments)
+	}
+	if p := gh.patches["/2"]; len(p) != 1 || p[0]["state"] != "closed" || p[0]["state_reason"] != "completed" {
+		t.Errorf("patches to #2 = %v", p)
+	}
+	for _, h := range gh.headers {
+		if h.Get("Authorization") != "Bearer ghp_x" || h.Get("Accept") != "application/vnd.github+json" {
+			t.Errorf("headers = %v", h)
+		}
+	}
+}
+
+func TestParseGitHubRepo(t *testing.T) {
+	for _, s := range []string{"acme/ops", "acme/ops.github.io"} {
+		if _, err := ParseGitHubRepo(s); err != nil {
+			t.Errorf("ParseGitHubRepo(%q) returned error: %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "acme", "acme/", "/ops", "acme/ops/issues"} {
+		if _, err := ParseGitHubRepo(s); err == nil {
+			t.Errorf("ParseGitHubRepo(%q) accepted an invalid repository", s)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultJiraIssueType is the issue type of new Jira issues.
+const DefaultJiraIssueType = "Task"
+
+// jiraPageSize is the number of issues requested per search page.
+const jiraPageSize = 100
+
+// JiraTracker manages issues in a Jira project through the REST API v2,
+// which both Jira Cloud and Data Center provide.
+type JiraTracker struct {
+	URL             string // Base URL, e.g. https://example.atlassian.net
+	Project         string // Project key
+	IssueType       string
+	Username        string // With Token, basic auth for Jira Cloud; empty sends Token as a bearer PAT
+	Token           string
+	Label           string
+	CloseTransition string // Transition used to close issues; default: the first into a Done status
+	Client          *http.Client
+
+	legacySearch bool // The server lacks /search/jql, so page with startAt
+}
+
+// jiraIssue is the part of a Jira issue this tool reads.
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string `json:"summary"`
+		Description string `json:"description"`
+	} `json:"fields"`
+}
+
+// Name returns the project and host.
+func (t *JiraTracker) Name() string {
+	if u, err := url.Parse(t.URL); err == nil && u.Host != "" {
+		return "Jira project " + t.Project + " at " + u.Host
+	}
+	return "Jira project " + t.Project
+}
+
+func (t *JiraTracker) auth(req *http.Request) {
+	if t.Username != "" {
+		req.SetBasicAuth(t.Username, t.Token)
+	} else if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+}
+
+func (t *JiraTracker) api(path string) string {
+	return strings.TrimRight(t.URL, "/") + "/rest/api/2/" + path
+}
+
+// OpenIssues searches for the project's unresolved issues with the label.
+// Jira Cloud pages /search/jql with a token; Data Center only has /search,
+// paged by offset, which is used if /search/jql is missing.
+func (t *JiraTracker) OpenIssues(ctx context.Context) ([]Issue, error) {
+	jql := fmt.Sprintf("project = %s AND labels = %s AND statusCategory != Done ORDER BY created ASC", jqlQuote(t.Project), jqlQuote(t.Label))
+	var issues []Issue
+	var token string
+	for start := 0; ; {
+		q := url.Values{"jql": {jql}, "fields": {"summary,description"}, "maxResults": {strconv.Itoa(jiraPageSize)}}
+		var page struct {
+			Issues        []jiraIssue `json:"issues"`
+			NextPageToken string      `json:"nextPageToken"`
+			Total         int         `json:"total"`
+		}
+		var err error
+		if !t.legacySearch {
+			if token != "" {
+				q.Set("nextPageToken", token)
+			}
+			err = jsonRequest(ctx, t.Client, http.MethodGet, t.api("search/jql")+"?"+q.Encode(), t.auth, nil, &page)
+			var httpErr *apiHTTPError
+			if errors.As(err, &httpErr) && httpErr.Status == http.StatusNotFound && start == 0 {
+				t.legacySearch = true
+				continue
+			}
+		} else {
+			q.Set("startAt", strconv.Itoa(start))
+			err = jsonRequest(ctx, t.Client, http.MethodGet, t.api("search")+"?"+q.Encode(), t.auth, nil, &page)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ji := range page.Issues {
+			issue := Issue{
+				Key:   ji.Key,
+				URL:   strings.TrimRight(t.URL, "/") + "/browse/" + ji.Key,
+				Title: ji.Fields.Summary,
+				Body:  ji.Fields.Description,
+			}
+			parseIssueMarker(&issue)
+			issues = append(issues, issue)
+		}
+		start += len(page.Issues)
+		if t.legacySearch {
+			if len(page.Issues) == 0 || start >= page.Total {
+				return issues, nil
+			}
+		} else if token = page.NextPageToken; token == "" {
+			return issues, nil
+		}
+	}
+}
+
+func (t *JiraTracker) Create(ctx context.Context, spec IssueSpec) (Issue, error) {
+	issueType := t.IssueType
+	if issueType == "" {
+		issueType = DefaultJiraIssueType
+	}
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": t.Project},
+		"issuetype":   map[string]string{"name": issueType},
+		"summary":     spec.Title(),
+		"description": spec.Body(true),
+		"labels":      []string{t.Label},
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := jsonRequest(ctx, t.Client, http.MethodPost, t.api("issue"), t.auth, map[string]interface{}{"fields": fields}, &created); err != nil {
+		return Issue{}, err
+	}
+	return Issue{Key: created.Key, URL: strings.TrimRight(t.URL, "/") + "/browse/" + created.Key}, nil
+}
+
+func (t *JiraTracker) Update(ctx context.Context, issue Issue, spec IssueSpec) error {
+	fields := map[string]interface{}{"summary": spec.Title(), "description": spec.Body(true)}
+	return jsonRequest(ctx, t.Client, http.MethodPut, t.api("issue/"+url.PathEscape(issue.Key)), t.auth, map[string]interface{}{"fields": fields}, nil)
+}
+
+// Close comments on the issue, then moves it through CloseTransition or, by
+// default, the first transition into a Done status.
+func (t *JiraTracker) Close(ctx context.Context, issue Issue, comment string) error {
+	path := "issue/" + url.PathEscape(issue.Key)
+	var transitions struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := jsonRequest(ctx, t.Client, http.MethodGet, t.api(path+"/transitions"), t.auth, nil, &transitions); err != nil {
+		return err
+	}
+	var id string
+	for _, tr := range transitions.Transitions {
+		if t.CloseTransition != "" && strings.EqualFold(tr.Name, t.CloseTransition) ||
+			t.CloseTransition == "" && tr.To.StatusCategory.Key == "done" {
+			id = tr.ID
+			break
+		}
+	}
+	if id == "" {
+		if t.CloseTransition != "" {
+			return fmt.Errorf("no transition named %q is available", t.CloseTransition)
+		}
+		return errors.New("no transition to a Done status is available; set --tracker-close-transition")
+	}
+
+	if err := jsonRequest(ctx, t.Client, http.MethodPost, t.api(path+"/comment"), t.auth, map[string]string{"body": comment}, nil); err != nil {
+		return err
+	}
+	return jsonRequest(ctx, t.Client, http.MethodPost, t.api(path+"/transitions"), t.auth,
+		map[string]interface{}{"transition": map[string]string{"id": id}}, nil)
+}
+
+// jqlQuote quotes s as a JQL string literal.
+func jqlQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// jiraStandIn serves the parts of the Jira REST API v2 that JiraTracker uses.
+// Without /search/jql it behaves like Data Center, paging /search by offset.
+type jiraStandIn struct {
+	legacy bool
+
+	mu          sync.Mutex
+	issues      []map[string]interface{} // key, fields
+	jql         []string
+	created     map[string]interface{}
+	updated     map[string]map[string]interface{}
+	comments    map[string]string
+	transitions map[string]string
+	users       []string
+}
+
+func (j *jiraStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	user, _, _ := r.BasicAuth()
+	j.users = append(j.users, user)
+	path := strings.TrimPrefix(r.URL.Path, "/rest/api/2/")
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && (path == "search/jql" && !j.legacy || path == "search" && j.legacy):
+		j.jql = append(j.jql, q.Get("jql"))
+		// One issue per page, to exercise paging
+		start := 0
+		if j.legacy {
+			start, _ = strconv.Atoi(q.Get("startAt"))
+		} else if tok := q.Get("nextPageToken"); tok != "" {
+			start, _ = strconv.Atoi(tok)
+		}
+		page := map[string]interface{}{"issues": j.issues[start:min(start+1, len(j.issues))], "total": len(j.issues)}
+		if !j.legacy && start+1 < len(j.issues) {
+			page["nextPageToken"] = strconv.Itoa(start + 1)
+		}
+		json.NewEncoder(w).Encode(page)
+	case r.Method == http.MethodPost && path == "issue":
+		var body map[string]map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		j.created = body["fields"]
+		json.NewEncoder(w).Encode(map[string]string{"id": "10003", "key": "OPS-3"})
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "issue/"):
+		var body map[string]map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		j.updated[strings.TrimPrefix(path, "issue/")] = body["fields"]
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/transitions"):
+		list := `{"transitions": [
+			{"id": "11", "name": "Start", "to": {"statusCategory": {"key": "indeterminate"}}},
+			{"id": "21", "name": "Won't Do", "to": {"statusCategory": {"key": "done"}}},
+			{"id": "31", "name": "Done", "to": {"statusCategory": {"key": "done"}}}]}`
+		w.Write([]byte(list))
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/transitions"):
+		var body struct {
+			Transition struct{ ID string } `json:"transition"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		j.transitions[strings.TrimSuffix(strings.TrimPrefix(path, "issue/"), "/transitions")] = body.Transition.ID
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/comment"):
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		j.comments[strings.TrimSuffix(strings.TrimPrefix(path, "issue/"), "/comment")] = body["body"]
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "1"}`))
+	default:
+		http.Error(w, `{"errorMessages": ["not found"]}`, http.StatusNotFound)
+	}
+}
+
+func jiraIssueFixture(key string, spec IssueSpec) map[string]interface{} {
+	return map[string]interface{}{"key": key, "fields": map[string]string{"summary": spec.Title(), "description": spec.Body(true) + "\r\n"}}
+}
+
+func TestJiraTracker(t *testing.T) {
+	tests := []struct {
+		name            string
+		legacy          bool
+		closeTransition string
+		wantTransition  string
+	}{
+		{"cloud search, first done transition", false, "", "21"},
+		{"data center search, named transition", true, "done", "31"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := trackerTestResult(outdatedPlugin("jira", "4.0.0", "4.1.0"), upToDatePlugin("zoom", "1.2.0"), outdatedPlugin("calls", "1.0.0", "1.1.0"))
+			jira := &jiraStandIn{
+				legacy:      tt.legacy,
+				updated:     make(map[string]map[string]interface{}),
+				comments:    make(map[string]string),
+				transitions: make(map[string]string),
+				issues: []map[string]interface{}{
+					jiraIssueFixture("OPS-1", newIssueSpec(result, "", result.Plugins[0])),
+					{"key": "OPS-9", "fields": map[string]string{"summary": "Filed by hand", "description": "No marker here"}},
+					jiraIssueFixture("OPS-2", newIssueSpec(result, "", outdatedPlugin("zoom", "1.0.0", "1.2.0"))),
+				},
+			}
+			srv := httptest.NewServer(jira)
+			defer srv.Close()
+			tracker := NewIssueTracker(TrackerConfig{
+				Kind: TrackerJira, URL: srv.URL, Project: "OPS", Username: "audit@example.com", Token: "t",
+				Label: DefaultTrackerLabel, CloseTransition: tt.closeTransition,
+			}, testHTTPClient(t, 0))
+
+			sync := &TrackerSync{Tracker: tracker, Wiki: true, Logf: noopLogger}
+			if err := sync.Run(context.Background(), result); err != nil {
+				t.Fatalf("Run() returned error: %v", err)
+			}
+
+			if len(jira.jql) != 3 || jira.jql[0] != `project = "OPS" AND labels = "mm-plugin-audit" AND statusCategory != Done ORDER BY created ASC` {
+				t.Errorf("searches = %q, want 3 pages of the label search", jira.jql)
+			}
+			// OPS-1 matches despite the trailing CRLF Jira added, so only calls is opened
+			if len(jira.updated) != 0 {
+				t.Errorf("unchanged issue was updated: %v", jira.updated)
+			}
+			if jira.created == nil || jira.created["summary"] != "Update calls plugin to 1.1.0 on mattermost.example.com" {
+				t.Fatalf("created = %v", jira.created)
+			}
+			if project := jira.created["project"].(map[string]interface{}); project["key"] != "OPS" {
+				t.Errorf("project = %v", project)
+			}
+			if issueType := jira.created["issuetype"].(map[string]interface{}); issueType["name"] != DefaultJiraIssueType {
+				t.Errorf("issuetype = %v", issueType)
+			}
+			if desc := jira.created["description"].(string); !strings.Contains(desc, "{{mm-plugin-audit: fingerprint=") || !strings.Contains(desc, "* Installed version: 1.0.0") {
+				t.Errorf("description is not wiki markup with a marker:\n%s", desc)
+			}
+
+			// zoom is up to date, so OPS-2 is commented on and closed
+			if !strings.Contains(jira.comments["OPS-2"], "zoom is now at version 1.2.0") || jira.transitions["OPS-2"] != tt.wantTransition {
+				t.Errorf("comments = %v, transitions = %v, want OPS-2 closed with transition %s", jira.comments, jira.transitions, tt.wantTransition)
+			}
+			if _, ok := jira.transitions["OPS-9"]; ok {
+				t.Error("closed an issue this tool didn't open")
+			}
+			for _, user := range jira.users {
+				if user != "audit@example.com" {
+					t.Errorf("basic auth user = %q", user)
+				}
+			}
+		})
+	}
+}
+
+func TestJiraTracker_NoCloseTransition(t *testing.T) {
+	jira := &jiraStandIn{updated: map[string]map[string]interface{}{}, comments: map[string]string{}, transitions: map[string]string{}}
+	srv := httptest.NewServer(jira)
+	defer srv.Close()
+	tracker := &JiraTracker{URL: srv.URL, Project: "OPS", Token: "t", CloseTransition: "Resolve", Client: testHTTPClient(t, 0)}
+
+	err := tracker.Close(context.Background(), Issue{Key: "OPS-1"}, "done")
+	if err == nil || !strings.Contains(err.Error(), `no transition named "Resolve"`) {
+		t.Errorf("Close() error = %v", err)
+	}
+	if len(jira.comments) != 0 {
+		t.Error("commented on an issue that could not be closed")
+	}
+}
+
+func TestJQLQuote(t *testing.T) {
+	if got := jqlQuote(`a "b" \c`); got != `"a \"b\" \\c"` {
+		t.Errorf("jqlQuote() = %s", got)
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memTracker is an in-memory IssueTracker recording the changes made to it.
+type memTracker struct {
+	issues  map[string]*Issue // By key
+	closed  map[string]string // Comment by key
+	actions []string
+	fail    string // Plugin ID whose issue fails to open
+	next    int
+}
+
+func newMemTracker() *memTracker {
+	return &memTracker{issues: make(map[string]*Issue), closed: make(map[string]string)}
+}
+
+func (m *memTracker) Name() string { return "memory" }
+
+func (m *memTracker) OpenIssues(ctx context.Context) ([]Issue, error) {
+	var issues []Issue
+	for _, issue := range m.issues {
+		issues = append(issues, *issue)
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Key < issues[j].Key })
+	return issues, nil
+}
+
+func (m *memTracker) Create(ctx context.Context, spec IssueSpec) (Issue, error) {
+	if spec.Plugin.PluginID == m.fail {
+		return Issue{}, errors.New("HTTP 400: bad request")
+	}
+	m.next++
+	issue := Issue{Key: "ISSUE-" + strconv.Itoa(m.next), Title: spec.Title(), Body: spec.Body(false)}
+	parseIssueMarker(&issue)
+	m.issues[issue.Key] = &issue
+	m.actions = append(m.actions, "open "+spec.Plugin.PluginID+" "+spec.Plugin.LatestVersion)
+	return issue, nil
+}
+
+func (m *memTracker) Update(ctx context.Context, issue Issue, spec IssueSpec) error {
+	m.issues[issue.Key].Title, m.issues[issue.Key].Body = spec.Title(), spec.Body(false)
+	m.actions = append(m.actions, "update "+issue.PluginID)
+	return nil
+}
+
+func (m *memTracker) Close(ctx context.Context, issue Issue, comment string) error {
+	delete(m.issues, issue.Key)
+	m.closed[issue.Key] = comment
+	m.actions = append(m.actions, "close "+issue.PluginID+" "+issue.Target)
+	return nil
+}
+
+// trackerTestResult is the sample result with plugins as its installed and
+// reported plugins.
+func trackerTestResult(plugins ...PluginReport) *AuditResult {
+	result := sampleResultWithServer()
+	result.Plugins, result.Installed = plugins, plugins
+	return result
+}
+
+func outdatedPlugin(id, installed, latest string) PluginReport {
+	return PluginReport{PluginID: id, Name: id, InstalledVersion: installed, LatestVersion: latest, UpdateState: UpdateStateOutdated, Status: "enabled", Source: SourceMarketplace}
+}
+
+func upToDatePlugin(id, version string) PluginReport {
+	return PluginReport{PluginID: id, Name: id, InstalledVersion: version, LatestVersion: version, UpdateState: UpdateStateUpToDate, Status: "enabled", Source: SourceMarketplace}
+}
+
+func TestTrackerSync(t *testing.T) {
+	jiraOld := outdatedPlugin("jira", "4.0.0", "4.1.0")
+	filtered := trackerTestResult(jiraOld, outdatedPlugin("zoom", "1.0.0", "1.2.0"))
+	filtered.Plugins = filtered.Plugins[1:] // Filters don't shrink the inventory
+	tests := []struct {
+		name  string
+		next  *AuditResult
+		want  []string // Actions on the second run
+		open  int      // Issues left open
+		close string   // Expected in the closing comment
+	}{
+		{
+			name: "unchanged",
+			next: trackerTestResult(jiraOld, outdatedPlugin("zoom", "1.0.0", "1.2.0"), upToDatePlugin("calls", "1.0.0")),
+			open: 2,
+		},
+		{
+			name: "installed version changed",
+			next: trackerTestResult(outdatedPlugin("jira", "4.0.5", "4.1.0"), outdatedPlugin("zoom", "1.0.0", "1.2.0")),
+			want: []string{"update jira"},
+			open: 2,
+		},
+		{
+			name:  "upgraded",
+			next:  trackerTestResult(upToDatePlugin("jira", "4.1.0"), outdatedPlugin("zoom", "1.0.0", "1.2.0")),
+			want:  []string{"close jira 4.1.0"},
+			open:  1,
+			close: "jira is now at version 4.1.0.",
+		},
+		{
+			name:  "newer release",
+			next:  trackerTestResult(outdatedPlugin("jira", "4.0.0", "5.0.0"), outdatedPlugin("zoom", "1.0.0", "1.2.0")),
+			want:  []string{"open jira 5.0.0", "close jira 4.1.0"},
+			open:  2,
+			close: "Superseded by the newer release 5.0.0, which has its own issue.",
+		},
+		{
+			name:  "uninstalled",
+			next:  trackerTestResult(outdatedPlugin("zoom", "1.0.0", "1.2.0")),
+			want:  []string{"close jira 4.1.0"},
+			open:  1,
+			close: "jira is no longer installed",
+		},
+		{
+			name: "filtered out but still outdated",
+			next: filtered,
+			open: 2,
+		},
+		{
+			name: "another server",
+			next: &AuditResult{Server: &ServerInfo{URL: "https://other.example.com"}},
+			open: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newMemTracker()
+			sync := &TrackerSync{Tracker: tracker, Logf: noopLogger}
+			first := trackerTestResult(jiraOld, outdatedPlugin("zoom", "1.0.0", "1.2.0"), upToDatePlugin("calls", "1.0.0"))
+			if err := sync.Run(context.Background(), first); err != nil {
+				t.Fatalf("first Run() returned error: %v", err)
+			}
+			if got := strings.Join(tracker.actions, ","); got != "open jira 4.1.0,open zoom 1.2.0" {
+				t.Fatalf("first run actions = %s", got)
+			}
+
+			tracker.actions = nil
+			if err := sync.Run(context.Background(), tt.next); err != nil {
+				t.Fatalf("second Run() returned error: %v", err)
+			}
+			sort.Strings(tracker.actions)
+			sort.Strings(tt.want)
+			if strings.Join(tracker.actions, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("actions = %v, want %v", tracker.actions, tt.want)
+			}
+			if len(tracker.issues) != tt.open {
+				t.Errorf("%d issue(s) open, want %d", len(tracker.issues), tt.open)
+			}
+			if tt.close != "" && (len(tracker.closed) != 1 || !strings.Contains(tracker.closed["ISSUE-1"], tt.close)) {
+				t.Errorf("closed = %v, want a comment containing %q", tracker.closed, tt.close)
+			}
+		})
+	}
+}
+
+func TestTrackerSync_Duplicates(t *testing.T) {
+	tracker := newMemTracker()
+	sync := &TrackerSync{Tracker: tracker, Logf: noopLogger}
+	if err := sync.Run(context.Background(), trackerTestResult(outdatedPlugin("jira", "4.0.0", "4.1.0"))); err != nil {
+		t.Fatalf("first Run() returned error: %v", err)
+	}
+	// A second issue for the same fingerprint, as a retried request might file
+	dup := *tracker.issues["ISSUE-1"]
+	dup.Key = "ISSUE-0"
+	tracker.issues[dup.Key] = &dup
+
+	tracker.actions = nil
+	if err := sync.Run(context.Background(), trackerTestResult(outdatedPlugin("jira", "4.0.0", "4.1.0"))); err != nil {
+		t.Fatalf("second Run() returned error: %v", err)
+	}
+	if len(tracker.actions) != 0 {
+		t.Errorf("a still-outdated plugin changed its issues: %v", tracker.actions)
+	}
+
+	if err := sync.Run(context.Background(), trackerTestResult(upToDatePlugin("jira", "4.1.0"))); err != nil {
+		t.Fatalf("third Run() returned error: %v", err)
+	}
+	if len(tracker.issues) != 0 || tracker.closed["ISSUE-0"] != "jira is now at version 4.1.0." || tracker.closed["ISSUE-1"] != tracker.closed["ISSUE-0"] {
+		t.Errorf("expected both issues closed as updated, open %v, closed %v", tracker.issues, tracker.closed)
+	}
+}
+
+func TestTrackerSync_ServerName(t *testing.T) {
+	tracker := newMemTracker()
+	unnamed := trackerTestResult(outdatedPlugin("jira", "4.0.0", "4.1.0"))
+	unnamed.Server.URL = "" // A local-mode audit of a server without a Site URL
+
+	err := (&TrackerSync{Tracker: tracker, Logf: noopLogger}).Run(context.Background(), unnamed)
+	if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitConfigError || !strings.Contains(cliErr.Message, "--tracker-server-name") {
+		t.Fatalf("expected a config error asking for a server name, got %v", err)
+	}
+	if len(tracker.actions) != 0 {
+		t.Errorf("an unnamed server changed the tracker: %v", tracker.actions)
+	}
+
+	// Named servers keep to their own issues
+	if err := (&TrackerSync{Tracker: tracker, ServerName: "Chat-1", Logf: noopLogger}).Run(context.Background(), unnamed); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if issue := tracker.issues["ISSUE-1"]; issue == nil || issue.Server != "chat-1" {
+		t.Fatalf("expected an issue for chat-1, got %+v", tracker.issues)
+	}
+	other := trackerTestResult()
+	other.Server.URL = ""
+	if err := (&TrackerSync{Tracker: tracker, ServerName: "chat-2", Logf: noopLogger}).Run(context.Background(), other); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if len(tracker.closed) != 0 {
+		t.Errorf("another server closed chat-1's issues: %v", tracker.closed)
+	}
+}
+
+func TestTrackerSync_DryRunAndFailures(t *testing.T) {
+	tracker := newMemTracker()
+	result := trackerTestResult(outdatedPlugin("jira", "4.0.0", "4.1.0"), outdatedPlugin("zoom", "1.0.0", "1.2.0"))
+
+	var logged []string
+	dry := &TrackerSync{Tracker: tracker, DryRun: true, Logf: func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}}
+	if err := dry.Run(context.Background(), result); err != nil {
+		t.Fatalf("dry Run() returned error: %v", err)
+	}
+	if len(tracker.actions) != 0 || !strings.Contains(strings.Join(logged, "\n"), "[dry run] Opening issue") {
+		t.Errorf("dry run changed the tracker (%v) or didn't log its plan (%v)", tracker.actions, logged)
+	}
+
+	// One failure doesn't stop the other issues, and fails with exit code 5
+	tracker.fail = "jira"
+	err := (&TrackerSync{Tracker: tracker, Logf: noopLogger}).Run(context.Background(), result)
+	cliErr, ok := err.(*CLIError)
+	if !ok || cliErr.Code != ExitNotifyError || !strings.Contains(cliErr.Message, "opening issue for jira: HTTP 400") {
+		t.Errorf("expected a notify error naming the failure, got %v", err)
+	}
+	if strings.Join(tracker.actions, ",") != "open zoom 1.2.0" {
+		t.Errorf("actions = %v", tracker.actions)
+	}
+}
+
+func TestIssueSpec_Marker(t *testing.T) {
+	p := outdatedPlugin("com.mattermost.confluence", "1.3.0", "1.4.0")
+	p.Name, p.UpdateSeverity = "Confluence", SeverityMinor
+	spec := newIssueSpec(trackerTestResult(p), "", p)
+
+	if spec.Fingerprint != issueFingerprint("MATTERMOST.example.com", "com.mattermost.Confluence", "1.4.0") {
+		t.Error("fingerprint is not case-insensitive in the server and plugin ID")
+	}
+	if spec.Fingerprint == issueFingerprint("mattermost.example.com", "com.mattermost.confluence", "1.5.0") {
+		t.Error("fingerprint does not depend on the target version")
+	}
+	if got := spec.Title(); got != "Update Confluence plugin to 1.4.0 on mattermost.example.com" {
+		t.Errorf("Title() = %q", got)
+	}
+
+	for _, wiki := range []bool{false, true} {
+		body := spec.Body(wiki)
+		issue := Issue{Body: body}
+		parseIssueMarker(&issue)
+		if issue.Fingerprint != spec.Fingerprint || issue.Server != "mattermost.example.com" || issue.PluginID != p.PluginID || issue.Target != "1.4.0" {
+			t.Errorf("marker did not round-trip (wiki %v): %+v\n%s", wiki, issue, body)
+		}
+		bullet := "- Latest version: 1.4.0 (minor update)"
+		if wiki {
+			bullet = "* Latest version: 1.4.0 (minor update)"
+		}
+		if !strings.Contains(body, bullet) {
+			t.Errorf("body (wiki %v) missing %q:\n%s", wiki, bullet, body)
+		}
+	}
+}
+
+func TestTrackerConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     TrackerConfig
+		wantErr string
+	}{
+		{"jira", TrackerConfig{Kind: "Jira", URL: "https://example.atlassian.net", Project: "OPS", Token: "t"}, ""},
+		{"jira without project", TrackerConfig{Kind: "jira", URL: "https://example.atlassian.net", Token: "t"}, "--tracker-project"},
+		{"jira without token", TrackerConfig{Kind: "jira", URL: "https://example.atlassian.net", Project: "OPS"}, "MM_TRACKER_TOKEN"},
+		{"github", TrackerConfig{Kind: "github", Project: "acme/ops", Token: "t"}, ""},
+		{"github bad repo", TrackerConfig{Kind: "github", Project: "acme", Token: "t"}, "owner/name"},
+		{"github with jira flags", TrackerConfig{Kind: "github", Project: "acme/ops", Token: "t", IssueType: "Bug"}, "only apply to --tracker jira"},
+		{"rest without token", TrackerConfig{Kind: "rest", URL: "http://localhost:8080"}, ""},
+		{"rest without url", TrackerConfig{Kind: "rest"}, "--tracker-url"},
+		{"bad url", TrackerConfig{Kind: "rest", URL: "tickets.example.com"}, "invalid --tracker-url"},
+		{"bad label", TrackerConfig{Kind: "rest", URL: "http://localhost", Label: "plugin audit"}, "invalid --tracker-label"},
+		{"bad server name", TrackerConfig{Kind: "rest", URL: "http://localhost", ServerName: "chat 1"}, "invalid --tracker-server-name"},
+		{"unknown", TrackerConfig{Kind: "trello"}, `invalid --tracker "trello"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() returned error: %v", err)
+				}
+				if tt.cfg.Label != DefaultTrackerLabel {
+					t.Errorf("Label = %q, want the default", tt.cfg.Label)
+				}
+				return
+			}
+			cliErr, ok := err.(*CLIError)
+			if !ok || cliErr.Code != ExitConfigError || !strings.Contains(cliErr.Message, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want a config error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// restIssueServer implements the generic issue API in memory.
+type restIssueServer struct {
+	mu     sync.Mutex
+	issues map[string]map[string]interface{}
+	closed map[string]string
+	auth   []string
+	next   int
+}
+
+func (s *restIssueServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	path := strings.TrimPrefix(r.URL.Path, "/api/issues")
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		if r.URL.Query().Get("label") != "mm-plugin-audit" || r.URL.Query().Get("state") != "open" {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		list := []map[string]interface{}{}
+		for _, issue := range s.issues {
+			list = append(list, issue)
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPost && path == "":
+		var issue map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&issue)
+		s.next++
+		issue["id"] = s.next // Numeric, as many APIs send
+		s.issues[strconv.Itoa(s.next)] = issue
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": s.next, "url": "https://tickets.example.com/" + strconv.Itoa(s.next)})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/close"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/close")
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		s.closed[id] = body["comment"]
+		delete(s.issues, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestRESTTracker(t *testing.T) {
+	api := &restIssueServer{issues: make(map[string]map[string]interface{}), closed: make(map[string]string)}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	sync := &TrackerSync{
+		Tracker: NewIssueTracker(TrackerConfig{Kind: TrackerREST, URL: srv.URL + "/api/", Token: "s3cr3t", Label: DefaultTrackerLabel}, testHTTPClient(t, 0)),
+		Logf:    noopLogger,
+	}
+
+	if err := sync.Run(context.Background(), trackerTestResult(outdatedPlugin("jira", "4.0.0", "4.1.0"))); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if len(api.issues) != 1 {
+		t.Fatalf("expected 1 issue, got %v", api.issues)
+	}
+	issue := api.issues["1"]
+	if issue["plugin_id"] != "jira" || issue["target_version"] != "4.1.0" || issue["server"] != "mattermost.example.com" ||
+		issue["fingerprint"] != issueFingerprint("mattermost.example.com", "jira", "4.1.0") {
+		t.Errorf("unexpected issue payload: %v", issue)
+	}
+
+	// The same audit again changes nothing; an upgrade closes the issue
+	if err := sync.Run(context.Background(), trackerTestResult(outdatedPlugin("jira", "4.0.0", "4.1.0"))); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if api.next != 1 {
+		t.Errorf("rerun opened a duplicate issue")
+	}
+	if err := sync.Run(context.Background(), trackerTestResult(upToDatePlugin("jira", "4.1.0"))); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if len(api.issues) != 0 || api.closed["1"] != "jira is now at version 4.1.0." {
+		t.Errorf("issue not closed: open %v, closed %v", api.issues, api.closed)
+	}
+	for _, auth := range api.auth {
+		if auth != "Bearer s3cr3t" {
+			t.Errorf("Authorization = %q", auth)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Default network settings, overridable via flags.
+const (
+	DefaultRequestTimeout = 30 * time.Second
+	DefaultRetries        = 3
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 10 * time.Second
+)
+
+// afterFunc times the pause between retry attempts. Exposed for testing.
+var afterFunc = time.After
+
+// HTTPConfig controls timeouts, retries and proxying for outbound API calls.
+type HTTPConfig struct {
+	RequestTimeout time.Duration // Per-attempt timeout; 0 disables it
+	Retries        int           // Additional attempts after the first for retryable failures
+	ProxyURL       string        // Explicit HTTP(S) proxy; empty uses HTTPS_PROXY/HTTP_PROXY/NO_PROXY
+	SocketPath     string        // Dial this Unix socket for every request instead of the network; no proxy is used
+}
+
+// newHTTPClient builds an *http.Client honouring the given configuration.
+func newHTTPClient(cfg HTTPConfig, logf func(string, ...interface{})) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		proxyURL, err := parseProxyURL(cfg.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = proxy
+	if cfg.SocketPath != "" {
+		var dialer net.Dialer
+		base.Proxy = nil
+		base.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", cfg.SocketPath)
+		}
+	}
+
+	return &http.Client{
+		Transport: &retryTransport{
+			base:      base,
+			retries:   cfg.Retries,
+			timeout:   cfg.RequestTimeout,
+			baseDelay: defaultRetryBaseDelay,
+			maxDelay:  defaultRetryMaxDelay,
+			logf:      logf,
+		},
+	}, nil
+}
+
+// parseProxyURL validates a proxy URL supplied on the command line.
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, configError(fmt.Sprintf("error: invalid proxy URL %q.", raw), err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, configError(fmt.Sprintf("error: unsupported proxy scheme %q. Use http, https, or socks5.", u.Scheme), nil)
+	}
+	return u, nil
+}
+
+// retryTransport wraps an http.RoundTripper with a per-attempt timeout and
+// exponential backoff retries for rate limiting, 5xx responses and dropped
+// connections. Only idempotent requests are retried; as in net/http, a caller
+// opts other requests in with an Idempotency-Key or X-Idempotency-Key header,
+// which is not sent if its value is nil.
+type retryTransport struct {
+	base      http.RoundTripper
+	retries   int
+	timeout   time.Duration
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	logf      func(string, ...interface{})
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.roundTripOnce(req)
+
+		if attempt >= t.retries || !t.canRetry(req) || !isRetryable(resp, err) {
+			return resp, err
+		}
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+
+		// Only the origin is logged, since webhook paths and queries often hold secrets
+		delay := t.backoff(attempt, resp)
+		target := req.Method + " " + req.URL.Scheme + "://" + req.URL.Host
+		if err != nil {
+			t.logf("%s failed (%v); retrying in %s (attempt %d of %d)", target, err, delay, attempt+2, t.retries+1)
+		} else {
+			t.logf("%s returned HTTP %d; retrying in %s (attempt %d of %d)", target, resp.StatusCode, delay, attempt+2, t.retries+1)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-afterFunc(delay):
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// roundTripOnce performs a single attempt, bounding it by the per-attempt
+// timeout. The timeout stays armed until the response body is closed.
+func (t *retryTransport) roundTripOnce(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// canRetry reports whether the request is idempotent and its body can be
+// sent again.
+func (t *retryTransport) canRetry(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, key := req.Header["Idempotency-Key"]
+	_, xKey := req.Header["X-Idempotency-Key"]
+	return key || xKey
+}
+
+// backoff returns the delay before the next attempt, honouring Retry-After on 429/503.
+func (t *retryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			delay := time.Duration(secs) * time.Second
+			if delay > t.maxDelay {
+				return t.maxDelay
+			}
+			return delay
+		}
+	}
+
+	delay := time.Duration(float64(t.baseDelay) * math.Pow(2, float64(attempt)))
+	if delay > t.maxDelay {
+		return t.maxDelay
+	}
+	return delay
+}
+
+// isRetryable reports whether a response or transport error is worth retrying.
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return true
+		}
+		return errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, io.ErrUnexpectedEOF) ||
+			errors.Is(err, io.EOF)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// cancelOnClose releases a per-attempt context once the body has been consumed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
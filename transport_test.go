@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// noSleep disables retry backoff for the duration of a test.
+func noSleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var delays []time.Duration
+	orig := afterFunc
+	afterFunc = func(d time.Duration) <-chan time.Time {
+		delays = append(delays, d)
+		return time.After(0)
+	}
+	t.Cleanup(func() { afterFunc = orig })
+	return &delays
+}
+
+func TestRetryTransport_RetriesTransientErrors(t *testing.T) {
+	delays := noSleep(t)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	var logs []string
+	client, err := newHTTPClient(HTTPConfig{Retries: 3}, func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})
+	if err != nil {
+		t.Fatalf("newHTTPClient() returned error: %v", err)
+	}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 after retries, got %d", resp.StatusCode)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+	if len(*delays) != 2 || (*delays)[0] != 500*time.Millisecond || (*delays)[1] != time.Second {
+		t.Errorf("expected exponential backoff of [500ms 1s], got %v", *delays)
+	}
+	if len(logs) != 2 || !strings.Contains(logs[0], "HTTP 502") {
+		t.Errorf("expected retry attempts to be logged, got %v", logs)
+	}
+}
+
+func TestRetryTransport_GivesUpAfterRetries(t *testing.T) {
+	noSleep(t)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client, _ := newHTTPClient(HTTPConfig{Retries: 2}, noopLogger)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected final status 503, got %d", resp.StatusCode)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts (1 + 2 retries), got %d", calls)
+	}
+}
+
+func TestRetryTransport_NoRetryOnClientError(t *testing.T) {
+	noSleep(t)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	client, _ := newHTTPClient(HTTPConfig{Retries: 3}, noopLogger)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if calls != 1 {
+		t.Errorf("expected 1 attempt for 401, got %d", calls)
+	}
+}
+
+func TestRetryTransport_HonoursRetryAfter(t *testing.T) {
+	delays := noSleep(t)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client, _ := newHTTPClient(HTTPConfig{Retries: 1}, noopLogger)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(*delays) != 1 || (*delays)[0] != 2*time.Second {
+		t.Errorf("expected a single 2s delay from Retry-After, got %v", *delays)
+	}
+}
+
+func TestRetryTransport_ReplaysRequestBody(t *testing.T) {
+	noSleep(t)
+
+	var calls int32
+	var lastBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		lastBody = string(b)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client, _ := newHTTPClient(HTTPConfig{Retries: 1}, noopLogger)
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader(`{"login_id":"admin"}`))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if calls != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls)
+	}
+	if lastBody != `{"login_id":"admin"}` {
+		t.Errorf("expected body to be replayed on retry, got %q", lastBody)
+	}
+}
+
+func TestRetryTransport_NonIdempotentRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    http.Header
+		wantCalls int32
+		wantSent  string // Idempotency header seen by the server
+	}{
+		{"plain POST", http.Header{}, 1, ""},
+		{"unsent opt-in", http.Header{"Idempotency-Key": nil}, 2, ""},
+		{"idempotency key", http.Header{"X-Idempotency-Key": {"d41d8cd9"}}, 2, "d41d8cd9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			noSleep(t)
+			var calls int32
+			var sent string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent = r.Header.Get("Idempotency-Key") + r.Header.Get("X-Idempotency-Key")
+				if atomic.AddInt32(&calls, 1) == 1 {
+					w.WriteHeader(http.StatusBadGateway)
+				}
+			}))
+			defer srv.Close()
+
+			client, _ := newHTTPClient(HTTPConfig{Retries: 3}, noopLogger)
+			req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{}`))
+			req.Header = tt.header
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() returned error: %v", err)
+			}
+			resp.Body.Close()
+
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d attempt(s), got %d", tt.wantCalls, calls)
+			}
+			if sent != tt.wantSent {
+				t.Errorf("idempotency header = %q, want %q", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestRetryTransport_LogsHideSecrets(t *testing.T) {
+	noSleep(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	dropped := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer dropped.Close()
+
+	for _, base := range []string{srv.URL, dropped.URL} {
+		var logs []string
+		client, err := newHTTPClient(HTTPConfig{Retries: 1}, func(format string, args ...interface{}) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		})
+		if err != nil {
+			t.Fatalf("newHTTPClient() returned error: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, base+"/hooks/s3cr3t?token=t0k3n", nil)
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+		if len(logs) != 1 || !strings.Contains(logs[0], "GET "+base) {
+			t.Errorf("expected the retry logged with the method and origin, got %v", logs)
+		}
+		for _, line := range logs {
+			if strings.Contains(line, "s3cr3t") || strings.Contains(line, "t0k3n") {
+				t.Errorf("log line exposes the URL's path or query: %s", line)
+			}
+		}
+	}
+}
+
+func TestRetryTransport_CancelledDuringBackoff(t *testing.T) {
+	// Cancel once the backoff starts, with a timer that never fires
+	ctx, cancel := context.WithCancel(context.Background())
+	orig := afterFunc
+	afterFunc = func(time.Duration) <-chan time.Time {
+		cancel()
+		return nil
+	}
+	t.Cleanup(func() { afterFunc = orig })
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client, _ := newHTTPClient(HTTPConfig{Retries: 3}, noopLogger)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	done := make(chan error, 1)
+	go func() {
+		resp, err := client.Do(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancellation did not interrupt the retry backoff")
+	}
+}
+
+func TestRetryTransport_RequestTimeout(t *testing.T) {
+	noSleep(t)
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client, _ := newHTTPClient(HTTPConfig{RequestTimeout: 50 * time.Millisecond, Retries: 1}, noopLogger)
+	_, err := client.Get(srv.URL)
+	if err == nil {
+		t.Fatal("expected timeout error from hung server")
+	}
+}
+
+func TestNewHTTPClient_Proxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxy   string
+		wantErr bool
+	}{
+		{"http proxy", "http://proxy.example.com:3128", false},
+		{"https proxy", "https://proxy.example.com", false},
+		{"missing host", "http://", true},
+		{"unsupported scheme", "ftp://proxy.example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newHTTPClient(HTTPConfig{ProxyURL: tt.proxy}, noopLogger)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error for invalid proxy")
+				}
+				if cliErr, ok := err.(*CLIError); !ok || cliErr.Code != ExitConfigError {
+					t.Errorf("expected config error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newHTTPClient() returned error: %v", err)
+			}
+
+			base := client.Transport.(*retryTransport).base.(*http.Transport)
+			req := &http.Request{URL: &url.URL{Scheme: "https", Host: "mm.example.com"}}
+			got, err := base.Proxy(req)
+			if err != nil {
+				t.Fatalf("Proxy() returned error: %v", err)
+			}
+			if got == nil || got.String() != tt.proxy {
+				t.Errorf("expected proxy %s, got %v", tt.proxy, got)
+			}
+		})
+	}
+}
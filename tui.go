@@ -0,0 +1,526 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// The interactive browser is split in two: tuiModel holds the view state and
+// renders it to lines of text, and runInteractive (tui_term.go) owns the
+// terminal. Keeping terminal I/O out of the model lets it be tested directly.
+
+// tuiColumn is a column in the interactive plugin list.
+type tuiColumn struct {
+	title string
+	field string // Report field used for sorting
+	width int    // Minimum width; the name column takes the remaining space
+	cell  func(p PluginReport) string
+}
+
+var tuiColumns = []tuiColumn{
+	{"NAME", "name", 12, func(p PluginReport) string { return p.Name }},
+	{"INSTALLED", "installed_version", 10, func(p PluginReport) string { return p.InstalledVersion }},
+	{"LATEST", "latest_version", 10, func(p PluginReport) string { return p.LatestVersion }},
+	{"UPDATE", "update_state", 24, updateIndicator},
+	{"STATUS", "status", 9, func(p PluginReport) string { return capitalizeStatus(p.Status) }},
+	{"SOURCE", "source", 17, func(p PluginReport) string { return p.Source }},
+}
+
+// Key names produced by readKey for non-printable keys.
+const (
+	keyUp        = "up"
+	keyDown      = "down"
+	keyPageUp    = "pgup"
+	keyPageDown  = "pgdn"
+	keyHome      = "home"
+	keyEnd       = "end"
+	keyEnter     = "enter"
+	keyEscape    = "esc"
+	keyBackspace = "backspace"
+	keyCtrlC     = "ctrl-c"
+)
+
+// tuiMode is what keystrokes are currently interpreted as.
+type tuiMode int
+
+const (
+	modeBrowse tuiMode = iota
+	modeSearch
+	modeExport
+	modeHelp
+)
+
+// tuiModel is the state of the interactive browser.
+type tuiModel struct {
+	result *AuditResult
+	view   []PluginReport // Plugins after filtering and sorting
+
+	cursor int // Index into view
+	offset int // First visible row of the list
+
+	sortCol  int // Index into tuiColumns, or -1 for the audit order
+	sortDesc bool
+
+	search        string
+	hiddenSources map[string]bool
+	status        string // "", "enabled" or "disabled"
+	outdatedOnly  bool
+
+	detail  bool
+	mode    tuiMode
+	input   string // Text being typed at the export prompt
+	message string // One-off status message
+
+	// export writes the current view to a file; set by runInteractive.
+	export func(path string, result *AuditResult) error
+}
+
+func newTUIModel(result *AuditResult) *tuiModel {
+	m := &tuiModel{result: result, sortCol: -1, hiddenSources: map[string]bool{}, detail: true}
+	m.refresh()
+	return m
+}
+
+// refresh rebuilds the view from the filters and sort order, keeping the
+// cursor on the same plugin where possible.
+func (m *tuiModel) refresh() {
+	var selected string
+	if p, ok := m.current(); ok {
+		selected = p.PluginID
+	}
+
+	m.view = m.view[:0]
+	search := strings.ToLower(m.search)
+	for _, p := range m.result.Plugins {
+		if m.hiddenSources[p.Source] {
+			continue
+		}
+		if m.status != "" && p.Status != m.status {
+			continue
+		}
+		if m.outdatedOnly && p.UpdateState != UpdateStateOutdated {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(p.Name), search) && !strings.Contains(strings.ToLower(p.PluginID), search) {
+			continue
+		}
+		m.view = append(m.view, p)
+	}
+
+	if m.sortCol >= 0 {
+		field, _ := lookupReportField(tuiColumns[m.sortCol].field)
+		sortReports(m.view, []SortKey{{Field: field, Descending: m.sortDesc}})
+	}
+
+	m.cursor = 0
+	for i, p := range m.view {
+		if p.PluginID == selected {
+			m.cursor = i
+			break
+		}
+	}
+}
+
+func (m *tuiModel) current() (PluginReport, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.view) {
+		return PluginReport{}, false
+	}
+	return m.view[m.cursor], true
+}
+
+// viewResult returns the current view as an audit result, for export.
+func (m *tuiModel) viewResult() *AuditResult {
+	plugins := append([]PluginReport(nil), m.view...)
+	return &AuditResult{Plugins: plugins, Summary: computeSummary(plugins), Server: m.result.Server}
+}
+
+// handleKey applies a keystroke, returning true when the browser should exit.
+// pageSize is the number of visible list rows.
+func (m *tuiModel) handleKey(key string, pageSize int) bool {
+	m.message = ""
+	if key == keyCtrlC {
+		return true
+	}
+
+	switch m.mode {
+	case modeHelp:
+		m.mode = modeBrowse
+		return false
+	case modeSearch:
+		switch key {
+		case keyEnter:
+			m.mode = modeBrowse
+		case keyEscape:
+			m.search = ""
+			m.mode = modeBrowse
+		case keyBackspace:
+			if m.search != "" {
+				_, size := utf8.DecodeLastRuneInString(m.search)
+				m.search = m.search[:len(m.search)-size]
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				m.search += key
+			}
+		}
+		m.refresh()
+		return false
+	case modeExport:
+		switch key {
+		case keyEnter:
+			m.mode = modeBrowse
+			m.exportView(strings.TrimSpace(m.input))
+		case keyEscape:
+			m.mode = modeBrowse
+		case keyBackspace:
+			if m.input != "" {
+				_, size := utf8.DecodeLastRuneInString(m.input)
+				m.input = m.input[:len(m.input)-size]
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				m.input += key
+			}
+		}
+		return false
+	}
+
+	switch key {
+	case "q":
+		return true
+	case keyUp, "k":
+		m.move(-1)
+	case keyDown, "j":
+		m.move(1)
+	case keyPageUp:
+		m.move(-max(1, pageSize))
+	case keyPageDown:
+		m.move(max(1, pageSize))
+	case keyHome, "g":
+		m.cursor = 0
+	case keyEnd, "G":
+		m.cursor = len(m.view) - 1
+	case keyEnter, "d":
+		m.detail = !m.detail
+	case "/":
+		m.mode = modeSearch
+	case keyEscape:
+		m.search = ""
+		m.refresh()
+	case "1", "2", "3", "4", "5", "6":
+		col := int(key[0] - '1')
+		if m.sortCol == col {
+			m.sortDesc = !m.sortDesc
+		} else {
+			m.sortCol, m.sortDesc = col, false
+		}
+		m.refresh()
+	case "0":
+		m.sortCol, m.sortDesc = -1, false
+		m.refresh()
+	case "m":
+		m.toggleSource(SourceMarketplace)
+	case "o":
+		m.toggleSource(SourceMattermost)
+	case "b":
+		m.toggleSource(SourceBundled)
+	case "t":
+		m.toggleSource(SourceThirdParty)
+	case "e":
+		switch m.status {
+		case "":
+			m.status = "enabled"
+		case "enabled":
+			m.status = "disabled"
+		default:
+			m.status = ""
+		}
+		m.refresh()
+	case "u":
+		m.outdatedOnly = !m.outdatedOnly
+		m.refresh()
+	case "x":
+		m.mode = modeExport
+		m.input = ""
+	case "?":
+		m.mode = modeHelp
+	}
+	m.clampCursor()
+	return false
+}
+
+func (m *tuiModel) move(delta int) {
+	m.cursor += delta
+	m.clampCursor()
+}
+
+func (m *tuiModel) clampCursor() {
+	if m.cursor >= len(m.view) {
+		m.cursor = len(m.view) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+func (m *tuiModel) toggleSource(source string) {
+	m.hiddenSources[source] = !m.hiddenSources[source]
+	m.refresh()
+}
+
+// exportFormat picks an output format from a file extension.
+func exportFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	case ".xlsx":
+		return "xlsx"
+	}
+	return "table"
+}
+
+func (m *tuiModel) exportView(path string) {
+	if path == "" {
+		m.message = "Export cancelled"
+		return
+	}
+	if m.export == nil {
+		m.message = "Export is not available"
+		return
+	}
+	if err := m.export(path, m.viewResult()); err != nil {
+		m.message = fmt.Sprintf("Export failed: %v", err)
+		return
+	}
+	m.message = fmt.Sprintf("Exported %d plugin(s) to %s (%s)", len(m.view), path, exportFormat(path))
+}
+
+// detailHeight is the number of lines used by the detail pane.
+const detailHeight = 8
+
+// listHeight returns the number of plugin rows that fit on screen.
+func (m *tuiModel) listHeight(height int) int {
+	rows := height - 3 // Title, column header and status line
+	if m.detail {
+		rows -= detailHeight
+	}
+	return max(1, rows)
+}
+
+// render draws the screen as lines of at most width characters (excluding
+// colour escapes).
+func (m *tuiModel) render(width, height int) []string {
+	if m.mode == modeHelp {
+		return m.renderHelp(width, height)
+	}
+
+	rows := m.listHeight(height)
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+	if m.offset > 0 && m.offset+rows > len(m.view) {
+		m.offset = max(0, len(m.view)-rows)
+	}
+
+	widths := m.columnWidths(width)
+	lines := []string{colorize("bold", fitWidth(m.title(), width))}
+
+	header := make([]string, len(tuiColumns))
+	for i, col := range tuiColumns {
+		title := col.title
+		if i == m.sortCol {
+			if m.sortDesc {
+				title += " ▼"
+			} else {
+				title += " ▲"
+			}
+		}
+		header[i] = title
+	}
+	lines = append(lines, colorize("bold", layoutRow(header, widths, width)))
+
+	for i := m.offset; i < m.offset+rows; i++ {
+		if i >= len(m.view) {
+			lines = append(lines, "")
+			continue
+		}
+		p := m.view[i]
+		cells := make([]string, len(tuiColumns))
+		for j, col := range tuiColumns {
+			cells[j] = col.cell(p)
+		}
+		row := layoutRow(cells, widths, width)
+		if i == m.cursor {
+			row = "\x1b[7m" + padTo(row, width) + "\x1b[0m"
+		} else {
+			row = colorize(rowColor(p), row)
+		}
+		lines = append(lines, row)
+	}
+	if len(m.view) == 0 && rows > 0 {
+		lines[2] = fitWidth("  No plugins match the current filters.", width)
+	}
+
+	if m.detail {
+		lines = append(lines, m.renderDetail(width)...)
+	}
+	lines = append(lines, m.statusLine(width))
+	return lines
+}
+
+func (m *tuiModel) title() string {
+	title := fmt.Sprintf("mm-plugin-audit — %d of %d plugin(s)", len(m.view), len(m.result.Plugins))
+	if m.result.Server != nil && m.result.Server.URL != "" {
+		title += " on " + m.result.Server.URL
+	}
+
+	var filters []string
+	for _, s := range filterSources {
+		if m.hiddenSources[s] {
+			filters = append(filters, "-"+s)
+		}
+	}
+	if m.status != "" {
+		filters = append(filters, m.status)
+	}
+	if m.outdatedOnly {
+		filters = append(filters, "outdated")
+	}
+	if m.search != "" {
+		filters = append(filters, fmt.Sprintf("/%s", m.search))
+	}
+	if len(filters) > 0 {
+		title += "  [" + strings.Join(filters, " ") + "]"
+	}
+	return title
+}
+
+func (m *tuiModel) renderDetail(width int) []string {
+	lines := []string{strings.Repeat("─", max(0, width))}
+	p, ok := m.current()
+	if !ok {
+		for len(lines) < detailHeight {
+			lines = append(lines, "")
+		}
+		return lines
+	}
+
+	field := func(label, value string) string {
+		if value == "" {
+			value = "-"
+		}
+		return fitWidth(fmt.Sprintf("  %-15s %s", label, value), width)
+	}
+	versions := p.InstalledVersion
+	if p.LatestVersion != "" {
+		versions += " → " + p.LatestVersion + " (" + updateIndicator(p) + ")"
+	}
+	lines = append(lines,
+		colorize("bold", fitWidth(fmt.Sprintf("  %s (%s)", p.Name, p.PluginID), width)),
+		field("Version:", versions),
+		field("Source:", fmt.Sprintf("%s, %s, %s", p.Source, capitalizeStatus(p.Status), p.PluginType)),
+		field("Marketplace:", p.MarketplaceURL),
+		field("Homepage:", p.HomepageURL),
+		field("Release notes:", p.ReleaseNotesURL),
+	)
+	for len(lines) < detailHeight {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+func (m *tuiModel) statusLine(width int) string {
+	switch m.mode {
+	case modeSearch:
+		return fitWidth("Search: "+m.search+"█  (Enter to keep, Esc to clear)", width)
+	case modeExport:
+		return fitWidth("Export view to file (.csv, .json, .ndjson, .xlsx, else table): "+m.input+"█", width)
+	}
+	if m.message != "" {
+		return fitWidth(m.message, width)
+	}
+	return colorize("gray", fitWidth("↑↓ move  / search  1-6 sort  m o b t e u filter  Enter details  x export  ? help  q quit", width))
+}
+
+var tuiHelp = []string{
+	"mm-plugin-audit — interactive keys",
+	"",
+	"  ↑ ↓ j k        Move the selection",
+	"  PgUp PgDn      Move a page",
+	"  Home End g G   Jump to the first or last plugin",
+	"  Enter d        Show or hide the detail pane",
+	"  /              Search names and IDs as you type (Esc clears)",
+	"  1-6            Sort by a column; again to reverse. 0 restores the audit order",
+	"  m o b t        Show or hide Marketplace, Mattermost, bundled, third-party plugins",
+	"  e              Cycle status filter: all, enabled, disabled",
+	"  u              Show only outdated plugins",
+	"  x              Export the current view (.csv, .json, .ndjson/.jsonl, .xlsx, or table for other names)",
+	"  q Ctrl-C       Quit",
+	"",
+	"Press any key to return.",
+}
+
+func (m *tuiModel) renderHelp(width, height int) []string {
+	var lines []string
+	for _, line := range tuiHelp {
+		lines = append(lines, fitWidth(line, width))
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return lines[:max(0, height)]
+}
+
+// columnWidths sizes the list columns for the screen width: every column gets
+// its minimum width, and the name column takes what is left.
+func (m *tuiModel) columnWidths(width int) []int {
+	widths := make([]int, len(tuiColumns))
+	fixed := 0
+	for i, col := range tuiColumns {
+		// Leave room for the sort indicator
+		widths[i] = max(col.width, utf8.RuneCountInString(col.title)+2)
+		if i > 0 {
+			fixed += widths[i] + 2
+		}
+	}
+	widths[0] = max(tuiColumns[0].width, width-fixed)
+	return widths
+}
+
+// layoutRow lays out cells in columns of the given widths, truncating as needed.
+func layoutRow(cells []string, widths []int, width int) string {
+	var b strings.Builder
+	for i, cell := range cells {
+		if i > 0 {
+			b.WriteString("  ")
+		}
+		cell = truncate(widths[i], cell)
+		if i < len(cells)-1 {
+			cell = padTo(cell, widths[i])
+		}
+		b.WriteString(cell)
+	}
+	return fitWidth(b.String(), width)
+}
+
+// fitWidth truncates s to width runes.
+func fitWidth(s string, width int) string {
+	return truncate(width, s)
+}
+
+// padTo pads s with spaces to width runes.
+func padTo(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
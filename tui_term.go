@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// tuiResizePoll is how often the terminal size is checked while idle.
+const tuiResizePoll = 250 * time.Millisecond
+
+// runInteractive shows result in a full-screen browser on the terminal until
+// the user quits or ctx is cancelled.
+func runInteractive(ctx context.Context, result *AuditResult) error {
+	inFd, outFd := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(inFd) || !term.IsTerminal(outFd) {
+		return configError("error: --interactive requires a terminal on stdin and stdout.", nil)
+	}
+
+	state, err := term.MakeRaw(inFd)
+	if err != nil {
+		return configError(fmt.Sprintf("error: unable to set up the terminal: %v", err), err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	out.WriteString("\x1b[?1049h\x1b[?25l") // Alternate screen, hide cursor
+	out.Flush()
+	defer func() {
+		out.WriteString("\x1b[?25h\x1b[?1049l") // Show cursor, restore screen
+		out.Flush()
+		term.Restore(inFd, state)
+	}()
+
+	model := newTUIModel(result)
+	model.export = exportResult
+
+	keys := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		r := bufio.NewReader(os.Stdin)
+		for {
+			key, err := readKey(r)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			keys <- key
+		}
+	}()
+
+	width, height := terminalSize(outFd)
+	draw := func() {
+		lines := model.render(width, height)
+		out.WriteString("\x1b[H")
+		for i, line := range lines {
+			if i > 0 {
+				out.WriteString("\r\n")
+			}
+			out.WriteString(line)
+			out.WriteString("\x1b[K") // Clear the rest of the line
+		}
+		out.WriteString("\x1b[J") // Clear below
+		out.Flush()
+	}
+	draw()
+
+	ticker := time.NewTicker(tuiResizePoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case <-ticker.C:
+			if w, h := terminalSize(outFd); w != width || h != height {
+				width, height = w, h
+				draw()
+			}
+		case key := <-keys:
+			if model.handleKey(key, model.listHeight(height)) {
+				return nil
+			}
+			draw()
+		}
+	}
+}
+
+func terminalSize(fd int) (int, int) {
+	width, height, err := term.GetSize(fd)
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// exportResult writes result to path in the format implied by its extension.
+func exportResult(path string, result *AuditResult) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if err := WriteOutput(f, result, OutputOptions{Format: exportFormat(path)}); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+// readKey reads one keystroke from a terminal in raw mode, translating the
+// common escape sequences into key names. Printable input is returned as is.
+func readKey(r *bufio.Reader) (string, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+
+	switch c {
+	case 3:
+		return keyCtrlC, nil
+	case '\r', '\n':
+		return keyEnter, nil
+	case 127, 8:
+		return keyBackspace, nil
+	case 27:
+		// A lone Esc has nothing buffered behind it
+		if r.Buffered() == 0 {
+			return keyEscape, nil
+		}
+		next, _ := r.ReadByte()
+		if next != '[' && next != 'O' {
+			return keyEscape, nil
+		}
+		var seq strings.Builder
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return keyEscape, nil
+			}
+			seq.WriteByte(b)
+			if (b >= 'A' && b <= 'Z') || b == '~' {
+				break
+			}
+		}
+		switch seq.String() {
+		case "A":
+			return keyUp, nil
+		case "B":
+			return keyDown, nil
+		case "H", "1~", "7~":
+			return keyHome, nil
+		case "F", "4~", "8~":
+			return keyEnd, nil
+		case "5~":
+			return keyPageUp, nil
+		case "6~":
+			return keyPageDown, nil
+		}
+		return "", nil // Unsupported sequence; ignored by the model
+	}
+	return string(c), nil
+}
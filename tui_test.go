@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+func tuiNames(m *tuiModel) string {
+	var names []string
+	for _, p := range m.view {
+		names = append(names, p.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func typeKeys(m *tuiModel, keys ...string) {
+	for _, k := range keys {
+		m.handleKey(k, 10)
+	}
+}
+
+func TestTUIModel_Filters(t *testing.T) {
+	m := newTUIModel(sampleResult())
+	if got := tuiNames(m); got != "Confluence,WelcomeBot,Google Calendar,Calls,Pexip" {
+		t.Fatalf("unexpected initial view: %s", got)
+	}
+
+	typeKeys(m, "m")
+	if got := tuiNames(m); got != "Google Calendar,Calls,Pexip" {
+		t.Errorf("expected Marketplace plugins hidden, got %s", got)
+	}
+	typeKeys(m, "m", "e", "e")
+	if got := tuiNames(m); got != "Pexip" {
+		t.Errorf("expected only disabled plugins, got %s", got)
+	}
+	typeKeys(m, "e")
+	if got := tuiNames(m); !strings.Contains(got, "Confluence") || !strings.Contains(got, "Pexip") {
+		t.Errorf("expected status filter cleared, got %s", got)
+	}
+
+	typeKeys(m, "/", "c", "a", "l")
+	if got := tuiNames(m); got != "Google Calendar,Calls" {
+		t.Errorf("expected incremental search on name, got %s", got)
+	}
+	typeKeys(m, keyBackspace, keyBackspace, keyBackspace, "p", "e", "x", "i", "p", keyEnter)
+	if got := tuiNames(m); got != "Pexip" || m.mode != modeBrowse {
+		t.Errorf("expected search by ID to keep Pexip, got %s (mode %d)", got, m.mode)
+	}
+	typeKeys(m, keyEscape)
+	if len(m.view) != 5 {
+		t.Errorf("expected Esc to clear the search, got %s", tuiNames(m))
+	}
+}
+
+func TestTUIModel_SortAndCursor(t *testing.T) {
+	m := newTUIModel(sampleResult())
+	typeKeys(m, "j", "j") // Google Calendar
+	typeKeys(m, "1")
+	if got := tuiNames(m); got != "Calls,Confluence,Google Calendar,Pexip,WelcomeBot" {
+		t.Errorf("expected sort by name, got %s", got)
+	}
+	if p, _ := m.current(); p.Name != "Google Calendar" {
+		t.Errorf("expected the cursor to follow the selected plugin, got %s", p.Name)
+	}
+	typeKeys(m, "1")
+	if got := tuiNames(m); got != "WelcomeBot,Pexip,Google Calendar,Confluence,Calls" {
+		t.Errorf("expected reversed sort, got %s", got)
+	}
+	typeKeys(m, "0", keyEnd)
+	if p, _ := m.current(); p.Name != "Pexip" {
+		t.Errorf("expected End to select the last plugin in audit order, got %s", p.Name)
+	}
+	typeKeys(m, keyDown, keyPageUp)
+	if m.cursor != 0 {
+		t.Errorf("expected the cursor clamped to the list, got %d", m.cursor)
+	}
+
+	if quit := m.handleKey("q", 10); !quit {
+		t.Error("expected q to quit")
+	}
+}
+
+func TestTUIModel_Render(t *testing.T) {
+	result := sampleResultWithServer()
+	result.Plugins[0].ReleaseNotesURL = "https://github.com/mattermost/mattermost-plugin-confluence/releases/tag/v1.4.0"
+	m := newTUIModel(result)
+	typeKeys(m, "2")
+
+	lines := m.render(100, 20)
+	if len(lines) != 20 {
+		t.Fatalf("expected 20 lines, got %d", len(lines))
+	}
+	screen := ansiEscape.ReplaceAllString(strings.Join(lines, "\n"), "")
+	for _, want := range []string{
+		"mm-plugin-audit — 5 of 5 plugin(s) on https://mattermost.example.com",
+		"INSTALLED ▲",
+		"Confluence (com.mattermost.confluence)",
+		"Release notes:  https://github.com/mattermost/mattermost-plugin-confluence/releases/tag/v1.4.0",
+		"Version:        1.3.0 → 1.4.0 (YES ⚠ (minor))",
+		"q quit",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("expected screen to contain %q:\n%s", want, screen)
+		}
+	}
+	for _, line := range strings.Split(screen, "\n") {
+		if n := len([]rune(line)); n > 100 {
+			t.Errorf("line wider than the screen (%d): %q", n, line)
+		}
+	}
+
+	typeKeys(m, "m", "o", "b", "t")
+	screen = ansiEscape.ReplaceAllString(strings.Join(m.render(100, 20), "\n"), "")
+	if !strings.Contains(screen, "No plugins match the current filters.") {
+		t.Errorf("expected empty-view message:\n%s", screen)
+	}
+
+	typeKeys(m, "?")
+	screen = strings.Join(m.render(100, 20), "\n")
+	if !strings.Contains(screen, "interactive keys") {
+		t.Errorf("expected help screen:\n%s", screen)
+	}
+}
+
+func TestTUIModel_Export(t *testing.T) {
+	m := newTUIModel(sampleResult())
+	var gotPath string
+	var gotResult *AuditResult
+	m.export = func(path string, result *AuditResult) error {
+		gotPath, gotResult = path, result
+		return nil
+	}
+
+	typeKeys(m, "t", "x")
+	typeKeys(m, strings.Split("out.csv", "")...)
+	typeKeys(m, keyEnter)
+	if gotPath != "out.csv" || len(gotResult.Plugins) != 4 || gotResult.Summary.Total != 4 {
+		t.Errorf("expected the filtered view exported to out.csv, got %q %+v", gotPath, gotResult)
+	}
+	if !strings.Contains(m.message, "Exported 4 plugin(s) to out.csv (csv)") {
+		t.Errorf("unexpected status message %q", m.message)
+	}
+
+	m.export = func(string, *AuditResult) error { return errors.New("disk full") }
+	typeKeys(m, "x", "r", keyEnter)
+	if !strings.Contains(m.message, "Export failed: disk full") {
+		t.Errorf("expected export failure message, got %q", m.message)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	input := "j\x1b[A\x1b[B\x1b[5~\x1b[6~\x1b[H\x1bOF\r\x7f\x03é"
+	r := bufio.NewReader(strings.NewReader(input))
+	want := []string{"j", keyUp, keyDown, keyPageUp, keyPageDown, keyHome, keyEnd, keyEnter, keyBackspace, keyCtrlC, "é"}
+	for _, w := range want {
+		got, err := readKey(r)
+		if err != nil {
+			t.Fatalf("readKey() returned error: %v", err)
+		}
+		if got != w {
+			t.Errorf("readKey() = %q, want %q", got, w)
+		}
+	}
+
+	lone := bufio.NewReader(strings.NewReader("\x1b"))
+	if got, _ := readKey(lone); got != keyEscape {
+		t.Errorf("expected lone Esc, got %q", got)
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	for path, want := range map[string]string{"a.csv": "csv", "b.JSON": "json", "e.ndjson": "ndjson", "f.xlsx": "xlsx", "c.txt": "table", "d": "table"} {
+		if got := exportFormat(path); got != want {
+			t.Errorf("exportFormat(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
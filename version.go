@@ -0,0 +1,193 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Version is a leniently parsed plugin version. It covers semantic versions as
+// well as the looser schemes seen in the wild: two-part ("1.2"), calendar
+// ("2024.03.1"), prefixed ("v1.2.3", "release-1.2") and suffixed ("1.2.3rc1",
+// "1.2.3-beta.2") versions, with build metadata ("+build5") ignored. Only
+// recognised pre-release tags make a pre-release; other trailing text, as in
+// "1.2.3-hotfix1" or "1.2.3-ent", is kept as a suffix whose order is unknown.
+type Version struct {
+	Segments   []int  // Numeric release components, e.g. [2024 3 1]
+	Prerelease string // Pre-release tag without its separator, e.g. "rc1"; empty for a release
+	Suffix     string // Unrecognised trailing text, e.g. "hotfix1"
+}
+
+// versionPrefixes are stripped (case-insensitively) before parsing, longest first.
+var versionPrefixes = []string{"release-", "release", "version", "ver", "v"}
+
+// prereleaseTags are the leading identifiers that mark a pre-release.
+var prereleaseTags = map[string]bool{"alpha": true, "beta": true, "rc": true, "pre": true, "dev": true}
+
+// ParseVersion parses s, reporting false if it contains no numeric release component.
+func ParseVersion(s string) (Version, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, prefix := range versionPrefixes {
+		if strings.HasPrefix(s, prefix) && len(s) > len(prefix) {
+			rest := strings.TrimLeft(s[len(prefix):], " -_")
+			if rest != "" && unicode.IsDigit(rune(rest[0])) {
+				s = rest
+				break
+			}
+		}
+	}
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+
+	var v Version
+	for s != "" {
+		end := 0
+		for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			break
+		}
+		n, err := strconv.Atoi(s[:end])
+		if err != nil {
+			return Version{}, false
+		}
+		v.Segments = append(v.Segments, n)
+		s = s[end:]
+
+		// Continue only across a "." that is followed by another number
+		if len(s) > 1 && s[0] == '.' && s[1] >= '0' && s[1] <= '9' {
+			s = s[1:]
+			continue
+		}
+		break
+	}
+	if len(v.Segments) == 0 {
+		return Version{}, false
+	}
+
+	if tail := strings.TrimLeft(s, "-._ "); tail != "" {
+		if prereleaseTags[prereleaseIdentifiers(tail)[0]] {
+			v.Prerelease = tail
+		} else {
+			v.Suffix = tail
+		}
+	}
+	return v, true
+}
+
+// Comparable reports whether v and o can be ordered. Versions whose release
+// components are equal can't be if their suffixes differ, since "1.2.3-hotfix1"
+// may come before or after "1.2.3".
+func (v Version) Comparable(o Version) bool {
+	return v.Suffix == o.Suffix || v.firstDifference(o) >= 0
+}
+
+// Compare returns -1, 0 or 1 as v is older than, equal to or newer than o.
+// Missing release components count as zero, so "1.2" equals "1.2.0", and a
+// pre-release sorts before the corresponding release. Suffixes are ignored;
+// check Comparable first.
+func (v Version) Compare(o Version) int {
+	n := len(v.Segments)
+	if len(o.Segments) > n {
+		n = len(o.Segments)
+	}
+	for i := 0; i < n; i++ {
+		if c := compareInts(segment(v.Segments, i), segment(o.Segments, i)); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// firstDifference returns the index of the first release component that
+// differs between v and o, or -1 if all components are equal.
+func (v Version) firstDifference(o Version) int {
+	n := len(v.Segments)
+	if len(o.Segments) > n {
+		n = len(o.Segments)
+	}
+	for i := 0; i < n; i++ {
+		if segment(v.Segments, i) != segment(o.Segments, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func segment(segments []int, i int) int {
+	if i < len(segments) {
+		return segments[i]
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease orders pre-release tags identifier by identifier, splitting
+// on separators and letter/digit boundaries ("rc10" is "rc", 10). Numeric
+// identifiers compare numerically and sort before alphanumeric ones, so
+// "rc2" < "rc10" and "beta" < "rc".
+func comparePrerelease(a, b string) int {
+	ai, bi := prereleaseIdentifiers(a), prereleaseIdentifiers(b)
+	for i := 0; i < len(ai) && i < len(bi); i++ {
+		an, aErr := strconv.Atoi(ai[i])
+		bn, bErr := strconv.Atoi(bi[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInts(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(ai[i], bi[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(ai), len(bi))
+}
+
+func prereleaseIdentifiers(s string) []string {
+	var ids []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			ids = append(ids, cur.String())
+			cur.Reset()
+		}
+	}
+	for i, r := range s {
+		switch {
+		case r == '.' || r == '-' || r == '_':
+			flush()
+			continue
+		case i > 0 && cur.Len() > 0 && unicode.IsDigit(r) != unicode.IsDigit(rune(s[i-1])):
+			flush()
+		}
+		cur.WriteRune(r)
+	}
+	flush()
+	return ids
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input      string
+		segments   []int
+		prerelease string
+		ok         bool
+	}{
+		{"1.2.3", []int{1, 2, 3}, "", true},
+		{"v1.2.3", []int{1, 2, 3}, "", true},
+		{"1.2", []int{1, 2}, "", true},
+		{"2024.03.1", []int{2024, 3, 1}, "", true},
+		{"release-1.2", []int{1, 2}, "", true},
+		{"Version 4.0", []int{4, 0}, "", true},
+		{"1.2.3+build5", []int{1, 2, 3}, "", true},
+		{"1.2.3-rc1", []int{1, 2, 3}, "rc1", true},
+		{"1.2.3rc1", []int{1, 2, 3}, "rc1", true},
+		{"1.2.3-beta.2+sha.abc", []int{1, 2, 3}, "beta.2", true},
+		{"1.2.beta", []int{1, 2}, "beta", true},
+		{"2.0.0-dev3", []int{2, 0, 0}, "dev3", true},
+		{"2.0.0.pre.1", []int{2, 0, 0}, "pre.1", true},
+		{"custom-build", nil, "", false},
+		{"", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, ok := ParseVersion(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("ParseVersion(%q) ok = %v, want %v", tt.input, ok, tt.ok)
+			}
+			if !reflect.DeepEqual(v.Segments, tt.segments) || v.Prerelease != tt.prerelease {
+				t.Errorf("ParseVersion(%q) = %v %q, want %v %q", tt.input, v.Segments, v.Prerelease, tt.segments, tt.prerelease)
+			}
+		})
+	}
+}
+
+func TestParseVersion_Suffix(t *testing.T) {
+	tests := []struct {
+		input      string
+		prerelease string
+		suffix     string
+	}{
+		{"1.2.3-hotfix1", "", "hotfix1"},
+		{"1.2.3-ent", "", "ent"},
+		{"1.2.3.ent.2", "", "ent.2"},
+		{"1.2.3-1", "", "1"},
+		{"1.2.3-RC1", "rc1", ""},
+		{"1.2.3-beta-ent", "beta-ent", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, ok := ParseVersion(tt.input)
+			if !ok || v.Prerelease != tt.prerelease || v.Suffix != tt.suffix {
+				t.Errorf("ParseVersion(%q) = prerelease %q, suffix %q (%v), want %q, %q",
+					tt.input, v.Prerelease, v.Suffix, ok, tt.prerelease, tt.suffix)
+			}
+		})
+	}
+}
+
+func TestVersionCompare_Prerelease(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		expect int
+	}{
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+		{"1.0.0-beta", "1.0.0-rc1", -1},
+		{"1.0.0-rc2", "1.0.0-rc10", -1},
+		{"1.0.0-rc.1", "1.0.0-rc1", 0},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-rc", "1.0.0-rc.1", -1},
+		{"1.0.0-rc1", "1.0.0", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			a, _ := ParseVersion(tt.a)
+			b, _ := ParseVersion(tt.b)
+			if got := a.Compare(b); got != tt.expect {
+				t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.expect)
+			}
+			if got := b.Compare(a); got != -tt.expect {
+				t.Errorf("Compare(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.expect)
+			}
+		})
+	}
+}
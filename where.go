@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WhereExpr is a compiled --where expression. The language is small:
+//
+//	expr   := term { "||" term }
+//	term   := factor { "&&" factor }
+//	factor := "!" factor | "(" expr ")" | field [ op value ]
+//	op     := "==" | "!=" | "=~" | "!~" | "<" | "<=" | ">" | ">="
+//	value  := "string" | 'string' | number | true | false | null
+//
+// Fields are PluginReport's JSON names (e.g. source, update_state). A field on
+// its own is true when it is non-empty and not "false". == and != ignore case,
+// =~ and !~ take a regular expression, and the ordering operators compare
+// integers numerically, then versions as versions, then strings.
+type WhereExpr struct {
+	source string
+	root   whereNode
+}
+
+// ParseWhere compiles a --where expression.
+func ParseWhere(s string) (*WhereExpr, error) {
+	tokens, err := lexWhere(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &whereParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", tok, tok.pos+1)
+	}
+	return &WhereExpr{source: s, root: root}, nil
+}
+
+// Match reports whether r satisfies the expression.
+func (e *WhereExpr) Match(r PluginReport) bool {
+	return e.root.eval(r)
+}
+
+func (e *WhereExpr) String() string {
+	return e.source
+}
+
+type whereNode interface {
+	eval(r PluginReport) bool
+}
+
+type orNode struct{ left, right whereNode }
+
+func (n orNode) eval(r PluginReport) bool { return n.left.eval(r) || n.right.eval(r) }
+
+type andNode struct{ left, right whereNode }
+
+func (n andNode) eval(r PluginReport) bool { return n.left.eval(r) && n.right.eval(r) }
+
+type notNode struct{ operand whereNode }
+
+func (n notNode) eval(r PluginReport) bool { return !n.operand.eval(r) }
+
+type truthyNode struct{ field reportField }
+
+func (n truthyNode) eval(r PluginReport) bool {
+	v := n.field.Value(r)
+	return v != "" && v != "false"
+}
+
+type compareNode struct {
+	field reportField
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (n compareNode) eval(r PluginReport) bool {
+	v := n.field.Value(r)
+	switch n.op {
+	case "==":
+		return strings.EqualFold(v, n.value)
+	case "!=":
+		return !strings.EqualFold(v, n.value)
+	case "=~":
+		return n.re.MatchString(v)
+	case "!~":
+		return !n.re.MatchString(v)
+	}
+
+	if v == "" {
+		return false // Missing values are neither less nor greater than anything
+	}
+	c := compareOrdered(v, n.value)
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// compareOrdered compares a and b as integers if both are integers, as
+// versions if both parse as versions (so "1.10" sorts after "1.9"), and as
+// strings otherwise.
+func compareOrdered(a, b string) int {
+	ia, errA := strconv.ParseInt(a, 10, 64)
+	ib, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case ia < ib:
+			return -1
+		case ia > ib:
+			return 1
+		}
+		return 0
+	}
+	if c, ok := CompareVersions(a, b); ok {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+type whereTokenKind int
+
+const (
+	tokEOF whereTokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type whereToken struct {
+	kind whereTokenKind
+	text string
+	pos  int
+}
+
+func (t whereToken) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+var whereOperators = []string{"&&", "||", "==", "!=", "=~", "!~", "<=", ">=", "<", ">", "!"}
+
+func lexWhere(s string) ([]whereToken, error) {
+	var tokens []whereToken
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, whereToken{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, whereToken{tokRParen, ")", i})
+			i++
+		case c == '"' || c == '\'':
+			text, n, err := lexWhereString(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at position %d", err, i+1)
+			}
+			tokens = append(tokens, whereToken{tokString, text, i})
+			i += n
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(s) && (isWhereIdentChar(s[i]) || s[i] == '.' || s[i] == '-' || s[i] == '+') {
+				i++
+			}
+			tokens = append(tokens, whereToken{tokNumber, s[start:i], start})
+		case isWhereIdentChar(c):
+			start := i
+			for i < len(s) && isWhereIdentChar(s[i]) {
+				i++
+			}
+			tokens = append(tokens, whereToken{tokIdent, s[start:i], start})
+		default:
+			op := ""
+			for _, candidate := range whereOperators {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i+1)
+			}
+			tokens = append(tokens, whereToken{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, whereToken{kind: tokEOF, pos: len(s)}), nil
+}
+
+// lexWhereString reads a quoted string at the start of s, returning its
+// unescaped value and the number of bytes consumed. Double-quoted strings use
+// Go escapes; single-quoted strings are literal, which suits regular expressions.
+func lexWhereString(s string) (string, int, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote:
+			if quote == '\'' {
+				return s[1:i], i + 1, nil
+			}
+			text, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return text, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isWhereIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type whereParser struct {
+	tokens []whereToken
+	pos    int
+}
+
+func (p *whereParser) peek() whereToken {
+	return p.tokens[p.pos]
+}
+
+func (p *whereParser) next() whereToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *whereParser) acceptOp(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *whereParser) parseOr() (whereNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parseAnd() (whereNode, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("&&") {
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parseFactor() (whereNode, error) {
+	if p.acceptOp("!") {
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected \")\" at position %d, got %s", closing.pos+1, closing)
+		}
+		return inner, nil
+	case tokIdent:
+		return p.parseComparison(tok)
+	}
+	return nil, fmt.Errorf("expected a field name at position %d, got %s", tok.pos+1, tok)
+}
+
+func (p *whereParser) parseComparison(name whereToken) (whereNode, error) {
+	field, ok := lookupReportField(name.text)
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at position %d (fields: %s)",
+			name.text, name.pos+1, strings.Join(reportFieldNames(), ", "))
+	}
+
+	op := p.peek()
+	if op.kind != tokOp || op.text == "&&" || op.text == "||" || op.text == "!" {
+		return truthyNode{field}, nil
+	}
+	p.next()
+
+	valueTok := p.next()
+	var value string
+	switch {
+	case valueTok.kind == tokString || valueTok.kind == tokNumber:
+		value = valueTok.text
+	case valueTok.kind == tokIdent && (valueTok.text == "true" || valueTok.text == "false"):
+		value = valueTok.text
+	case valueTok.kind == tokIdent && valueTok.text == "null":
+		value = ""
+	default:
+		return nil, fmt.Errorf("expected a value after %s at position %d, got %s", op.text, valueTok.pos+1, valueTok)
+	}
+
+	node := compareNode{field: field, op: op.text, value: value}
+	if op.text == "=~" || op.text == "!~" {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", value, err)
+		}
+		node.re = re
+	}
+	return node, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWhere(t *testing.T) {
+	confluence := PluginReport{
+		PluginID:         "com.mattermost.confluence",
+		Name:             "Confluence",
+		InstalledVersion: "1.3.0",
+		LatestVersion:    "1.4.0",
+		UpdateAvailable:  "true",
+		Status:           "disabled",
+		Source:           SourceMarketplace,
+		PluginType:       "both",
+		UpdateState:      UpdateStateOutdated,
+		UpdateSeverity:   SeverityMinor,
+		ReleasesBehind:   intPtr(3),
+	}
+
+	tests := []struct {
+		expr   string
+		expect bool
+	}{
+		{`source == "marketplace" && status == "disabled"`, true},
+		{`source == "marketplace" && status == "enabled"`, false},
+		{`source == 'bundled' || update_available == true`, true},
+		{`!(status == "enabled")`, true},
+		{`status != "DISABLED"`, false},
+		{`plugin_id =~ '^com\.mattermost\.'`, true},
+		{`name !~ "(?i)confluence"`, false},
+		{`releases_behind >= 3 && releases_behind < 10`, true},
+		{`releases_behind > 3`, false},
+		{`installed_version < 1.10.0`, true},
+		{`installed_version > "1.10"`, false},
+		{`installed_version < "1.3.0-rc1"`, false},
+		{`marketplace_url == null`, true},
+		{`update_severity`, true},
+		{`!marketplace_url`, true},
+		{`(source == "bundled" || source == "marketplace") && !(type == "server")`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseWhere(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseWhere(%q) returned error: %v", tt.expr, err)
+			}
+			if got := expr.Match(confluence); got != tt.expect {
+				t.Errorf("Match() = %v, want %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestParseWhere_Errors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{`colour == "red"`, "unknown field"},
+		{`source ==`, "expected a value"},
+		{`source == "marketplace`, "unterminated string"},
+		{`(source == "bundled"`, `expected ")"`},
+		{`source == "bundled")`, "unexpected"},
+		{`source = "bundled"`, "unexpected character"},
+		{`name =~ "("`, "invalid regular expression"},
+		{`&& status`, "expected a field name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseWhere(tt.expr)
+			if err == nil {
+				t.Fatalf("ParseWhere(%q) expected error", tt.expr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseWhere(%q) error = %q, want it to contain %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The workbook is written as minimal Office Open XML (SpreadsheetML) by hand,
+// which keeps the tool free of a spreadsheet dependency. Strings are stored
+// inline, so values such as "=cmd" are never evaluated as formulas.
+
+// Cell styles, as indexes into cellXfs in xlsxStyles.
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleHeader  = 1
+	xlsxStyleDate    = 2
+)
+
+// xlsxSheetNames maps each plugin source to its sheet name.
+var xlsxSheetNames = map[string]string{
+	SourceMarketplace: "Marketplace",
+	SourceMattermost:  "Mattermost",
+	SourceBundled:     "Bundled",
+	SourceThirdParty:  "Third-Party",
+}
+
+// xlsxSummaryColumns are the columns of the Summary sheet after the server
+// columns.
+var xlsxSummaryColumns = []struct {
+	title string
+	value func(AuditSummary) int
+}{
+	{"total", func(s AuditSummary) int { return s.Total }},
+	{"marketplace", func(s AuditSummary) int { return s.Marketplace }},
+	{"mattermost_plugin", func(s AuditSummary) int { return s.MattermostPlugin }},
+	{"bundled", func(s AuditSummary) int { return s.Bundled }},
+	{"third_party", func(s AuditSummary) int { return s.ThirdParty }},
+	{"outdated", func(s AuditSummary) int { return s.Outdated }},
+	{"up_to_date", func(s AuditSummary) int { return s.UpToDate }},
+	{"ahead", func(s AuditSummary) int { return s.Ahead }},
+	{"incomparable", func(s AuditSummary) int { return s.Incomparable }},
+	{"unknown", func(s AuditSummary) int { return s.Unknown }},
+	{"enabled", func(s AuditSummary) int { return s.Enabled }},
+	{"disabled", func(s AuditSummary) int { return s.Disabled }},
+}
+
+// xlsxCell is one cell value: a string, a number, or a date.
+type xlsxCell struct {
+	text   string
+	number *float64
+	date   *time.Time
+}
+
+func xlsxString(s string) xlsxCell { return xlsxCell{text: s} }
+
+func xlsxNumber(n int) xlsxCell {
+	f := float64(n)
+	return xlsxCell{number: &f}
+}
+
+// xlsxSheet is a worksheet: a header row, data rows, and the column (if any)
+// whose value marks a row for highlighting, such as an outdated plugin.
+type xlsxSheet struct {
+	name      string
+	header    []string
+	rows      [][]xlsxCell
+	flagCol   int
+	flagValue string
+}
+
+// WriteXLSX writes an audit result as an Excel workbook: a Summary sheet and
+// one sheet per plugin source, showing columns, or every field when none are
+// given, leaving out releases_behind without release history. Settings
+// findings, server plugin settings and orphans each add a sheet.
+func WriteXLSX(w io.Writer, result *AuditResult, columns []reportField) error {
+	if len(columns) == 0 {
+		for _, col := range reportFields {
+			if (col.Name != "settings_issues" || result.SettingsAudited) && (col.Name != "releases_behind" || result.VersionHistory) {
+				columns = append(columns, col)
+			}
+		}
+	}
+
+	sheets := []xlsxSheet{xlsxSummarySheet(result)}
+	for _, section := range tableSections {
+		var plugins []PluginReport
+		for _, p := range result.Plugins {
+			if p.Source == section.source || (section.source == SourceThirdParty && !isKnownSource(p.Source)) {
+				plugins = append(plugins, p)
+			}
+		}
+		sheets = append(sheets, xlsxPluginSheet(xlsxSheetNames[section.source], columns, plugins))
+	}
+	if result.SettingsAudited {
+		sheets = append(sheets, xlsxSettingsSheet(result))
+	}
+	if result.ServerSettings != nil {
+		sheets = append(sheets, xlsxServerSettingsSheet(result.ServerSettings))
+	}
+	if result.Orphans != nil {
+		sheets = append(sheets, xlsxOrphansSheet(result.Orphans))
+	}
+
+	var modified time.Time
+	if result.Server != nil {
+		modified = result.Server.AuditedAt
+	}
+	return writeXLSXPackage(w, sheets, modified)
+}
+
+// xlsxSummarySheet builds the Summary sheet.
+func xlsxSummarySheet(result *AuditResult) xlsxSheet {
+	sheet := xlsxSheet{name: "Summary", header: []string{"server", "server_version", "audited_at"}, flagCol: -1}
+	for _, col := range xlsxSummaryColumns {
+		sheet.header = append(sheet.header, col.title)
+	}
+	row := []xlsxCell{{}, {}, {}}
+	if result.Server != nil {
+		row[0] = xlsxString(result.Server.URL)
+		row[1] = xlsxString(result.Server.Version)
+		if !result.Server.AuditedAt.IsZero() {
+			at := result.Server.AuditedAt
+			row[2] = xlsxCell{date: &at}
+		}
+	}
+	for _, col := range xlsxSummaryColumns {
+		row = append(row, xlsxNumber(col.value(result.Summary)))
+	}
+	sheet.rows = append(sheet.rows, row)
+	return sheet
+}
+
+// xlsxPluginSheet builds a sheet of plugins.
+func xlsxPluginSheet(name string, columns []reportField, plugins []PluginReport) xlsxSheet {
+	sheet := xlsxSheet{name: name, flagCol: -1}
+	for i, col := range columns {
+		sheet.header = append(sheet.header, col.Name)
+		switch {
+		case col.Name == "update_state":
+			sheet.flagCol, sheet.flagValue = i, UpdateStateOutdated
+		case col.Name == "update_available" && sheet.flagValue != UpdateStateOutdated:
+			sheet.flagCol, sheet.flagValue = i, "true"
+		}
+	}
+
+	for _, p := range plugins {
+		sheet.rows = append(sheet.rows, xlsxPluginRow(p, columns))
+	}
+	return sheet
+}
+
+// xlsxSettingsSheet builds the Settings sheet, one row per finding.
+func xlsxSettingsSheet(result *AuditResult) xlsxSheet {
+	sheet := xlsxSheet{name: "Settings", flagCol: -1}
+	sheet.header = append(sheet.header, "plugin_id", "name", "setting", "issue", "value", "default", "message")
+	for _, p := range result.Plugins {
+		for _, f := range p.Settings {
+			var row []xlsxCell
+			for _, v := range []string{p.PluginID, p.Name, f.Key, f.Issue, f.Value, f.Default, f.Message} {
+				row = append(row, xlsxString(v))
+			}
+			sheet.rows = append(sheet.rows, row)
+		}
+	}
+	return sheet
+}
+
+// xlsxServerSettingsSheet builds the Server Settings sheet, highlighting
+// warnings.
+func xlsxServerSettingsSheet(report *ServerSettingsReport) xlsxSheet {
+	sheet := xlsxSheet{name: "Server Settings", flagValue: ServerSettingWarn}
+	sheet.header = append(sheet.header, "setting", "value", "recommended", "status", "reason")
+	sheet.flagCol = len(sheet.header) - 2
+	for _, c := range report.Checks {
+		var row []xlsxCell
+		for _, v := range []string{c.Setting, c.DisplayValue(), strconv.FormatBool(c.Recommended), c.Status, c.Reason} {
+			row = append(row, xlsxString(v))
+		}
+		sheet.rows = append(sheet.rows, row)
+	}
+	return sheet
+}
+
+// xlsxOrphansSheet builds the Orphans sheet.
+func xlsxOrphansSheet(orphans []Orphan) xlsxSheet {
+	sheet := xlsxSheet{name: "Orphans", flagCol: -1}
+	sheet.header = append(sheet.header, "plugin_id", "issue", "plugin_state", "has_settings", "status")
+	for _, o := range orphans {
+		var row []xlsxCell
+		for _, v := range []string{o.PluginID, o.Issue, o.State, strconv.FormatBool(o.HasSettings), o.Status} {
+			row = append(row, xlsxString(v))
+		}
+		sheet.rows = append(sheet.rows, row)
+	}
+	return sheet
+}
+
+// xlsxPluginRow returns p's cells, storing numeric fields as numbers.
+func xlsxPluginRow(p PluginReport, columns []reportField) []xlsxCell {
+	row := make([]xlsxCell, len(columns))
+	for i, col := range columns {
+		v := col.Value(p)
+		if n, err := strconv.Atoi(v); err == nil && col.Numeric() {
+			row[i] = xlsxNumber(n)
+		} else {
+			row[i] = xlsxString(v)
+		}
+	}
+	return row
+}
+
+// xlsxColumnName returns the spreadsheet column letters for a zero-based
+// index: A, B, ..., Z, AA, AB, ...
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxDateSerial converts t to an Excel date serial number (days since
+// 1899-12-30, in UTC).
+func xlsxDateSerial(t time.Time) float64 {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return t.UTC().Sub(epoch).Hours() / 24
+}
+
+// writeXLSXPackage writes the sheets as a zip package, stamping entries with
+// modified so the same audit produces the same bytes.
+func writeXLSXPackage(w io.Writer, sheets []xlsxSheet, modified time.Time) error {
+	if modified.IsZero() {
+		modified = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	zw := zip.NewWriter(w)
+	add := func(name, content string) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, content)
+		return err
+	}
+
+	var types, workbook, rels strings.Builder
+	types.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	types.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`, len(sheets)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", types.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, sheet := range sheets {
+		parts = append(parts, struct{ name, content string }{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheet.xml()})
+	}
+	for _, part := range parts {
+		if err := add(part.name, part.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// xml renders the worksheet with a frozen, filterable header row and, when
+// the sheet has an outdated marker column, a rule shading outdated rows.
+func (s xlsxSheet) xml() string {
+	lastCol := xlsxColumnName(len(s.header) - 1)
+	lastRow := len(s.rows) + 1
+
+	var b strings.Builder
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	fmt.Fprintf(&b, `<dimension ref="A1:%s%d"/>`, lastCol, lastRow)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0">` +
+		`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>` +
+		`<selection pane="bottomLeft" activeCell="A2" sqref="A2"/></sheetView></sheetViews>`)
+
+	b.WriteString(`<cols>`)
+	for i, width := range s.columnWidths() {
+		fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+	}
+	b.WriteString(`</cols><sheetData>`)
+
+	b.WriteString(`<row r="1">`)
+	for i, title := range s.header {
+		writeXLSXCell(&b, i, 1, xlsxString(title), xlsxStyleHeader)
+	}
+	b.WriteString(`</row>`)
+	for r, row := range s.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+2)
+		for i, cell := range row {
+			writeXLSXCell(&b, i, r+2, cell, xlsxStyleDefault)
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData>`)
+
+	fmt.Fprintf(&b, `<autoFilter ref="A1:%s%d"/>`, lastCol, lastRow)
+	if s.flagCol >= 0 && len(s.rows) > 0 {
+		fmt.Fprintf(&b, `<conditionalFormatting sqref="A2:%s%d"><cfRule type="expression" dxfId="0" priority="1">`+
+			`<formula>$%s2=&quot;%s&quot;</formula></cfRule></conditionalFormatting>`,
+			lastCol, lastRow, xlsxColumnName(s.flagCol), xmlEscape(s.flagValue))
+	}
+	b.WriteString(`</worksheet>`)
+	return b.String()
+}
+
+// columnWidths sizes each column to its longest value, within limits.
+func (s xlsxSheet) columnWidths() []int {
+	widths := make([]int, len(s.header))
+	for i, title := range s.header {
+		widths[i] = utf8.RuneCountInString(title) + 4 // Room for the filter button
+	}
+	for _, row := range s.rows {
+		for i, cell := range row {
+			n := utf8.RuneCountInString(cell.text)
+			if cell.number != nil {
+				n = len(strconv.FormatFloat(*cell.number, 'f', -1, 64))
+			} else if cell.date != nil {
+				n = 19
+			}
+			if n+2 > widths[i] {
+				widths[i] = n + 2
+			}
+		}
+	}
+	for i := range widths {
+		if widths[i] > 60 {
+			widths[i] = 60
+		}
+	}
+	return widths
+}
+
+func writeXLSXCell(b *strings.Builder, col, row int, cell xlsxCell, style int) {
+	ref := fmt.Sprintf("%s%d", xlsxColumnName(col), row)
+	styleAttr := ""
+	if style != xlsxStyleDefault {
+		styleAttr = fmt.Sprintf(` s="%d"`, style)
+	}
+	switch {
+	case cell.number != nil:
+		fmt.Fprintf(b, `<c r="%s"%s><v>%s</v></c>`, ref, styleAttr, strconv.FormatFloat(*cell.number, 'f', -1, 64))
+	case cell.date != nil:
+		fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, xlsxStyleDate, strconv.FormatFloat(xlsxDateSerial(*cell.date), 'f', -1, 64))
+	case cell.text != "":
+		fmt.Fprintf(b, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, styleAttr, xmlEscape(cell.text))
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// xlsxStyles defines the cell styles (default, bold header, date) and the
+// differential style used to shade outdated rows: Excel's "light red fill
+// with dark red text".
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="FFD9E1F2"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`<dxfs count="1"><dxf><font><color rgb="FF9C0006"/></font><fill><patternFill><bgColor rgb="FFFFC7CE"/></patternFill></fill></dxf></dxfs>` +
+	`</styleSheet>`
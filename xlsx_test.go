@@ -0,0 +1,148 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readXLSX returns the parts of a workbook, keyed by name.
+func readXLSX(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("workbook is not a valid zip: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(content)
+
+		// Every part must be well-formed XML
+		dec := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well-formed XML: %v", f.Name, err)
+			}
+		}
+	}
+	return parts
+}
+
+func sheetNames(t *testing.T, workbook string) []string {
+	t.Helper()
+	var wb struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal([]byte(workbook), &wb); err != nil {
+		t.Fatalf("parsing workbook.xml: %v", err)
+	}
+	var names []string
+	for _, s := range wb.Sheets {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteOutput(&buf, sampleResultWithServer(), OutputOptions{Format: "xlsx"}); err != nil {
+		t.Fatalf("WriteOutput() returned error: %v", err)
+	}
+	parts := readXLSX(t, buf.Bytes())
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	got := strings.Join(sheetNames(t, parts["xl/workbook.xml"]), ",")
+	if got != "Summary,Marketplace,Mattermost,Bundled,Third-Party" {
+		t.Errorf("unexpected sheets: %s", got)
+	}
+
+	summary := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<t xml:space="preserve">https://mattermost.example.com</t>`,
+		`<c r="C2" s="2"><v>`, // audited_at as a date
+		`<c r="D2"><v>5</v></c>`,
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary sheet missing %s", want)
+		}
+	}
+
+	marketplace := parts["xl/worksheets/sheet2.xml"]
+	for _, want := range []string{
+		`state="frozen"`,
+		`<autoFilter ref="A1:M3"/>`, // No releases_behind without release history
+		`<formula>$J2=&quot;outdated&quot;</formula>`,
+		`<t xml:space="preserve">Confluence</t>`,
+		`<c r="A1" s="1" t="inlineStr">`,
+	} {
+		if !strings.Contains(marketplace, want) {
+			t.Errorf("marketplace sheet missing %s", want)
+		}
+	}
+}
+
+func TestWriteXLSX_ReleaseHistory(t *testing.T) {
+	for _, history := range []bool{false, true} {
+		result := sampleResultWithServer()
+		result.VersionHistory = history
+		var buf bytes.Buffer
+		if err := WriteXLSX(&buf, result, nil); err != nil {
+			t.Fatalf("WriteXLSX() returned error: %v", err)
+		}
+		sheet := readXLSX(t, buf.Bytes())["xl/worksheets/sheet2.xml"]
+		if got := strings.Contains(sheet, ">releases_behind<"); got != history {
+			t.Errorf("with release history %v, releases_behind column shown = %v", history, got)
+		}
+	}
+}
+
+func TestWriteXLSX_Columns(t *testing.T) {
+	columns, _ := ParseColumns("name,releases_behind,update_available")
+	result := sampleResultWithServer()
+	result.Plugins[0].ReleasesBehind = intPtr(3)
+	result.Plugins[0].Name = "=HYPERLINK(\"x\")"
+
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, result, columns); err != nil {
+		t.Fatalf("WriteXLSX() returned error: %v", err)
+	}
+	sheet := readXLSX(t, buf.Bytes())["xl/worksheets/sheet2.xml"]
+
+	for _, want := range []string{
+		`<c r="B2"><v>3</v></c>`,                          // Numbers stay numeric
+		`<formula>$C2=&quot;true&quot;</formula>`,         // Falls back to update_available
+		`<t xml:space="preserve">=HYPERLINK(&#34;x&#34;)`, // Stored as text, not a formula
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet missing %s:\n%s", want, sheet)
+		}
+	}
+	if strings.Contains(sheet, "<f>") {
+		t.Error("expected no formulas in cells")
+	}
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumnName(i); got != want {
+			t.Errorf("xlsxColumnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}